@@ -18,9 +18,7 @@ package main
 
 import (
 	"flag"
-	"fmt"
 	"net/http"
-	"os"
 
 	handler "github.com/verrazzano/verrazzano-monitoring-instance-api/handlers"
 	"go.uber.org/zap"
@@ -39,15 +37,18 @@ func main() {
 
 	k8s, err := handler.NewK8s(config)
 	if err != nil {
-		fmt.Println(err)
+		zap.S().Errorf("Unable to create the Kubernetes client: %v", err)
 		return
 	}
 	// Create a New Router with all handlers
 	router := k8s.NewRouter(config)
 
+	// Delete the PushGateway groups not pushed within -pushgatewayGroupTTL, if set
+	handler.StartPushGatewayJanitor(nil)
+
 	// Start the server
-	http.ListenAndServe(handler.ListenURL, router)
-	fmt.Fprintf(os.Stdout, "quit unexpectedly: reason unknown")
+	err = http.ListenAndServe(handler.ListenURL, router)
+	zap.S().Errorf("quit unexpectedly: %v", err)
 
 }
 
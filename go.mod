@@ -9,17 +9,25 @@ replace (
 	github.com/gogo/protobuf => github.com/gogo/protobuf v1.3.2
 	golang.org/x/crypto => golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f
 )
+
 require (
 	github.com/Jeffail/gabs/v2 v2.2.0
+	github.com/evanphx/json-patch v4.5.0+incompatible
 	github.com/go-swagger/go-swagger v0.21.0
 	github.com/gogo/protobuf v1.3.2 // indirect
 	github.com/gorilla/mux v1.7.3
+	github.com/prometheus/alertmanager v0.21.0
+	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/common v0.11.1
+	github.com/prometheus/prometheus v1.8.2-0.20200819132913-cb830b0a9c78
 	github.com/stretchr/testify v1.5.1
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f // indirect
-	k8s.io/api v0.18.2
-	k8s.io/apimachinery v0.18.2
-	k8s.io/client-go v0.18.2
+	gopkg.in/yaml.v2 v2.3.0
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
+	k8s.io/api v0.18.6
+	k8s.io/apimachinery v0.18.6
+	k8s.io/client-go v0.18.6
 	sigs.k8s.io/controller-runtime v0.6.0
 	sigs.k8s.io/yaml v1.2.0
 )
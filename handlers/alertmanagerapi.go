@@ -0,0 +1,113 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// These can be set from the command line via -alertmanagerPodSelector and -alertmanagerPort.  The selector defaults to
+// the Alertmanager pods of the VMI.
+var (
+	alertmanagerPodSelector string
+	alertmanagerPort        = "9093"
+)
+
+var errNoAlertmanagerPods = errors.New("no ready Alertmanager pods were found")
+
+// AlertmanagerAPIError is a response of the Alertmanager API other than a success, such as a 400 for an invalid
+// silence.
+type AlertmanagerAPIError struct {
+	Status  int
+	Message string
+}
+
+func (e *AlertmanagerAPIError) Error() string {
+	return fmt.Sprintf("Alertmanager returned status %d: %s", e.Status, e.Message)
+}
+
+// getAlertmanagerPodSelector returns the label selector of the Alertmanager pods.
+func getAlertmanagerPodSelector() string {
+	if alertmanagerPodSelector != "" {
+		return alertmanagerPodSelector
+	}
+	return "app=vmi-" + vmiName + "-alertmanager"
+}
+
+// getAlertmanagerURLs returns the base URLs of the ready Alertmanager pods.  The pods of a cluster gossip silences and
+// notifications to each other, so a call to any of them is enough.
+func (k *K8s) getAlertmanagerURLs(logger *zap.SugaredLogger) ([]string, error) {
+	pods, err := k.getReadyPodsByLabel(logger, getAlertmanagerPodSelector(), true)
+	if err != nil {
+		return nil, err
+	}
+	var urls []string
+	for _, pod := range pods.Items {
+		if pod.Status.PodIP != "" {
+			urls = append(urls, "http://"+net.JoinHostPort(pod.Status.PodIP, alertmanagerPort))
+		}
+	}
+	if len(urls) == 0 {
+		return nil, errNoAlertmanagerPods
+	}
+	return urls, nil
+}
+
+// alertmanagerAPI calls the given endpoint of the Alertmanager API, e.g. "/api/v2/silences", on the first ready pod
+// that answers, and decodes the response into data, if not nil.  Responses other than a success are returned as an
+// *AlertmanagerAPIError: a client error at once, a server error only once no other pod answered with a success.
+func (k *K8s) alertmanagerAPI(logger *zap.SugaredLogger, method string, apiPath string, params url.Values, payload interface{}, data interface{}) error {
+	urls, err := k.getAlertmanagerURLs(logger)
+	if err != nil {
+		return err
+	}
+	body := ""
+	if payload != nil {
+		b, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = string(b)
+	}
+	headers := map[string]string{"Accept": ContentTypeJSON, "Content-Type": ContentTypeJSON}
+	var serverError *AlertmanagerAPIError
+	for _, baseURL := range urls {
+		apiURL := baseURL + apiPath
+		if len(params) > 0 {
+			apiURL += "?" + params.Encode()
+		}
+		resp, respBody, err := sendRequest(method, apiURL, "", headers, body, "", "")
+		if err != nil {
+			// Try the next pod
+			logger.Warnf("Unable to call the Alertmanager API at %s: %v", baseURL, err)
+			continue
+		}
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+			apiError := &AlertmanagerAPIError{Status: resp.StatusCode, Message: strings.Trim(strings.TrimSpace(respBody), `"`)}
+			if resp.StatusCode < http.StatusInternalServerError {
+				return apiError
+			}
+			// The request may succeed on another pod
+			logger.Warnf("Unable to call the Alertmanager API at %s: %v", baseURL, apiError)
+			serverError = apiError
+			continue
+		}
+		if data == nil {
+			return nil
+		}
+		return json.Unmarshal([]byte(respBody), data)
+	}
+	if serverError != nil {
+		return serverError
+	}
+	return fmt.Errorf("unable to call the Alertmanager API of any of the pods %s", strings.Join(urls, ", "))
+}
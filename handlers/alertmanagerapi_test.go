@@ -0,0 +1,185 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// fakeAlertmanager answers the silences and alerts endpoints of the Alertmanager API, keeping the silences and alerts
+// created in memory.  Alerts with a label matching a key of routes, such as "team=api", are routed to its receiver,
+// and others to test-orig.  Alerts routed to a receiver with a webhook are posted to it, as the webhook receiver does.
+type fakeAlertmanager struct {
+	sync.Mutex
+	silences []Silence
+	filters  []string
+	alerts   []gettableAlert
+	routes   map[string]string
+	webhooks map[string]string
+}
+
+func (am *fakeAlertmanager) route(labels map[string]string) string {
+	for name, value := range labels {
+		if receiver, ok := am.routes[name+"="+value]; ok {
+			return receiver
+		}
+	}
+	return "test-orig"
+}
+
+func (am *fakeAlertmanager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	am.Lock()
+	defer am.Unlock()
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v2/silences":
+		am.filters = r.URL.Query()["filter"]
+		json.NewEncoder(w).Encode(am.silences)
+	case r.Method == "POST" && r.URL.Path == "/api/v2/silences":
+		var silence Silence
+		if err := json.NewDecoder(r.Body).Decode(&silence); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "%q", err.Error())
+			return
+		}
+		silence.ID = fmt.Sprintf("0000000%d-1111-2222-3333-444444444444", len(am.silences))
+		silence.Status = &SilenceStatus{State: silenceStateActive}
+		if silence.StartsAt.After(time.Now()) {
+			silence.Status.State = silenceStatePending
+		}
+		am.silences = append(am.silences, silence)
+		fmt.Fprintf(w, `{"silenceID":%q}`, silence.ID)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/api/v2/silence/"):
+		for i := range am.silences {
+			if am.silences[i].ID == strings.TrimPrefix(r.URL.Path, "/api/v2/silence/") {
+				am.silences[i].Status.State = silenceStateExpired
+				return
+			}
+		}
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `"silence not found"`)
+	case r.Method == "GET" && r.URL.Path == "/api/v2/alerts":
+		am.filters = r.URL.Query()["filter"]
+		json.NewEncoder(w).Encode(am.alerts)
+	case r.Method == "POST" && r.URL.Path == "/api/v2/alerts":
+		var alerts []postableAlert
+		if err := json.NewDecoder(r.Body).Decode(&alerts); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "%q", err.Error())
+			return
+		}
+		for _, alert := range alerts {
+			receiver := am.route(alert.Labels)
+			gettable := gettableAlert{Labels: alert.Labels}
+			gettable.Receivers = append(gettable.Receivers, struct {
+				Name string `json:"name"`
+			}{Name: receiver})
+			am.alerts = append(am.alerts, gettable)
+			if webhook, ok := am.webhooks[receiver]; ok {
+				b, _ := json.Marshal(map[string]interface{}{"receiver": receiver, "status": "firing", "alerts": []postableAlert{alert}})
+				if _, err := http.Post(webhook, ContentTypeJSON, strings.NewReader(string(b))); err != nil {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// newAlertmanagerTestClient returns a client finding the given fake Alertmanager on a ready pod of the VMI, after a
+// pod that is not ready and one that does not answer.
+func newAlertmanagerTestClient(t *testing.T, server *httptest.Server) *K8s {
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alertmanagerPort = serverURL.Port()
+	testclient := newTemplatesTestClient(t, vmiName, namespace, "vmi-"+vmiName+"-alertmanager-templates")
+	for _, pod := range []struct {
+		name  string
+		ip    string
+		ready bool
+	}{
+		{name: "alertmanager-0", ip: "127.0.0.1", ready: false},
+		{name: "alertmanager-1", ip: "127.0.0.2", ready: true},
+		{name: "alertmanager-2", ip: serverURL.Hostname(), ready: true},
+	} {
+		_, err := testclient.ClientSet.CoreV1().Pods(namespace).Create(context.TODO(), &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: pod.name, Namespace: namespace, Labels: map[string]string{"app": "vmi-" + vmiName + "-alertmanager"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "alertmanager"}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: pod.ip,
+				ContainerStatuses: []corev1.ContainerStatus{{Name: "alertmanager", Ready: pod.ready}}},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return testclient
+}
+
+func TestAlertmanagerAPIFailover(t *testing.T) {
+	vmiName = "vmi-alertmanager-api-test"
+	namespace = "vmi-alertmanager-api-test"
+	alertmanager := &fakeAlertmanager{}
+	server := httptest.NewServer(alertmanager)
+	defer server.Close()
+	testclient := newAlertmanagerTestClient(t, server)
+	defer func() { alertmanagerPort = "9093" }()
+
+	// The pod at 127.0.0.2, tried first, answers with the given status
+	listener, err := net.Listen("tcp", net.JoinHostPort("127.0.0.2", alertmanagerPort))
+	if err != nil {
+		t.Skipf("unable to listen on 127.0.0.2: %v", err)
+	}
+	status := http.StatusServiceUnavailable
+	failing := &httptest.Server{Listener: listener, Config: &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, `"failing pod"`)
+	})}}
+	failing.Start()
+	defer failing.Close()
+
+	// A server error goes on to the next pod
+	var silences []Silence
+	if err := testclient.alertmanagerAPI(zap.S(), "POST", "/api/v2/silences", nil, Silence{Comment: "test"}, nil); err != nil {
+		t.Fatalf("expected the next pod to be called after a server error, got %v", err)
+	}
+	if err := testclient.alertmanagerAPI(zap.S(), "GET", "/api/v2/silences", nil, nil, &silences); err != nil || len(silences) != 1 {
+		t.Fatalf("expected the silence from the next pod, got %v, %v", silences, err)
+	}
+
+	// A client error is returned at once
+	status = http.StatusBadRequest
+	err = testclient.alertmanagerAPI(zap.S(), "POST", "/api/v2/silences", nil, Silence{Comment: "test"}, nil)
+	if apiError, ok := err.(*AlertmanagerAPIError); !ok || apiError.Status != http.StatusBadRequest || apiError.Message != "failing pod" {
+		t.Errorf("expected the client error of the first pod, got %v", err)
+	}
+	if len(alertmanager.silences) != 1 {
+		t.Errorf("expected the next pod not to be called after a client error, got %d silences", len(alertmanager.silences))
+	}
+
+	// The server error is returned when no pod succeeds
+	status = http.StatusServiceUnavailable
+	server.Close()
+	err = testclient.alertmanagerAPI(zap.S(), "GET", "/api/v2/silences", nil, nil, &silences)
+	if apiError, ok := err.(*AlertmanagerAPIError); !ok || apiError.Status != http.StatusServiceUnavailable {
+		t.Errorf("expected the server error of the first pod, got %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/prometheus/alertmanager/template"
+)
+
+// ContentTypeHTML media type of previews of HTML templates
+const ContentTypeHTML = "text/html; charset=utf-8"
+
+// TemplatePreviewRequest previews a template definition against Data, or sample data of two firing alerts if not
+// given.  Template is the content of a template file not saved yet, replacing the saved File if given.
+type TemplatePreviewRequest struct {
+	Data     *template.Data `json:"data,omitempty"`
+	Template string         `json:"template,omitempty"`
+	File     string         `json:"file,omitempty"`
+}
+
+// sampleTemplateData returns the data notifications of a group of two firing InstanceDown alerts would be rendered
+// with.
+func sampleTemplateData(now time.Time) *template.Data {
+	alert := func(instance string) template.Alert {
+		return template.Alert{
+			Status: "firing",
+			Labels: template.KV{"alertname": "InstanceDown", "job": "node", "instance": instance, "severity": "critical"},
+			Annotations: template.KV{"summary": "Instance " + instance + " is down",
+				"description": instance + " of job node has been down for more than 5 minutes."},
+			StartsAt:     now.Add(-10 * time.Minute),
+			GeneratorURL: "http://vmi-" + vmiName + "-prometheus:9090/graph?g0.expr=up+%3D%3D+0",
+			Fingerprint:  strings.Replace(instance, ":", "", 1),
+		}
+	}
+	return &template.Data{
+		Receiver:          "preview",
+		Status:            "firing",
+		Alerts:            template.Alerts{alert("node-1:9100"), alert("node-2:9100")},
+		GroupLabels:       template.KV{"alertname": "InstanceDown"},
+		CommonLabels:      template.KV{"alertname": "InstanceDown", "job": "node", "severity": "critical"},
+		CommonAnnotations: template.KV{},
+		ExternalURL:       "http://vmi-" + vmiName + "-alertmanager:9093",
+	}
+}
+
+// loadAlertmanagerTemplates parses the default Alertmanager templates and the given template files, as Alertmanager
+// does with the templates of its configuration.
+func loadAlertmanagerTemplates(files map[string]string) (*template.Template, error) {
+	dir, err := ioutil.TempDir("", "alertmanager-templates")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	for fileName, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, fileName), []byte(content), 0600); err != nil {
+			return nil, err
+		}
+	}
+	return template.FromGlobs(filepath.Join(dir, "*"))
+}
+
+// renderTemplatePreview renders the template definition with the given name, as HTML if asked to, or text.
+func renderTemplatePreview(tmpl *template.Template, name string, data *template.Data, html bool) (string, error) {
+	text := `{{ template "` + name + `" . }}`
+	if html {
+		return tmpl.ExecuteHTMLString(text, data)
+	}
+	return tmpl.ExecuteTextString(text, data)
+}
+
+// PreviewAlertmanagerTemplate renders a template definition, such as slack.default.text, with the saved templates, and
+// an unsaved one if given, against the given or sample alerts.  Definitions named *.html, or ?format=html, are
+// rendered as HTML.
+func (k *K8s) PreviewAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(path.Dir(r.URL.Path))
+	r = withLogFields(r, "resource", name)
+	if err := ValidateConfigMapKeyName(name); err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: Invalid template name: "+err.Error())
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request TemplatePreviewRequest
+	if len(strings.TrimSpace(string(b))) > 0 {
+		if err := json.Unmarshal(b, &request); err != nil {
+			validationFailed(w, r, CodeInvalidJSON, "ERROR: Unable to parse the preview request: "+err.Error(), err.Error())
+			return
+		}
+	}
+	if request.Data == nil {
+		request.Data = sampleTemplateData(time.Now().UTC())
+	}
+
+	_, files, err := k.getConfigMapByPath(requestLogger(r), AlertmanagerTemplatesConfigMapPath)
+	if err != nil {
+		internalError(w, r, "Unable to read Alertmanager template ConfigMap: "+err.Error())
+		return
+	}
+	if files == nil {
+		files = make(map[string]string)
+	}
+	if request.Template != "" {
+		fileName := request.File
+		if fileName == "" {
+			fileName = "preview.tmpl"
+		}
+		if validateName(fileName) != nil || ValidateConfigMapKeyName(fileName) != nil || !strings.HasSuffix(fileName, ".tmpl") {
+			problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+fileName+", it should end with .tmpl")
+			return
+		}
+		files[fileName] = request.Template
+	}
+
+	tmpl, err := loadAlertmanagerTemplates(files)
+	if err != nil {
+		validationFailed(w, r, CodeInvalidTemplate, "ERROR: Unable to parse the templates: "+err.Error(), err.Error())
+		return
+	}
+	html := strings.HasSuffix(name, ".html") || r.URL.Query().Get("format") == "html"
+	rendered, err := renderTemplatePreview(tmpl, name, request.Data, html)
+	if err != nil {
+		if strings.Contains(err.Error(), `template "`+name+`" not defined`) {
+			problemError(w, r, http.StatusNotFound, CodeTemplateNotFound, "Unable to find a template definition called: "+name)
+			return
+		}
+		validationFailed(w, r, CodeInvalidTemplate, "ERROR: Unable to render the template: "+err.Error(), err.Error())
+		return
+	}
+	contentType := "text/plain; charset=utf-8"
+	if html {
+		contentType = ContentTypeHTML
+	}
+	w.Header().Set("Content-Type", contentType)
+	successBytes(w, r, []byte(rendered))
+}
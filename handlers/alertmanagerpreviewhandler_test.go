@@ -0,0 +1,105 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRenderTemplatePreview(t *testing.T) {
+	tmpl, err := loadAlertmanagerTemplates(map[string]string{
+		"myorg.tmpl": `{{ define "slack.myorg.text" }}{{ range .Alerts.Firing }}{{ .Labels.instance }} {{ end }}{{ end }}`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := sampleTemplateData(time.Now())
+
+	rendered, err := renderTemplatePreview(tmpl, "slack.myorg.text", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered != "node-1:9100 node-2:9100 " {
+		t.Errorf("unexpected rendering: %q", rendered)
+	}
+
+	// The default templates of Alertmanager are there too
+	rendered, err = renderTemplatePreview(tmpl, "slack.default.title", data, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, "[FIRING:2] InstanceDown") {
+		t.Errorf("unexpected rendering: %q", rendered)
+	}
+	rendered, err = renderTemplatePreview(tmpl, "email.default.html", data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(rendered, "<html") || !strings.Contains(rendered, "node-2:9100") {
+		t.Errorf("unexpected rendering: %q", rendered)
+	}
+
+	if _, err := renderTemplatePreview(tmpl, "slack.unknown.text", data, false); err == nil {
+		t.Error("expected an error rendering an unknown template")
+	}
+	if _, err := loadAlertmanagerTemplates(map[string]string{"broken.tmpl": `{{ define "x" }}{{ .Alerts`}); err == nil {
+		t.Error("expected an error parsing an invalid template")
+	}
+}
+
+func TestPreviewAlertmanagerTemplate(t *testing.T) {
+	vmiName = "vmi-template-preview-test"
+	namespace = "vmi-template-preview-test"
+	testclient := newTemplatesTestClient(t, vmiName, namespace, "vmi-"+vmiName+"-alertmanager-templates")
+	req, err := http.NewRequest("PUT", "/alertmanager/templates/myorg.tmpl",
+		strings.NewReader(`{{ define "slack.myorg.text" }}{{ .CommonLabels.job }} is {{ .Status }}{{ end }}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.PutAlertmanagerTemplate).ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusAccepted)
+
+	preview := func(url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testclient.PreviewAlertmanagerTemplate).ServeHTTP(rr, req)
+		return rr
+	}
+
+	/* *** Saved template, sample alerts *** */
+	rr = preview("/alertmanager/templates/slack.myorg.text/preview", "")
+	verify(t, rr, http.StatusOK, "node is firing")
+
+	/* *** Given alerts *** */
+	rr = preview("/alertmanager/templates/slack.myorg.text/preview", `{"data": {"status": "resolved", "commonLabels": {"job": "api"}}}`)
+	verify(t, rr, http.StatusOK, "api is resolved")
+
+	/* *** Unsaved change of the template *** */
+	rr = preview("/alertmanager/templates/slack.myorg.text/preview",
+		`{"file": "myorg.tmpl", "template": "{{ define \"slack.myorg.text\" }}{{ len .Alerts }} alerts{{ end }}"}`)
+	verify(t, rr, http.StatusOK, "2 alerts")
+
+	/* *** HTML *** */
+	rr = preview("/alertmanager/templates/email.default.html/preview", "")
+	verify(t, rr, http.StatusOK, "InstanceDown")
+	if rr.Header().Get("Content-Type") != ContentTypeHTML {
+		t.Errorf("expected HTML, got %s", rr.Header().Get("Content-Type"))
+	}
+
+	/* *** Errors *** */
+	rr = preview("/alertmanager/templates/slack.other.text/preview", "")
+	verify(t, rr, http.StatusNotFound, "Unable to find a template definition called: slack.other.text")
+	rr = preview("/alertmanager/templates/slack.myorg.text/preview", `{"template": "{{ define \"x\" }}{{ .Alerts"}`)
+	verify(t, rr, http.StatusBadRequest, "Unable to parse the templates")
+	rr = preview("/alertmanager/templates/slack.myorg.text/preview", `{"file": "myorg.txt", "template": "x"}`)
+	verifyStatus(t, rr, http.StatusBadRequest)
+}
@@ -15,9 +15,9 @@ import (
 // GetAllAlertmanagerTemplatesFileNames returns all Alert Manager template files.
 func (k *K8s) GetAllAlertmanagerTemplatesFileNames(w http.ResponseWriter, r *http.Request) {
 
-	_, configMap, err := k.getConfigMapByPath(AlertmanagerTemplatesConfigMapPath)
+	_, configMap, err := k.getConfigMapByPath(requestLogger(r), AlertmanagerTemplatesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read Alertmanager template ConfigMap: %v", err))
+		internalError(w, r, fmt.Sprintf("Unable to read Alertmanager template ConfigMap: %v", err))
 		return
 	}
 
@@ -28,15 +28,16 @@ func (k *K8s) GetAllAlertmanagerTemplatesFileNames(w http.ResponseWriter, r *htt
 		i++
 	}
 	sort.Strings(templateNames)
-	success(w, strings.Join(templateNames, "\n"))
+	success(w, r, strings.Join(templateNames, "\n"))
 }
 
 // GetAlertmanagerTemplate returns a requested Alert Manager template file.
 func (k *K8s) GetAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 	fileName := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", fileName)
 	err := validateName(fileName)
 	if err != nil {
-		badRequest(w, "ERROR: Invalid File Name: "+err.Error())
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+err.Error())
 		return
 	}
 
@@ -44,30 +45,31 @@ func (k *K8s) GetAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 	amTemplateMapName := vmi.Path(AlertmanagerTemplatesConfigMapPath).Data().(string)
 	templatesMap, e := k.getConfigMapByName(amTemplateMapName)
 	if e != nil {
-		internalError(w, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
+		internalError(w, r, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
 		return
 	}
 	if e != nil {
-		internalError(w, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
+		internalError(w, r, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
 		return
 	}
 
 	for k, v := range templatesMap {
 		if k == fileName {
-			log(LevelDebug, "%s", "Found existing file in Map: "+amTemplateMapName+", "+fileName)
-			success(w, v)
+			requestLogger(r).Debug("Found existing file in Map: " + amTemplateMapName + ", " + fileName)
+			success(w, r, v)
 			return
 		}
 	}
-	badRequest(w, "Did not find any template with name: "+amTemplateMapName+", "+fileName)
+	problemError(w, r, http.StatusBadRequest, CodeTemplateNotFound, "Did not find any template with name: "+amTemplateMapName+", "+fileName)
 }
 
 // DeleteAlertmanagerTemplate deletes a requested Alert Manager template file.
 func (k *K8s) DeleteAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 	fileName := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", fileName)
 	err := validateName(fileName)
 	if err != nil {
-		badRequest(w, "ERROR: Invalid File Name: "+err.Error())
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+err.Error())
 		return
 	}
 
@@ -75,73 +77,74 @@ func (k *K8s) DeleteAlertmanagerTemplate(w http.ResponseWriter, r *http.Request)
 	amTemplateMapName := vmi.Path(AlertmanagerTemplatesConfigMapPath).Data().(string)
 	templatesMap, e := k.getConfigMapByName(amTemplateMapName)
 	if e != nil {
-		internalError(w, "Unable to read ConfigMap: "+e.Error())
+		internalError(w, r, "Unable to read ConfigMap: "+e.Error())
 		return
 	}
 
 	for j := range templatesMap {
 		if j == fileName {
-			log(LevelDebug, "%s", "Found existing file in Map: "+fileName)
+			requestLogger(r).Debug("Found existing file in Map: " + fileName)
 			delete(templatesMap, j)
-			e = k.updateConfigMapByName(templatesMap, amTemplateMapName)
+			e = k.updateConfigMapByName(requestLogger(r), templatesMap, amTemplateMapName)
 			if e != nil {
-				internalError(w, "Unable to update ConfigMap: "+e.Error())
+				internalError(w, r, "Unable to update ConfigMap: "+e.Error())
 				return
 			}
 			// returning HTTP status "202: Accepted".
 			// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
 			// before the response is sent.  I.e. a client might send a DELETE request to delete a template, receive a 200 response,
 			// and quickly send a GET request for the list of all templates, and receive a response that still includes the template.
-			accepted(w, "Deleting template file: "+amTemplateMapName+", "+fileName)
+			accepted(w, r, "Deleting template file: "+amTemplateMapName+", "+fileName)
 			return
 		}
 	}
-	badRequest(w, "Did not find any template to delete with name: "+fileName)
+	problemError(w, r, http.StatusBadRequest, CodeTemplateNotFound, "Did not find any template to delete with name: "+fileName)
 }
 
 // PutAlertmanagerTemplate adds a requested Alert Manager template file.
 func (k *K8s) PutAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 	b, e := ioutil.ReadAll(r.Body)
 	if e != nil {
-		internalError(w, "ERROR: Unable to read request Body: "+e.Error())
+		internalError(w, r, "ERROR: Unable to read request Body: "+e.Error())
 		return
 	}
 	fileName := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", fileName)
 	if fileName == "" {
-		badRequest(w, "ERROR: Did not pass mandatory parameter filename, Please pass /v1/alertmanager/addtemplate?filename=<name.templates>")
+		badRequest(w, r, "ERROR: Did not pass mandatory parameter filename, Please pass /v1/alertmanager/addtemplate?filename=<name.templates>")
 		return
 	}
 
 	e = validateName(fileName)
 	if e != nil {
-		badRequest(w, "ERROR: Invalid File Name: "+e.Error())
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+e.Error())
 		return
 	}
 
 	if !strings.HasSuffix(fileName, ".tmpl") {
-		badRequest(w, "ERROR: Filename should end with .tmpl only")
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Filename should end with .tmpl only")
 		return
 	}
 
 	vmi, e := k.getVMIJson()
 	if e != nil {
-		internalError(w, "Unable to GET Verrazzano Monitoring Instance: "+e.Error())
+		internalError(w, r, "Unable to GET Verrazzano Monitoring Instance: "+e.Error())
 		return
 	}
 
 	amTemplateMapName := vmi.Path(AlertmanagerTemplatesConfigMapPath).Data().(string)
 	templatesMap, e := k.getConfigMapByName(amTemplateMapName)
 	if e != nil {
-		internalError(w, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
+		internalError(w, r, "Unable to read ConfigMap: "+amTemplateMapName+", "+e.Error())
 		return
 	}
 	for j := range templatesMap {
 		if j == fileName {
-			log(LevelDebug, "%s", "Found existing file in Map: "+fileName)
+			requestLogger(r).Debug("Found existing file in Map: " + fileName)
 			templatesMap[j] = string(b)
-			e = k.updateConfigMapByName(templatesMap, amTemplateMapName)
+			e = k.updateConfigMapByName(requestLogger(r), templatesMap, amTemplateMapName)
 			if e != nil {
-				internalError(w, "Unable to update ConfigMap: "+amTemplateMapName+", "+e.Error())
+				internalError(w, r, "Unable to update ConfigMap: "+amTemplateMapName+", "+e.Error())
 				return
 			}
 			// returning HTTP status "202: Accepted".
@@ -149,7 +152,7 @@ func (k *K8s) PutAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 			// before the response is sent.  I.e. a client might send a PUT request to create or update a template, receive a 200
 			// response, and quickly send a GET request for that template but receive a 404 in the case of a new template, or 200 with
 			// the previous version in the case of an existing template.
-			accepted(w, "Updating existing template in Map: "+amTemplateMapName+", "+fileName)
+			accepted(w, r, "Updating existing template in Map: "+amTemplateMapName+", "+fileName)
 			return
 		}
 	}
@@ -165,12 +168,12 @@ func (k *K8s) PutAlertmanagerTemplate(w http.ResponseWriter, r *http.Request) {
 		templatesMap[newKey] = newValue
 	}
 
-	e = k.updateConfigMapByName(templatesMap, amTemplateMapName)
+	e = k.updateConfigMapByName(requestLogger(r), templatesMap, amTemplateMapName)
 	if e != nil {
-		internalError(w, "Unable to update ConfigMap: "+amTemplateMapName+", "+e.Error())
+		internalError(w, r, "Unable to update ConfigMap: "+amTemplateMapName+", "+e.Error())
 		return
 	}
 	// returning HTTP status "202: Accepted".
-	accepted(w, "Adding new template file name: "+amTemplateMapName+", "+fileName)
+	accepted(w, r, "Adding new template file name: "+amTemplateMapName+", "+fileName)
 
 }
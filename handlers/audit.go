@@ -0,0 +1,274 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Maximum number of bytes of the response body kept as the message of an audit record.
+const maxAuditMessageLength = 512
+
+// These can be set from the command line via -auditLogFile, -auditEvents and -trustedProxies
+var (
+	auditLog       io.Writer = os.Stdout
+	auditLogMutex  sync.Mutex
+	auditEvents    bool
+	trustedProxies []*net.IPNet
+)
+
+type auditContextKey struct{}
+
+// AuditRecord describes a single mutating API call.  Records are written to the audit log as JSON lines.  Caller is
+// the authenticated user, Author the author claimed by the client via X-Change-Author or ?author=, if any.
+type AuditRecord struct {
+	Timestamp string `json:"@timestamp"`
+	Method    string `json:"method"`
+	Resource  string `json:"resource"`
+	Caller    string `json:"caller,omitempty"`
+	Author    string `json:"author,omitempty"`
+	Comment   string `json:"comment,omitempty"`
+	Ticket    string `json:"ticket,omitempty"`
+	SourceIP  string `json:"sourceIP,omitempty"`
+	OldHash   string `json:"oldHash,omitempty"`
+	NewHash   string `json:"newHash,omitempty"`
+	Status    int    `json:"status"`
+	Result    string `json:"result"`
+	Message   string `json:"message,omitempty"`
+	RequestID string `json:"requestID,omitempty"`
+}
+
+// auditResponseWriter captures the status and the start of the body written by a handler.
+type auditResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (a *auditResponseWriter) WriteHeader(status int) {
+	if a.status == 0 {
+		a.status = status
+	}
+	a.ResponseWriter.WriteHeader(status)
+}
+
+func (a *auditResponseWriter) Write(b []byte) (int, error) {
+	if a.status == 0 {
+		a.status = http.StatusOK
+	}
+	if room := maxAuditMessageLength - len(a.body); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+		a.body = append(a.body, b[:room]...)
+	}
+	return a.ResponseWriter.Write(b)
+}
+
+// audited wraps a mutating handler, so that every call is recorded in the audit log, and optionally as a Kubernetes
+// Event on the VMI.  Handlers add the hashes of the old and new content via setAuditContent.
+func (k *K8s) audited(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		metadata := getChangeMetadata(r)
+		record := &AuditRecord{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Method:    r.Method,
+			Resource:  r.URL.Path,
+			Caller:    authenticatedUser(r),
+			Author:    metadata.Author,
+			Comment:   metadata.Comment,
+			Ticket:    metadata.Ticket,
+			SourceIP:  sourceIP(r),
+			RequestID: requestID(r),
+		}
+		aw := &auditResponseWriter{ResponseWriter: w}
+		next(aw, r.WithContext(context.WithValue(r.Context(), auditContextKey{}, record)))
+
+		record.Status = aw.status
+		if record.Status == 0 {
+			record.Status = http.StatusOK
+		}
+		record.Result = "success"
+		if record.Status >= http.StatusBadRequest {
+			record.Result = "failure"
+		}
+		record.Message = strings.TrimSpace(string(aw.body))
+		k.writeAuditRecord(record)
+	}
+}
+
+// setAuditContent records the content of the resource before and after a change, if the request is being audited.
+// An empty string means the resource did not exist before, or no longer exists after, the change.
+func setAuditContent(r *http.Request, oldContent string, newContent string) {
+	record, ok := r.Context().Value(auditContextKey{}).(*AuditRecord)
+	if !ok {
+		return
+	}
+	record.OldHash = contentHash(oldContent)
+	record.NewHash = contentHash(newContent)
+}
+
+func contentHash(content string) string {
+	if content == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// sourceIP returns the address of the client.  The address forwarded in X-Forwarded-For or X-Real-IP is only taken
+// from a proxy given by -trustedProxies, as any client can send these headers: the hops of X-Forwarded-For are read
+// from the right, the one before the last trusted proxy being the client.
+func sourceIP(r *http.Request) string {
+	remote, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		remote = r.RemoteAddr
+	}
+	if !isTrustedProxy(remote) {
+		return remote
+	}
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			if hop := strings.TrimSpace(hops[i]); hop != "" && (i == 0 || !isTrustedProxy(hop)) {
+				return hop
+			}
+		}
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" {
+		return realIP
+	}
+	return remote
+}
+
+// isTrustedProxy returns whether the given address is that of a proxy given by -trustedProxies.
+func isTrustedProxy(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, proxies := range trustedProxies {
+		if proxies.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTrustedProxies parses the comma-separated IP addresses and CIDR ranges of -trustedProxies.
+func parseTrustedProxies(s string) ([]*net.IPNet, error) {
+	var proxies []*net.IPNet
+	for _, proxy := range strings.Split(s, ",") {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			proxies = append(proxies, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy: %s", proxy)
+		}
+		proxies = append(proxies, ipNet)
+	}
+	return proxies, nil
+}
+
+func (k *K8s) writeAuditRecord(record *AuditRecord) {
+	b, err := json.Marshal(record)
+	if err != nil {
+		zap.S().Errorf("Unable to marshal audit record: %v", err)
+		return
+	}
+	auditLogMutex.Lock()
+	_, err = auditLog.Write(append(b, '\n'))
+	auditLogMutex.Unlock()
+	if err != nil {
+		zap.S().Errorf("Unable to write audit record: %v", err)
+	}
+
+	if auditEvents {
+		if err := k.createAuditEvent(record); err != nil {
+			zap.S().Errorf("Unable to create audit Event: %v", err)
+		}
+	}
+}
+
+// createAuditEvent records the change as an Event on the VMI, so that it shows up in `kubectl describe vmi`.
+func (k *K8s) createAuditEvent(record *AuditRecord) error {
+	vmi, err := k.getVMIJson()
+	if err != nil {
+		return err
+	}
+	uid, _ := vmi.Path("metadata.uid").Data().(string)
+
+	reason := "MonitoringConfigChanged"
+	eventType := corev1.EventTypeNormal
+	if record.Result != "success" {
+		reason = "MonitoringConfigChangeFailed"
+		eventType = corev1.EventTypeWarning
+	}
+	caller := record.Caller
+	if caller == "" {
+		caller = "unknown"
+	}
+	if record.Author != "" && record.Author != record.Caller {
+		caller += " (as " + record.Author + ")"
+	}
+	message := fmt.Sprintf("%s %s by %s from %s: %d %s", record.Method, record.Resource, caller, record.SourceIP,
+		record.Status, record.Message)
+	if record.Comment != "" {
+		message += " (" + record.Comment + ")"
+	}
+
+	now := metav1.Now()
+	event := &corev1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: vmiName + ".",
+			Namespace:    namespace,
+		},
+		InvolvedObject: corev1.ObjectReference{
+			APIVersion: VMIGroup + "/" + VMIVersion,
+			Kind:       VMIKind,
+			Name:       vmiName,
+			Namespace:  namespace,
+			UID:        types.UID(uid),
+		},
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         corev1.EventSource{Component: EventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+	_, err = k.ClientSet.CoreV1().Events(namespace).Create(context.TODO(), event, metav1.CreateOptions{})
+	return err
+}
@@ -0,0 +1,161 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestAuditedHandler(t *testing.T) {
+	vmiName = "vmi-audit-test"
+	namespace = "vmi-audit-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	var buffer bytes.Buffer
+	auditLog = &buffer
+	auditEvents = true
+	trustedProxies, _ = parseTrustedProxies("10.0.0.2")
+	defer func() {
+		auditLog = os.Stdout
+		auditEvents = false
+		trustedProxies = nil
+	}()
+
+	handler := testclient.audited(func(w http.ResponseWriter, r *http.Request) {
+		setAuditContent(r, "old", "new")
+		accepted(w, r, "The Prometheus configuration is being updated.")
+	})
+
+	req, err := http.NewRequest("PUT", "/prometheus/config?comment=more+targets&author=admin", strings.NewReader("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "10.0.0.2:41000"
+	req.Header.Set("X-Forwarded-For", "10.0.0.1")
+	req.SetBasicAuth("jdoe", "secret")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	// One JSON line per call
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 audit record, got %d: %s", len(lines), buffer.String())
+	}
+	var record AuditRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Method != "PUT" || record.Resource != "/prometheus/config" || record.Caller != "jdoe" ||
+		record.Author != "admin" || record.Comment != "more targets" || record.SourceIP != "10.0.0.1" {
+		t.Errorf("unexpected audit record: %+v", record)
+	}
+	if record.Status != http.StatusAccepted || record.Result != "success" ||
+		record.Message != "The Prometheus configuration is being updated." {
+		t.Errorf("unexpected audit result: %+v", record)
+	}
+	if record.OldHash != contentHash("old") || record.NewHash != contentHash("new") || record.OldHash == record.NewHash {
+		t.Errorf("unexpected audit hashes: %+v", record)
+	}
+
+	// And a matching Event on the VMI
+	events, err := testclient.ClientSet.CoreV1().Events(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Items) != 1 {
+		t.Fatalf("expected 1 Event, got %d", len(events.Items))
+	}
+	event := events.Items[0]
+	if event.InvolvedObject.Kind != VMIKind || event.InvolvedObject.Name != vmiName || event.Type != corev1.EventTypeNormal {
+		t.Errorf("unexpected Event: %+v", event)
+	}
+	if !strings.Contains(event.Message, "PUT /prometheus/config by jdoe (as admin)") {
+		t.Errorf("unexpected Event message: %s", event.Message)
+	}
+}
+
+func TestAuditedHandlerFailure(t *testing.T) {
+	vmiName = "vmi-audit-test"
+	namespace = "vmi-audit-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	var buffer bytes.Buffer
+	auditLog = &buffer
+	defer func() { auditLog = os.Stdout }()
+
+	handler := testclient.audited(func(w http.ResponseWriter, r *http.Request) {
+		badRequest(w, r, "ERROR: File name must end with: .rules")
+	})
+	req, err := http.NewRequest("DELETE", "/prometheus/rules/foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.RemoteAddr = "192.168.1.5:41234"
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	var record AuditRecord
+	if err := json.Unmarshal(buffer.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.Status != http.StatusBadRequest || record.Result != "failure" || record.SourceIP != "192.168.1.5" {
+		t.Errorf("unexpected audit record: %+v", record)
+	}
+	if record.OldHash != "" || record.NewHash != "" {
+		t.Errorf("expected no content hashes: %+v", record)
+	}
+}
+
+func TestSourceIP(t *testing.T) {
+	var err error
+	trustedProxies, err = parseTrustedProxies("10.0.0.2, 10.1.0.0/16")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { trustedProxies = nil }()
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		realIP     string
+		expected   string
+	}{
+		{name: "direct client", remoteAddr: "192.0.2.1:41000", expected: "192.0.2.1"},
+		{name: "untrusted peer", remoteAddr: "192.0.2.1:41000", forwarded: "10.0.0.1", realIP: "10.0.0.1", expected: "192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.2:41000", forwarded: "10.0.0.1", expected: "10.0.0.1"},
+		{name: "spoofed hop", remoteAddr: "10.0.0.2:41000", forwarded: "1.2.3.4, 10.0.0.1", expected: "10.0.0.1"},
+		{name: "trusted hops", remoteAddr: "10.0.0.2:41000", forwarded: "10.0.0.1, 10.1.2.3", expected: "10.0.0.1"},
+		{name: "real IP", remoteAddr: "10.1.0.1:41000", realIP: "10.0.0.1", expected: "10.0.0.1"},
+		{name: "no header", remoteAddr: "10.0.0.2:41000", expected: "10.0.0.2"},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("PUT", "/prometheus/config", nil)
+		req.RemoteAddr = test.remoteAddr
+		if test.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if test.realIP != "" {
+			req.Header.Set("X-Real-IP", test.realIP)
+		}
+		if ip := sourceIP(req); ip != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, ip)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.2, proxy"); err == nil {
+		t.Error("expected an error for an invalid trusted proxy")
+	}
+}
@@ -0,0 +1,388 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"sigs.k8s.io/yaml"
+)
+
+// Header of the rules files generated for a canary, holding its definition
+const canaryDefinitionPrefix = "# Canary definition: "
+
+// Defaults of a canary
+const (
+	defaultCanaryMethod   = "GET"
+	defaultCanaryStatus   = 200
+	defaultCanaryInterval = "1m"
+)
+
+// This can be set from the command line via -blackboxExporterAddress.  It defaults to the blackbox exporter service of
+// the VMI.
+var blackboxExporterAddress string
+
+var canaryMethods = []string{"GET", "HEAD", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"}
+
+var (
+	errCanaryURL      = errors.New("the url must be an absolute http or https URL")
+	errCanaryStatus   = errors.New("the expected status must be an HTTP status code, between 100 and 599")
+	errCanaryInterval = errors.New("the interval must be at least 5s")
+)
+
+// Canary is a synthetic HTTP check: the blackbox exporter sends a Method request to URL every Interval, and the
+// CanaryDown alert fires when it does not get ExpectedStatus back.  Labels and Annotations are added to the alert,
+// Annotations replacing the generated summary and description.
+type Canary struct {
+	URL            string            `json:"url"`
+	Method         string            `json:"method,omitempty"`
+	ExpectedStatus int               `json:"expectedStatus,omitempty"`
+	Interval       string            `json:"interval,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Annotations    map[string]string `json:"annotations,omitempty"`
+}
+
+// getBlackboxExporterAddress returns the host:port of the blackbox exporter probing the canaries.
+func getBlackboxExporterAddress() string {
+	if blackboxExporterAddress != "" {
+		return blackboxExporterAddress
+	}
+	return "vmi-" + vmiName + "-blackbox-exporter:9115"
+}
+
+// canaryRulesFileName returns the name of the rules file generated for a canary.
+func canaryRulesFileName(name string) string {
+	return "canary-" + name + ".rules"
+}
+
+// canaryJobName returns the name of the scrape job of prometheus.yml probing a canary.
+func canaryJobName(name string) string {
+	return "canary-" + name
+}
+
+// canaryAlertName returns the name of the CanaryDown alert of a canary, unique across canaries, e.g. CanaryDown_api.
+func canaryAlertName(name string) string {
+	return "CanaryDown_" + alertNamePart(name)
+}
+
+// canaryModule returns the blackbox exporter module sending requests with the given method, e.g. http_get.
+func canaryModule(method string) string {
+	return "http_" + strings.ToLower(method)
+}
+
+// validateCanary checks a canary definition, and sets its defaults.
+func validateCanary(canary *Canary) (model.Duration, error) {
+	u, err := url.Parse(canary.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return 0, errCanaryURL
+	}
+	if canary.Method == "" {
+		canary.Method = defaultCanaryMethod
+	}
+	canary.Method = strings.ToUpper(canary.Method)
+	if !containsString(canaryMethods, canary.Method) {
+		return 0, fmt.Errorf("invalid method: %s, must be one of %s", canary.Method, strings.Join(canaryMethods, ", "))
+	}
+	if canary.ExpectedStatus == 0 {
+		canary.ExpectedStatus = defaultCanaryStatus
+	}
+	if canary.ExpectedStatus < 100 || canary.ExpectedStatus > 599 {
+		return 0, errCanaryStatus
+	}
+	if canary.Interval == "" {
+		canary.Interval = defaultCanaryInterval
+	}
+	interval, err := model.ParseDuration(canary.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid interval: %v", err)
+	}
+	if interval < model.Duration(5*time.Second) {
+		return 0, errCanaryInterval
+	}
+	for name := range canary.Labels {
+		if !model.LabelName(name).IsValid() {
+			return 0, fmt.Errorf("invalid label name: %s", name)
+		}
+	}
+	for name := range canary.Annotations {
+		if !model.LabelName(name).IsValid() {
+			return 0, fmt.Errorf("invalid annotation name: %s", name)
+		}
+	}
+	return interval, nil
+}
+
+// canaryScrapeConfig returns the scrape job probing a canary through the blackbox exporter, as in its documentation:
+// the URL becomes the target parameter of the /probe endpoint, and the instance label.
+func canaryScrapeConfig(name string, canary *Canary, interval model.Duration) map[string]interface{} {
+	// Probes must end before the next one starts
+	timeout := model.Duration(10 * time.Second)
+	if interval < timeout {
+		timeout = interval
+	}
+	return map[string]interface{}{
+		"job_name":        canaryJobName(name),
+		"metrics_path":    "/probe",
+		"scrape_interval": interval.String(),
+		"scrape_timeout":  timeout.String(),
+		"params": map[string]interface{}{
+			"module": []interface{}{canaryModule(canary.Method)},
+		},
+		"static_configs": []interface{}{
+			map[string]interface{}{
+				"targets": []interface{}{canary.URL},
+				"labels":  map[string]interface{}{"canary": name},
+			},
+		},
+		"relabel_configs": []interface{}{
+			map[string]interface{}{"source_labels": []interface{}{"__address__"}, "target_label": "__param_target"},
+			map[string]interface{}{"source_labels": []interface{}{"__param_target"}, "target_label": "instance"},
+			map[string]interface{}{"target_label": "__address__", "replacement": getBlackboxExporterAddress()},
+		},
+	}
+}
+
+// canaryRuleFile generates the CanaryDown alert of a canary, firing when its probes fail to be scraped, or get another
+// status than the expected one, for two intervals.
+func canaryRuleFile(name string, canary *Canary, interval model.Duration) *RuleFile {
+	selector := `{job="` + canaryJobName(name) + `"}`
+	status := strconv.Itoa(canary.ExpectedStatus)
+	labels := map[string]string{}
+	for key, value := range canary.Labels {
+		labels[key] = value
+	}
+	labels["canary"] = name
+	labels["severity"] = "critical"
+	forDuration := model.Duration(2 * time.Duration(interval)).String()
+	annotations := map[string]string{
+		"summary":     "Canary " + name + " is down",
+		"description": canary.Method + " " + canary.URL + " has not returned " + status + " for " + forDuration + ".",
+	}
+	for key, value := range canary.Annotations {
+		annotations[key] = value
+	}
+	return &RuleFile{Groups: []RuleGroup{{
+		Name: canaryJobName(name),
+		Rules: []Rule{{
+			Alert:       canaryAlertName(name),
+			Expr:        "up" + selector + " == 0 or probe_http_status_code" + selector + " != " + status,
+			For:         forDuration,
+			Labels:      labels,
+			Annotations: annotations,
+		}},
+	}}}
+}
+
+// generateCanaryRules returns the rules file of a canary, starting with its definition.
+func generateCanaryRules(name string, canary *Canary, interval model.Duration) ([]byte, error) {
+	definition, err := json.Marshal(canary)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := yaml.Marshal(canaryRuleFile(name, canary, interval))
+	if err != nil {
+		return nil, err
+	}
+	header := canaryDefinitionPrefix + string(definition) + "\n# Generated from PUT /canaries/" + name + ", changes made here are lost when it is updated.\n"
+	return append([]byte(header), rules...), nil
+}
+
+// canaryDefinition returns the definition of the canary a rules file was generated for, nil if it was not.
+func canaryDefinition(content string) *Canary {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), canaryDefinitionPrefix) {
+		return nil
+	}
+	var canary Canary
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), canaryDefinitionPrefix)), &canary); err != nil {
+		return nil
+	}
+	return &canary
+}
+
+// setScrapeJob replaces the scrape job of prometheus.yml with the given name, adding it if there is none, or removes
+// it if job is nil.  The rest of prometheus.yml is left as it is, comments included.  It returns the new prometheus.yml,
+// and whether the job was there.
+func setScrapeJob(content string, jobName string, job map[string]interface{}) ([]byte, bool, error) {
+	// A nil map is not a nil item
+	if job == nil {
+		return setPrometheusConfigListItem(content, "scrape_configs", "job_name", jobName, nil)
+	}
+	return setPrometheusConfigListItem(content, "scrape_configs", "job_name", jobName, job)
+}
+
+// saveCanaryJob replaces the scrape job of a canary in prometheus.yml, or removes it if job is nil.  It returns the
+// problem saving prometheus.yml, if any.
+func (k *K8s) saveCanaryJob(r *http.Request, name string, job map[string]interface{}) *Problem {
+	content, err := k.getPrometheusConfigYAML(requestLogger(r))
+	if err != nil {
+		return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err)}
+	}
+	b, found, err := setScrapeJob(content, canaryJobName(name), job)
+	if err != nil {
+		return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: "Unable to update the " + canaryJobName(name) + " scrape job: " + err.Error()}
+	}
+	if !found && job == nil {
+		return nil
+	}
+	_, problem := k.replacePrometheusConfig(r, b)
+	return problem
+}
+
+// validateCanaryName checks the name of a canary, and writes a 400 response if it is invalid.
+func validateCanaryName(w http.ResponseWriter, r *http.Request, name string) bool {
+	if validateName(name) != nil || ValidateConfigMapKeyName(canaryRulesFileName(name)) != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: The canary name provided is invalid.")
+		return false
+	}
+	return true
+}
+
+// GetCanaryNames returns the names of all canaries.
+func (k *K8s) GetCanaryNames(w http.ResponseWriter, r *http.Request) {
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	names := make([]string, 0)
+	for fileName, content := range currentConfigMap {
+		if strings.HasPrefix(fileName, "canary-") && canaryDefinition(content) != nil {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(fileName, "canary-"), ".rules"))
+		}
+	}
+	sort.Strings(names)
+	successJSON(w, r, map[string][]string{"canaries": names})
+}
+
+// GetCanary returns the definition of a canary.
+func (k *K8s) GetCanary(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateCanaryName(w, r, name) {
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	canary := canaryDefinition(currentConfigMap[canaryRulesFileName(name)])
+	if canary == nil {
+		problemError(w, r, http.StatusNotFound, CodeCanaryNotFound, "Unable to find a canary called: "+name)
+		return
+	}
+	successJSON(w, r, canary)
+}
+
+// PutCanary creates or updates a canary: its scrape job in prometheus.yml, and its CanaryDown alert in the
+// canary-{name}.rules file, saved as with PUT /prometheus/rules/{name}.
+func (k *K8s) PutCanary(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateCanaryName(w, r, name) {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var canary Canary
+	if err := yaml.UnmarshalStrict(b, &canary); err != nil {
+		validationFailed(w, r, CodeInvalidCanary, "ERROR: Unable to parse the canary: "+err.Error(), err.Error())
+		return
+	}
+	interval, err := validateCanary(&canary)
+	if err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidCanary, "ERROR: Invalid canary: "+err.Error())
+		return
+	}
+	rules, err := generateCanaryRules(name, &canary, interval)
+	if err != nil {
+		internalError(w, r, "Unable to generate the rules of the canary: "+err.Error())
+		return
+	}
+	// Check the alert, against the lint policy and the other rules files too, before the scrape job is saved, so a
+	// rejected canary changes nothing
+	fileName := canaryRulesFileName(name)
+	if problem := checkPrometheusRuleFile(r, rules); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	if _, problem := k.checkRuleFileAgainstOthers(r, fileName, rules, currentConfigMap); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	previous := canaryDefinition(currentConfigMap[fileName])
+	if problem := k.saveCanaryJob(r, name, canaryScrapeConfig(name, &canary, interval)); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	if !k.savePrometheusRules(w, r, fileName, rules) {
+		k.restoreCanaryJob(r, name, previous)
+	}
+}
+
+// restoreCanaryJob puts back the scrape job of the previous definition of a canary, or removes the job if the canary
+// did not exist, after its rules could not be saved or deleted.
+func (k *K8s) restoreCanaryJob(r *http.Request, name string, previous *Canary) {
+	var job map[string]interface{}
+	if previous != nil {
+		interval, err := validateCanary(previous)
+		if err != nil {
+			requestLogger(r).Errorw("Unable to restore the scrape job of the canary", "error", err)
+			return
+		}
+		job = canaryScrapeConfig(name, previous, interval)
+	}
+	if problem := k.saveCanaryJob(r, name, job); problem != nil {
+		requestLogger(r).Errorw("Unable to restore the scrape job of the canary", "error", problem.Detail)
+	}
+}
+
+// DeleteCanary deletes a canary: its scrape job, and the rules file generated for it.
+func (k *K8s) DeleteCanary(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateCanaryName(w, r, name) {
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	previous := canaryDefinition(currentConfigMap[canaryRulesFileName(name)])
+	if previous == nil {
+		problemError(w, r, http.StatusNotFound, CodeCanaryNotFound, "No action taken. Unable to find a canary called: "+name)
+		return
+	}
+	if problem := k.saveCanaryJob(r, name, nil); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	if !k.deletePrometheusRules(w, r, canaryRulesFileName(name)) {
+		k.restoreCanaryJob(r, name, previous)
+	}
+}
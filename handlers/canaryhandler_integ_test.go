@@ -0,0 +1,162 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// newCanaryTestClient returns a test client of a VMI with both a Prometheus configuration and rules.
+func newCanaryTestClient(t *testing.T, vmiName string, namespace string) *K8s {
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	rulesConfigName := "vmi-" + vmiName + "-prometheus-rules"
+	for _, name := range []string{rulesConfigName, rulesConfigName + "-versions"} {
+		if _, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(),
+			createEmptyTestConfigMap(name, namespace), metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fakeVMIJson := gabs.New()
+	fakeVMIJson.SetP(fmt.Sprintf("%s/%s", VMIGroup, VMIVersion), "apiVersion")
+	fakeVMIJson.SetP("VMI", "kind")
+	fakeVMIJson.SetP(vmiName, "name")
+	fakeVMIJson.SetP(vmiName, VMIMetadataNamePath)
+	fakeVMIJson.SetP(namespace, "namespace")
+	fakeVMIJson.SetP("vmi-"+vmiName+"-prometheus-config", PrometheusConfigMapPath)
+	fakeVMIJson.SetP("vmi-"+vmiName+"-prometheus-config-versions", PrometheusVersionsConfigMapPath)
+	fakeVMIJson.SetP(rulesConfigName, PrometheusRulesConfigMapPath)
+	fakeVMIJson.SetP(rulesConfigName+"-versions", PrometheusRulesVersionsConfigMapPath)
+
+	testServer, _, _ := getTestServerEnv(t, fakeVMIJson.String())
+	c, err := newRestClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testclient.RestClient = c
+	return testclient
+}
+
+func TestCanaries(t *testing.T) {
+	vmiName = "vmi-canaries-test"
+	namespace = "vmi-canaries-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newCanaryTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	send := func(method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	prometheusConfig := func() string {
+		_, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return configMap[PrometheusConfigFileName]
+	}
+
+	/* *** Invalid canaries *** */
+	rr := send("PUT", "/canaries/api", `{"url": "api.example.com/healthz"}`)
+	verify(t, rr, http.StatusBadRequest, "the url must be an absolute http or https URL")
+	rr = send("PUT", "/canaries/api", `{"url": "https://api.example.com/healthz", "unknown": 1}`)
+	verifyStatus(t, rr, http.StatusBadRequest)
+	if strings.Contains(prometheusConfig(), "canary-api") {
+		t.Error("expected an invalid canary to leave prometheus.yml alone")
+	}
+
+	/* *** A canary rejected by the lint policy leaves no scrape job behind *** */
+	lintConfigMap := getTestConfigMap(getRuleLintConfigMapName(), namespace, ruleLintPolicyKey, `rules:
+- name: team
+  check: required_label
+  label: team
+- name: unique-alert-name
+  check: unique_alert_name
+`)
+	if _, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), lintConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rr = send("PUT", "/canaries/api", `{"url": "https://api.example.com/healthz"}`)
+	verify(t, rr, http.StatusBadRequest, "the alert has no team label")
+	if strings.Contains(prometheusConfig(), "canary-api") {
+		t.Error("expected a canary rejected by the lint policy to leave prometheus.yml alone")
+	}
+
+	/* *** Create canaries, passing the unique alert name check *** */
+	rr = send("PUT", "/canaries/web", `{"url": "https://www.example.com/", "labels": {"team": "web"}}`)
+	verify(t, rr, http.StatusAccepted, "A new rule file: canary-web.rules is being created.")
+	rr = send("PUT", "/canaries/api", `{"url": "https://api.example.com/healthz", "interval": "30s", "labels": {"team": "api"}}`)
+	verify(t, rr, http.StatusAccepted, "A new rule file: canary-api.rules is being created.")
+	if err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), lintConfigMap.Name, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if config := prometheusConfig(); !strings.Contains(config, "job_name: canary-api") || !strings.Contains(config, "https://api.example.com/healthz") {
+		t.Errorf("expected the canary-api scrape job in prometheus.yml, got %s", config)
+	}
+	if !strings.Contains(prometheusConfig(), "# fake global config") {
+		t.Error("expected the comments of prometheus.yml to be kept")
+	}
+	rr = send("GET", "/prometheus/rules/canary-api.rules", "")
+	verify(t, rr, http.StatusOK, "alert: CanaryDown_api")
+	rr = send("GET", "/canaries/api", "")
+	verify(t, rr, http.StatusOK, `"expectedStatus": 200`)
+	rr = send("GET", "/canaries", "")
+	verify(t, rr, http.StatusOK, `"api"`)
+
+	/* *** Update it, replacing the scrape job *** */
+	rr = send("PUT", "/canaries/api", `{"url": "https://api.example.com/healthz", "method": "POST", "expectedStatus": 201}`)
+	verify(t, rr, http.StatusAccepted, "The existing rule: canary-api.rules is being updated.")
+	if config := prometheusConfig(); strings.Count(config, "job_name: canary-api") != 1 || !strings.Contains(config, "http_post") {
+		t.Errorf("expected the canary-api scrape job to be replaced, got %s", config)
+	}
+
+	/* *** Delete it *** */
+	rr = send("DELETE", "/canaries/api", "")
+	verifyStatus(t, rr, http.StatusAccepted)
+	if strings.Contains(prometheusConfig(), "canary-api") {
+		t.Error("expected the canary-api scrape job to be removed")
+	}
+	rr = send("DELETE", "/canaries/api", "")
+	verify(t, rr, http.StatusNotFound, "Unable to find a canary called: api")
+	rr = send("GET", "/canaries/api", "")
+	verifyStatus(t, rr, http.StatusNotFound)
+
+	/* *** A canary whose rules cannot be deleted keeps its scrape job *** */
+	rr = send("GET", "/prometheus/rules/canary-web.rules", "")
+	verifyStatus(t, rr, http.StatusOK)
+	webRules := strings.Replace(rr.Body.String(), "groups:\n", "groups:\n- name: web-up\n  rules:\n  - record: web:up\n    expr: up{job=\"canary-web\"}\n", 1)
+	rr = send("PUT", "/prometheus/rules/canary-web.rules", webRules)
+	verifyStatus(t, rr, http.StatusAccepted)
+	rr = send("PUT", "/prometheus/rules/web-users.rules", "groups:\n- name: web-users\n  rules:\n  - alert: WebDown\n    expr: web:up == 0\n")
+	verifyStatus(t, rr, http.StatusAccepted)
+	rr = send("DELETE", "/canaries/web", "")
+	verify(t, rr, http.StatusConflict, "WebDown queries web:up")
+	if !strings.Contains(prometheusConfig(), "job_name: canary-web") {
+		t.Error("expected the canary-web scrape job to be restored when its rules could not be deleted")
+	}
+	rr = send("GET", "/canaries/web", "")
+	verifyStatus(t, rr, http.StatusOK)
+	rr = send("DELETE", "/prometheus/rules/web-users.rules", "")
+	verifyStatus(t, rr, http.StatusAccepted)
+	rr = send("DELETE", "/canaries/web", "")
+	verifyStatus(t, rr, http.StatusAccepted)
+	if strings.Contains(prometheusConfig(), "canary-web") {
+		t.Error("expected the canary-web scrape job to be removed")
+	}
+}
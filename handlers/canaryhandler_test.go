@@ -0,0 +1,100 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+func TestCanaryRules(t *testing.T) {
+	vmiName = "canary-test"
+	canary := Canary{URL: "https://api.example.com/healthz", Method: "head", Labels: map[string]string{"team": "api"},
+		Annotations: map[string]string{"runbook_url": "https://runbooks.example.com/api"}}
+	interval, err := validateCanary(&canary)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if canary.Method != "HEAD" || canary.ExpectedStatus != 200 || canary.Interval != "1m" {
+		t.Errorf("expected the defaults to be set, got %+v", canary)
+	}
+
+	alert := canaryRuleFile("api", &canary, interval).Groups[0].Rules[0]
+	expected := `up{job="canary-api"} == 0 or probe_http_status_code{job="canary-api"} != 200`
+	if alert.Expr != expected {
+		t.Errorf("got %s, want %s", alert.Expr, expected)
+	}
+	if alert.Alert != "CanaryDown_api" || alert.For != "2m" || alert.Labels["team"] != "api" || alert.Labels["canary"] != "api" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+	if alert.Annotations["runbook_url"] != "https://runbooks.example.com/api" || alert.Annotations["summary"] != "Canary api is down" {
+		t.Errorf("unexpected annotations: %v", alert.Annotations)
+	}
+
+	job := canaryScrapeConfig("api", &canary, interval)
+	if job["scrape_timeout"] != "10s" || job["metrics_path"] != "/probe" {
+		t.Errorf("unexpected scrape job: %v", job)
+	}
+	if module := job["params"].(map[string]interface{})["module"].([]interface{})[0]; module != "http_head" {
+		t.Errorf("expected the http_head module, got %v", module)
+	}
+
+	// The definition is read back from the rules file
+	rules, err := generateCanaryRules("api", &canary, interval)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition := canaryDefinition(string(rules))
+	if definition == nil || definition.URL != canary.URL || definition.Method != "HEAD" {
+		t.Errorf("unexpected definition: %+v", definition)
+	}
+	if canaryDefinition("groups: []\n") != nil {
+		t.Error("expected a rules file not generated for a canary to have no definition")
+	}
+}
+
+func TestValidateCanary(t *testing.T) {
+	for _, canary := range []Canary{
+		{URL: "api.example.com/healthz"},
+		{URL: "ftp://api.example.com"},
+		{URL: "https://api.example.com", Method: "TRACE"},
+		{URL: "https://api.example.com", ExpectedStatus: 99},
+		{URL: "https://api.example.com", Interval: "1s"},
+		{URL: "https://api.example.com", Interval: "soon"},
+		{URL: "https://api.example.com", Labels: map[string]string{"not-valid": "x"}},
+		{URL: "https://api.example.com", Annotations: map[string]string{"not-valid": "x"}},
+	} {
+		if _, err := validateCanary(&canary); err == nil {
+			t.Errorf("expected %+v to be invalid", canary)
+		}
+	}
+}
+
+func TestSetScrapeJob(t *testing.T) {
+	config := "scrape_configs:\n# Prometheus itself\n- job_name: prometheus\n- job_name: canary-api\n  scrape_interval: 1m\n"
+	b, found, err := setScrapeJob(config, "canary-api", map[string]interface{}{"job_name": "canary-api", "scrape_interval": "5m"})
+	if err != nil || !found {
+		t.Fatalf("expected the job to be replaced, got %v, %v", found, err)
+	}
+	if jobs := scrapeJobNames(parseTestConfig(t, b)); len(jobs) != 2 || !strings.Contains(string(b), "scrape_interval: 5m") ||
+		!strings.Contains(string(b), "# Prometheus itself") {
+		t.Errorf("unexpected jobs: %s", b)
+	}
+	if b, found, _ = setScrapeJob(string(b), "canary-api", nil); !found || len(scrapeJobNames(parseTestConfig(t, b))) != 1 {
+		t.Errorf("expected the job to be removed: %s", b)
+	}
+	if _, found, _ = setScrapeJob(string(b), "canary-api", nil); found {
+		t.Error("expected no job to be found")
+	}
+}
+
+func parseTestConfig(t *testing.T, b []byte) *gabs.Container {
+	config, err := parsePrometheusConfig(string(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return config
+}
@@ -0,0 +1,113 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// Suffix of the versions ConfigMap key holding the change metadata of a version.  The version "{file}-{timestamp}" has
+// its metadata in "{file}-{timestamp}.meta", and the current version of the file in "{file}.meta".
+const changeMetadataSuffix = ".meta"
+
+// ChangeMetadata describes who made a change to a file, and why.  Each version records the metadata of the change that
+// created it.
+type ChangeMetadata struct {
+	Author  string `json:"author,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	Ticket  string `json:"ticket,omitempty"`
+}
+
+// VersionInfo describes a saved version of a file, as returned by the versions endpoints.
+type VersionInfo struct {
+	Version string `json:"version"`
+	ChangeMetadata
+}
+
+// getChangeMetadata returns the change metadata provided with a request, via the X-Change-Author, X-Change-Comment and
+// X-Change-Ticket headers or the author, comment and ticket query parameters.  The author defaults to the authenticated
+// user.
+func getChangeMetadata(r *http.Request) ChangeMetadata {
+	metadata := ChangeMetadata{
+		Author:  headerOrQueryValue(r, "X-Change-Author", "author"),
+		Comment: headerOrQueryValue(r, "X-Change-Comment", "comment"),
+		Ticket:  headerOrQueryValue(r, "X-Change-Ticket", "ticket"),
+	}
+	if metadata.Author == "" {
+		metadata.Author = authenticatedUser(r)
+	}
+	return metadata
+}
+
+// This can be set from the command line via -trustedUserHeader.  It names the header in which the authenticating proxy
+// in front of the API server passes the user it authenticated.
+var trustedUserHeader string
+
+// authenticatedUser returns the name of the user who made the request, if known.  The API server has no authentication
+// of its own: the user is taken from the -trustedUserHeader header if one is set, the basic auth credentials enforced in
+// front of it otherwise.
+func authenticatedUser(r *http.Request) string {
+	if trustedUserHeader != "" {
+		return verifiedUser(r)
+	}
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return ""
+}
+
+// verifiedUser returns the user passed by the authenticating proxy in the -trustedUserHeader header, or "" if no such
+// header is set.  The basic auth username is never used here, as the API server does not check the password.  The
+// header can only be trusted if the proxy removes any copy of it sent by the client.
+func verifiedUser(r *http.Request) string {
+	if trustedUserHeader == "" {
+		return ""
+	}
+	return strings.TrimSpace(r.Header.Get(trustedUserHeader))
+}
+
+func headerOrQueryValue(r *http.Request, header string, param string) string {
+	if value := strings.TrimSpace(r.Header.Get(header)); value != "" {
+		return value
+	}
+	// Only look at the URL, so the request body is left alone.
+	return strings.TrimSpace(r.URL.Query().Get(param))
+}
+
+// saveChangeMetadata stores the metadata of the change that created the current version of a file in the given versions
+// ConfigMap data.  If the change replaced a version of the file, now saved with the given key, the metadata of that
+// version moves along with it.  An empty key means the file is new.
+func saveChangeMetadata(configMap map[string]string, fileName string, versionKey string, metadata ChangeMetadata) {
+	currentKey := fileName + changeMetadataSuffix
+	if previous, ok := configMap[currentKey]; ok && versionKey != "" {
+		configMap[versionKey+changeMetadataSuffix] = previous
+	}
+	delete(configMap, currentKey)
+	if metadata == (ChangeMetadata{}) {
+		return
+	}
+	b, _ := json.Marshal(metadata)
+	configMap[currentKey] = string(b)
+}
+
+// getVersionInfo returns the timestamp and change metadata of the version with the given key.
+func getVersionInfo(logger *zap.SugaredLogger, configMap map[string]string, versionKey string, fileName string) VersionInfo {
+	info := VersionInfo{Version: strings.Replace(versionKey, fileName+"-", "", 1)}
+	if value, ok := configMap[versionKey+changeMetadataSuffix]; ok {
+		if err := json.Unmarshal([]byte(value), &info.ChangeMetadata); err != nil {
+			logger.Errorf("Unable to parse the change metadata of %s: %v", versionKey, err)
+		}
+	}
+	return info
+}
+
+// deleteVersion removes the version with the given key, along with its change metadata.
+func deleteVersion(configMap map[string]string, versionKey string) {
+	delete(configMap, versionKey)
+	delete(configMap, versionKey+changeMetadataSuffix)
+}
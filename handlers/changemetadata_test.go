@@ -0,0 +1,57 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestGetChangeMetadata(t *testing.T) {
+	// Headers take precedence over query parameters
+	req, err := http.NewRequest("PUT", "/prometheus/rules/my.rules?author=query-user&comment=from+query&ticket=OPS-1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-Change-Author", "header-user")
+	metadata := getChangeMetadata(req)
+	expected := ChangeMetadata{Author: "header-user", Comment: "from query", Ticket: "OPS-1"}
+	if metadata != expected {
+		t.Errorf("got %v, expected %v", metadata, expected)
+	}
+
+	// The author defaults to the authenticated user
+	req, err = http.NewRequest("DELETE", "/prometheus/rules/my.rules", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("basic-user", "secret")
+	metadata = getChangeMetadata(req)
+	if metadata.Author != "basic-user" {
+		t.Errorf("expected author basic-user, got %s", metadata.Author)
+	}
+
+	// Nothing is stored when no metadata was provided
+	req, err = http.NewRequest("PUT", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap := map[string]string{}
+	saveChangeMetadata(configMap, "prometheus.yml", "", getChangeMetadata(req))
+	if len(configMap) != 0 {
+		t.Errorf("expected no change metadata to be saved, got %v", configMap)
+	}
+
+	// The metadata of the current version moves to the version it becomes
+	saveChangeMetadata(configMap, "prometheus.yml", "", ChangeMetadata{Author: "jdoe"})
+	saveChangeMetadata(configMap, "prometheus.yml", "prometheus.yml-2020-01-02T15-04-05", ChangeMetadata{Author: "asmith"})
+	if info := getVersionInfo(zap.S(), configMap, "prometheus.yml-2020-01-02T15-04-05", "prometheus.yml"); info.Author != "jdoe" {
+		t.Errorf("expected the saved version to be created by jdoe, got %+v", info)
+	}
+	if configMap["prometheus.yml.meta"] != `{"author":"asmith"}` {
+		t.Errorf("expected the current version to be created by asmith, got %v", configMap)
+	}
+}
@@ -19,13 +19,11 @@ import (
 
 // GetConfig returns the config for the monitoring instance API
 func GetConfig() *restgo.Config {
-	zap.S().Debugf("firing up at debug level: %d\n", debugLevel) // log at default debugLevel to ensure this line comes out
-
 	flag.StringVar(&ListenURL, "ListenURL", ":9097", "set Cirith listener URL, default :9097")
 	flag.StringVar(&promtoolPath, "promtoolPath", "/opt/tools/bin/promtool", "set path of promtool")
 	flag.StringVar(&staticPath, "staticPath", "/usr/local/bin/static", "set path to static assets (e.g. Swagger)")
-	flag.IntVar(&debugLevel, "debugLevel", LevelInfo, "debug level, 1 for most, 3 for least, 2 default."+
-		"Setting a level lower than the default is not recommended in production.")
+	var debugLevel int
+	flag.IntVar(&debugLevel, "debugLevel", 0, "Deprecated and ignored, use --zap-log-level instead")
 	flag.StringVar(&kubeconfig, "kubeconfig", "", "Path to a kubeconfig. Only required if out-of-cluster.")
 	flag.StringVar(&vmiName, "vminame", "", "The name of the Verrazzano Monitoring Instance (VMI) object to manage")
 	flag.StringVar(&namespace, "namespace", "default", "The namespace of the VMI object to manage")
@@ -35,6 +33,40 @@ func GetConfig() *restgo.Config {
 	flag.StringVar(&natGatewayIPsString, "natGatewayIPs", "", "Comma-separated list of NAT Gateway IPs associated with this Verrazzano Monitoring Instance (VMI)'s environment")
 	flag.StringVar(&ociConfigFile, "ociConfigFile", "", "Path to OCI config file.  Only required if out-of-cluster")
 	flag.StringVar(&backupBucket, "backupBucket", "", "The name of Object Store bucket used to hold backups")
+	flag.IntVar(&maxConfigMapDataSize, "maxConfigMapDataSize", DefaultMaxConfigMapDataSize, "The maximum number of bytes of data "+
+		"stored in a single rules, targets or versions ConfigMap before overflowing to an additional shard")
+	var auditLogFile string
+	flag.StringVar(&auditLogFile, "auditLogFile", "", "Path of the JSON lines audit log of all changes made through the API, stdout if not set")
+	flag.StringVar(&remoteCredentialsPath, "remoteCredentialsPath", "/etc/prometheus/remote-credentials", "Path at which "+
+		"the remote write and remote read credentials Secret is mounted in the Prometheus container")
+	var revealUsersString string
+	flag.StringVar(&revealUsersString, "revealUsers", "", "Comma-separated list of the users allowed to read the "+
+		"Prometheus configuration with its secrets, via ?reveal=true, as passed in the -trustedUserHeader header")
+	flag.StringVar(&trustedUserHeader, "trustedUserHeader", "", "Header in which the authenticating proxy in front of "+
+		"the API server passes the authenticated user.  The proxy must remove any copy of it sent by the client")
+	flag.StringVar(&prometheusURL, "prometheusURL", "", "Base URL of the Prometheus HTTP API rule expressions are "+
+		"evaluated against, the Prometheus service of the VMI if not set")
+	flag.StringVar(&ruleLintConfigMap, "ruleLintConfigMap", "", "Name of the ConfigMap holding the rule lint policy, "+
+		"vmi-<vmi>-prometheus-rule-lint if not set")
+	flag.StringVar(&ruleTemplatesConfigMap, "ruleTemplatesConfigMap", "", "Name of the ConfigMap holding the rule "+
+		"templates, vmi-<vmi>-prometheus-rule-templates if not set")
+	flag.StringVar(&alertmanagerPodSelector, "alertmanagerPodSelector", "", "Label selector of the Alertmanager pods "+
+		"the Alertmanager API is called on, app=vmi-<vmi>-alertmanager if not set")
+	flag.StringVar(&alertmanagerPort, "alertmanagerPort", alertmanagerPort, "Port of the Alertmanager API on the Alertmanager pods")
+	flag.StringVar(&targetsConfigMap, "targetsConfigMap", "", "Name of the ConfigMap holding the target files of the "+
+		"target groups, vmi-<vmi>-prometheus-targets if not set")
+	flag.StringVar(&targetsPath, "targetsPath", targetsPath, "Path at which the targets ConfigMap is mounted in the "+
+		"Prometheus container")
+	flag.StringVar(&blackboxExporterAddress, "blackboxExporterAddress", "", "host:port of the blackbox exporter probing "+
+		"the canaries, vmi-<vmi>-blackbox-exporter:9115 if not set")
+	flag.StringVar(&pushgatewayURL, "pushgatewayURL", "", "Base URL of the PushGateway, "+
+		"http://vmi-<vmi>-prometheus-gw:9091 if not set")
+	flag.DurationVar(&pushgatewayGroupTTL, "pushgatewayGroupTTL", 0, "Delete the PushGateway groups not pushed "+
+		"within this time, e.g. 24h, never if not set")
+	flag.BoolVar(&auditEvents, "auditEvents", false, "Also record each change made through the API as a Kubernetes Event on the VMI")
+	var trustedProxiesString string
+	flag.StringVar(&trustedProxiesString, "trustedProxies", "", "Comma-separated list of the IP addresses or CIDR ranges "+
+		"of the proxies in front of the API server, whose X-Forwarded-For header is trusted for the source IP of the audit records")
 	flag.Parse()
 
 	//Initialize the CFG
@@ -76,11 +108,26 @@ func GetConfig() *restgo.Config {
 		zap.S().Fatalf("Error building kubeconfig: %s", err.Error())
 	}
 
-	if debugLevel < LevelMin {
-		debugLevel = LevelMin
+	if debugLevel != 0 {
+		zap.S().Warn("The -debugLevel flag is deprecated and ignored, use --zap-log-level instead")
 	}
-	if debugLevel > LevelMax {
-		debugLevel = LevelMax
+
+	for _, user := range strings.Split(revealUsersString, ",") {
+		if user = strings.TrimSpace(user); user != "" {
+			revealUsers[user] = true
+		}
+	}
+
+	if trustedProxies, err = parseTrustedProxies(trustedProxiesString); err != nil {
+		zap.S().Fatalf("Invalid -trustedProxies: %v", err)
+	}
+
+	if auditLogFile != "" {
+		f, err := os.OpenFile(auditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			zap.S().Fatalf("Unable to open audit log %s: %+v", auditLogFile, err)
+		}
+		auditLog = f
 	}
 
 	if len(ociConfigFile) > 0 {
@@ -92,7 +139,5 @@ func GetConfig() *restgo.Config {
 
 	zap.S().Infof("command line arguments: %v", os.Args[1:])
 
-	zap.S().Debugf("Running at debug level: %d\n", debugLevel)
-
 	return cfg
 }
@@ -0,0 +1,491 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// A ConfigMap named in the VMI spec (the primary) may overflow into additional ConfigMaps (shards) once its data grows
+// past maxConfigMapDataSize.  Shards are named <primary>-shard-<n> and carry the ConfigMapShardLabel, so they can be
+// discovered from the primary name alone.  Callers see a single merged map and never need to know where a key lives.
+// The versions ConfigMaps, only read by the API server, take as many shards as needed.  The rules and targets ConfigMaps
+// are read by Prometheus, which only sees the shards mounted in its container: they are written with
+// updateMountedConfigMapByName, which only uses the shards the Prometheus pods mount in the directory of the primary.
+
+// errNoShardLeft is returned by placeShardedData when the data needs more shards than it may create.
+var errNoShardLeft = errors.New("no shard left")
+
+// configMapFullError is returned when data does not fit in a ConfigMap and the shards it may use.
+type configMapFullError struct {
+	name   string
+	size   int
+	shards int
+	// key is set when a single entry is too large for any ConfigMap.
+	key string
+}
+
+func (e *configMapFullError) Error() string {
+	if e.key != "" {
+		return fmt.Sprintf("%s is %d bytes, which exceeds the maximum ConfigMap data size of %d bytes", e.key, e.size, maxConfigMapDataSize)
+	}
+	return fmt.Sprintf("the data of %s would be %d bytes, which does not fit in it and the %d overflow shards the "+
+		"Prometheus pods mount along with it, of at most %d bytes each", e.name, e.size, e.shards, maxConfigMapDataSize)
+}
+
+// configMapUpdateFailed writes the response to a failed update of a ConfigMap: 507 if the data does not fit, 500
+// otherwise.
+func configMapUpdateFailed(w http.ResponseWriter, r *http.Request, message string, err error) {
+	if _, ok := err.(*configMapFullError); ok {
+		problemError(w, r, http.StatusInsufficientStorage, CodeConfigMapFull, "No action taken. "+message+" "+err.Error())
+		return
+	}
+	internalError(w, r, message+" "+err.Error())
+}
+
+// getShardedConfigMapByPath behaves like getConfigMapByPath, but also merges in the data of any overflow shards.
+func (k *K8s) getShardedConfigMapByPath(logger *zap.SugaredLogger, path string) (string, map[string]string, error) {
+	configMapName, configMap, err := k.getConfigMapByPath(logger, path)
+	if err != nil {
+		return "", nil, err
+	}
+	merged, err := k.mergeConfigMapShards(logger, configMapName, configMap)
+	if err != nil {
+		return "", nil, err
+	}
+	return configMapName, merged, nil
+}
+
+// getShardedConfigMapByName behaves like getConfigMapByName, but also merges in the data of any overflow shards.
+func (k *K8s) getShardedConfigMapByName(logger *zap.SugaredLogger, name string) (map[string]string, error) {
+	configMap, err := k.getConfigMapByName(name)
+	if err != nil {
+		return nil, err
+	}
+	return k.mergeConfigMapShards(logger, name, configMap)
+}
+
+// mergeConfigMapShards returns the data of the named primary ConfigMap merged with that of its shards.
+func (k *K8s) mergeConfigMapShards(logger *zap.SugaredLogger, configMapName string, configMap map[string]string) (map[string]string, error) {
+	shards, err := k.getConfigMapShards(configMapName)
+	if err != nil {
+		logger.Errorf("Unable to list shards of ConfigMap %s: %v", configMapName, err)
+		return nil, err
+	}
+	if len(shards) == 0 {
+		return configMap, nil
+	}
+
+	merged := make(map[string]string, len(configMap))
+	for key, value := range configMap {
+		merged[key] = value
+	}
+	for _, shard := range shards {
+		for key, value := range shard.Data {
+			merged[key] = value
+		}
+	}
+	return merged, nil
+}
+
+// updateShardedConfigMapByName stores the given data across the named primary ConfigMap and its overflow shards,
+// creating as many shards as needed.
+func (k *K8s) updateShardedConfigMapByName(logger *zap.SugaredLogger, updatedMap map[string]string, name string) error {
+	plan, err := k.planConfigMapShards(updatedMap, name, -1)
+	if err != nil {
+		return err
+	}
+	return k.applyConfigMapShards(logger, plan)
+}
+
+// updateMountedConfigMapByName stores the given data across the named primary ConfigMap, mounted in the Prometheus
+// container, and the overflow shards mounted along with it.  Data that does not fit in these is rejected with a
+// configMapFullError, and nothing is changed.  Keys held by shards Prometheus no longer mounts are moved out of them.
+func (k *K8s) updateMountedConfigMapByName(logger *zap.SugaredLogger, updatedMap map[string]string, name string) error {
+	mountedShards, err := k.getMountedShardCount(name)
+	if err != nil {
+		return err
+	}
+	plan, err := k.planConfigMapShards(updatedMap, name, mountedShards)
+	if err != nil {
+		return err
+	}
+	return k.applyConfigMapShards(logger, plan)
+}
+
+// checkMountedConfigMapFits returns a configMapFullError if the given data would not fit in the named primary
+// ConfigMap, mounted in the Prometheus container, and the overflow shards mounted along with it.  Nothing is changed.
+func (k *K8s) checkMountedConfigMapFits(logger *zap.SugaredLogger, updatedMap map[string]string, name string) error {
+	mountedShards, err := k.getMountedShardCount(name)
+	if err != nil {
+		return err
+	}
+	_, err = k.planConfigMapShards(updatedMap, name, mountedShards)
+	return err
+}
+
+// shardPlan is the data each ConfigMap of a primary ConfigMap and its shards is to hold after an update.
+type shardPlan struct {
+	primary *corev1.ConfigMap
+	// shards are the existing shards kept, in shard order
+	shards []corev1.ConfigMap
+	// current is the data currently held by the primary, then by each of the shards kept
+	current []map[string]string
+	// placement is the data to be held by the primary, each of the shards kept, then each of the newShards
+	placement []map[string]string
+	newShards []int
+	// dropped are the existing shards beyond the shards that may be used, to be emptied and deleted
+	dropped []corev1.ConfigMap
+}
+
+// planConfigMapShards works out where to store the given data across the named primary ConfigMap and at most maxShards
+// overflow shards, any number if maxShards is negative.  New shards take the lowest free shard numbers.
+func (k *K8s) planConfigMapShards(updatedMap map[string]string, name string, maxShards int) (*shardPlan, error) {
+	primary, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	shards, err := k.getConfigMapShards(name)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &shardPlan{primary: primary, current: []map[string]string{primary.Data}}
+	used := make(map[int]bool)
+	for _, shard := range shards {
+		index := shardIndex(name, shard.Name)
+		if maxShards >= 0 && index > maxShards {
+			plan.dropped = append(plan.dropped, shard)
+			continue
+		}
+		plan.shards = append(plan.shards, shard)
+		plan.current = append(plan.current, shard.Data)
+		used[index] = true
+	}
+	maxNewShards := -1
+	if maxShards >= 0 {
+		maxNewShards = maxShards - len(plan.shards)
+	}
+	plan.placement, err = placeShardedData(updatedMap, plan.current, maxNewShards)
+	if err == errNoShardLeft {
+		return nil, &configMapFullError{name: name, size: configMapDataSize(updatedMap), shards: maxShards}
+	}
+	if err != nil {
+		return nil, err
+	}
+	index := 1
+	for i := len(plan.current); i < len(plan.placement); i++ {
+		for used[index] {
+			index++
+		}
+		plan.newShards = append(plan.newShards, index)
+		used[index] = true
+	}
+	return plan, nil
+}
+
+// placeShardedData places the given data across ConfigMaps currently holding the given data, the primary first.  Keys
+// stay in the ConfigMap that already holds them whenever they still fit, so that an update touches as few ConfigMaps as
+// possible.  Other keys go to the first ConfigMap with room, then to at most maxNewShards new shards, any number if
+// maxNewShards is negative.  It returns the data of each current ConfigMap, followed by that of each new shard.
+func placeShardedData(updatedMap map[string]string, current []map[string]string, maxNewShards int) ([]map[string]string, error) {
+	placement := make([]map[string]string, len(current))
+	sizes := make([]int, len(current))
+	for i := range placement {
+		placement[i] = make(map[string]string)
+	}
+
+	keys := make([]string, 0, len(updatedMap))
+	for key := range updatedMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// First pass: keep existing keys where they are.
+	var pending []string
+	for _, key := range keys {
+		size := len(key) + len(updatedMap[key])
+		if size > maxConfigMapDataSize {
+			return nil, &configMapFullError{key: key, size: size}
+		}
+		placed := false
+		for i := range current {
+			if _, ok := current[i][key]; ok && sizes[i]+size <= maxConfigMapDataSize {
+				placement[i][key] = updatedMap[key]
+				sizes[i] += size
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			pending = append(pending, key)
+		}
+	}
+
+	// Second pass: place new or displaced keys in the first ConfigMap with room, adding shards when all are full.
+	for _, key := range pending {
+		size := len(key) + len(updatedMap[key])
+		placed := false
+		for i := range placement {
+			if sizes[i]+size <= maxConfigMapDataSize {
+				placement[i][key] = updatedMap[key]
+				sizes[i] += size
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			if maxNewShards >= 0 && len(placement)-len(current) >= maxNewShards {
+				return nil, errNoShardLeft
+			}
+			placement = append(placement, map[string]string{key: updatedMap[key]})
+			sizes = append(sizes, size)
+		}
+	}
+	return placement, nil
+}
+
+// Kubernetes limits a ConfigMap to 1 MiB, which the data of a ConfigMap may only approach while keys are being moved
+// between shards.
+const maxConfigMapSize = 1024 * 1024
+
+// applyConfigMapShards stores the data of a shard plan.  Keys being moved are never missing from the merged view: new
+// shards are created, and each ConfigMap gaining keys is given them, while the ConfigMaps losing them still hold them.
+// Meanwhile a moved key may be held twice, the merged view taking either of its values.  A ConfigMap whose current and
+// planned data together would exceed the Kubernetes limit only gets its planned data, so its moved keys are missing
+// from the merged view until the ConfigMaps losing them are updated.
+func (k *K8s) applyConfigMapShards(logger *zap.SugaredLogger, plan *shardPlan) error {
+	name := plan.primary.Name
+	configMapName := func(i int) string {
+		if i == 0 {
+			return name
+		}
+		return plan.shards[i-1].Name
+	}
+
+	// Create any new shards first.
+	for i, index := range plan.newShards {
+		if err := k.createConfigMapShard(logger, plan.primary, index, plan.placement[len(plan.current)+i]); err != nil {
+			return err
+		}
+	}
+
+	// Give the existing ConfigMaps the keys they gain, keeping the ones they lose for now.
+	written := make([]map[string]string, len(plan.current))
+	for i := range plan.current {
+		written[i] = plan.current[i]
+		gains := false
+		for key, value := range plan.placement[i] {
+			if current, ok := plan.current[i][key]; !ok || current != value {
+				gains = true
+				break
+			}
+		}
+		if !gains || len(plan.placement[i]) == 0 {
+			continue
+		}
+		union := make(map[string]string, len(plan.current[i])+len(plan.placement[i]))
+		for key, value := range plan.current[i] {
+			union[key] = value
+		}
+		for key, value := range plan.placement[i] {
+			union[key] = value
+		}
+		if configMapDataSize(union) > maxConfigMapSize {
+			logger.Warnw("Updating a ConfigMap shard without keeping the keys it loses meanwhile, as they would not fit",
+				"configmap", configMapName(i))
+			union = plan.placement[i]
+		}
+		if err := k.updateConfigMapByName(logger, union, configMapName(i)); err != nil {
+			return err
+		}
+		written[i] = union
+	}
+
+	// Then store their planned data.
+	for i := range plan.current {
+		// Emptied shards are deleted below rather than updated.
+		if (i > 0 && len(plan.placement[i]) == 0) || mapsEqual(plan.placement[i], written[i]) {
+			continue
+		}
+		if err := k.updateConfigMapByName(logger, plan.placement[i], configMapName(i)); err != nil {
+			return err
+		}
+	}
+
+	// Finally remove the shards that no longer hold anything, or may no longer be used.
+	deleted := plan.dropped
+	for i := 1; i < len(plan.current); i++ {
+		if len(plan.placement[i]) == 0 {
+			deleted = append(deleted, plan.shards[i-1])
+		}
+	}
+	for _, shard := range deleted {
+		logger.Infof("Deleting ConfigMap shard %s", shard.Name)
+		err := k.ClientSet.CoreV1().ConfigMaps(namespace).Delete(context.TODO(), shard.Name, metav1.DeleteOptions{})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getPrometheusPodSelector returns the label selector of the Prometheus pods of the VMI.
+func getPrometheusPodSelector() string {
+	return "app=vmi-" + vmiName + "-prometheus"
+}
+
+// getMountedShardCount returns the number of overflow shards of the named primary ConfigMap Prometheus reads: shards 1
+// to n must be mounted in the directory of the primary in every Prometheus pod, as optional sources of the projected
+// volume holding the primary.  There are none while there is no Prometheus pod, as nothing shows they would be read.
+func (k *K8s) getMountedShardCount(primaryName string) (int, error) {
+	pods, err := k.getPodsByLabel(getPrometheusPodSelector())
+	if err != nil {
+		return 0, err
+	}
+	count := -1
+	for i := range pods.Items {
+		podCount := 0
+		for _, mountPath := range podConfigMapMountPaths(&pods.Items[i], primaryName) {
+			n := 0
+			for podMountsConfigMap(&pods.Items[i], shardName(primaryName, n+1), mountPath) {
+				n++
+			}
+			if n > podCount {
+				podCount = n
+			}
+		}
+		if count < 0 || podCount < count {
+			count = podCount
+		}
+	}
+	if count < 0 {
+		return 0, nil
+	}
+	return count, nil
+}
+
+// podConfigMapMountPaths returns the paths at which the containers of the pod mount the named ConfigMap, on its own or
+// as a source of a projected volume.
+func podConfigMapMountPaths(pod *corev1.Pod, configMapName string) []string {
+	return podVolumeMountPaths(pod, func(volume corev1.Volume) bool {
+		if volume.ConfigMap != nil && volume.ConfigMap.Name == configMapName {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil && source.ConfigMap.Name == configMapName {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// podVolumeMountPaths returns the paths at which the containers of the pod mount the volumes selected, whole.
+func podVolumeMountPaths(pod *corev1.Pod, selected func(corev1.Volume) bool) []string {
+	volumes := make(map[string]bool)
+	for _, volume := range pod.Spec.Volumes {
+		if selected(volume) {
+			volumes[volume.Name] = true
+		}
+	}
+	var mountPaths []string
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if volumes[mount.Name] && mount.SubPath == "" {
+				mountPaths = append(mountPaths, path.Clean(mount.MountPath))
+			}
+		}
+	}
+	return mountPaths
+}
+
+// podMountsConfigMap returns whether a container of the pod mounts the named ConfigMap at the given path.
+func podMountsConfigMap(pod *corev1.Pod, configMapName string, mountPath string) bool {
+	for _, p := range podConfigMapMountPaths(pod, configMapName) {
+		if p == path.Clean(mountPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// getConfigMapShards returns the overflow shards of the named primary ConfigMap, in shard order.
+func (k *K8s) getConfigMapShards(primaryName string) ([]corev1.ConfigMap, error) {
+	defer observeKubernetesAPICall("getConfigMapShards", time.Now())
+	list, err := k.ClientSet.CoreV1().ConfigMaps(namespace).List(context.TODO(),
+		metav1.ListOptions{LabelSelector: ConfigMapShardLabel + "=" + primaryName})
+	if err != nil {
+		return nil, err
+	}
+	shards := list.Items
+	sort.Slice(shards, func(i, j int) bool {
+		return shardIndex(primaryName, shards[i].Name) < shardIndex(primaryName, shards[j].Name)
+	})
+	return shards, nil
+}
+
+// createConfigMapShard creates a new overflow shard of the given primary ConfigMap.  The shard inherits the labels and
+// owner references of the primary, so it is cleaned up along with the VMI.
+func (k *K8s) createConfigMapShard(logger *zap.SugaredLogger, primary *corev1.ConfigMap, index int, data map[string]string) error {
+	labels := make(map[string]string, len(primary.Labels)+1)
+	for key, value := range primary.Labels {
+		labels[key] = value
+	}
+	labels[ConfigMapShardLabel] = primary.Name
+
+	shard := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            shardName(primary.Name, index),
+			Namespace:       namespace,
+			Labels:          labels,
+			OwnerReferences: primary.OwnerReferences,
+		},
+		Data: data,
+	}
+	logger.Infof("Creating ConfigMap shard %s", shard.Name)
+	_, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), shard, metav1.CreateOptions{})
+	return err
+}
+
+// shardName returns the name of the shard with the given index of the named primary ConfigMap.
+func shardName(primaryName string, index int) string {
+	return fmt.Sprintf("%s-shard-%d", primaryName, index)
+}
+
+// shardIndex returns the index of the named shard of the given primary ConfigMap, or 0 if the name is not a shard name.
+func shardIndex(primaryName string, shardName string) int {
+	index, err := strconv.Atoi(strings.TrimPrefix(shardName, primaryName+"-shard-"))
+	if err != nil {
+		return 0
+	}
+	return index
+}
+
+// mapsEqual compares two ConfigMap data maps, treating nil and empty maps as equal.
+func mapsEqual(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		if other, ok := b[key]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
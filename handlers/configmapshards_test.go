@@ -0,0 +1,334 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestShardedConfigMapOverflowAndShrink(t *testing.T) {
+	vmiName = "vmi-shards-test"
+	namespace = "vmi-shards-test"
+	rulesConfigMapName := "vmi-" + vmiName + "-alertrules"
+	testclient := newShardsTestClient(t, vmiName, namespace, rulesConfigMapName)
+
+	defer func() { maxConfigMapDataSize = DefaultMaxConfigMapDataSize }()
+	maxConfigMapDataSize = 250
+
+	// Five 100 byte entries need three ConfigMaps of 250 bytes
+	data := make(map[string]string)
+	for i := 1; i <= 5; i++ {
+		data[fmt.Sprintf("rule%d.rules", i)] = strings.Repeat("x", 100-len("ruleN.rules"))
+	}
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	shards, err := testclient.getConfigMapShards(rulesConfigMapName)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(shards) != 2 {
+		t.Fatalf("expected 2 shards, got %d", len(shards))
+	}
+	for i, shard := range shards {
+		expectedName := fmt.Sprintf("%s-shard-%d", rulesConfigMapName, i+1)
+		if shard.Name != expectedName {
+			t.Errorf("expected shard %s, got %s", expectedName, shard.Name)
+		}
+		if shard.Labels[ConfigMapShardLabel] != rulesConfigMapName {
+			t.Errorf("shard %s is missing the shard label", shard.Name)
+		}
+		if shard.Labels["app"] != "test" {
+			t.Errorf("shard %s did not inherit the labels of the primary ConfigMap", shard.Name)
+		}
+	}
+
+	// The merged view contains every key exactly as provided
+	_, merged, err := testclient.getShardedConfigMapByPath(zap.S(), PrometheusRulesConfigMapPath)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !mapsEqual(merged, data) {
+		t.Errorf("merged ConfigMap data does not match: got %v", merged)
+	}
+
+	// Updating a key in place does not move any other key
+	data["rule5.rules"] = "updated"
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	primary, _ := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), rulesConfigMapName, metav1.GetOptions{})
+	if len(primary.Data) != 2 || primary.Data["rule1.rules"] == "" || primary.Data["rule2.rules"] == "" {
+		t.Errorf("expected the primary ConfigMap to keep rule1.rules and rule2.rules, got %v", primary.Data)
+	}
+
+	// Removing keys deletes the shards that become empty
+	delete(data, "rule3.rules")
+	delete(data, "rule4.rules")
+	delete(data, "rule5.rules")
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shards, _ = testclient.getConfigMapShards(rulesConfigMapName)
+	if len(shards) != 0 {
+		t.Errorf("expected all shards to be deleted, got %d", len(shards))
+	}
+	_, merged, _ = testclient.getShardedConfigMapByPath(zap.S(), PrometheusRulesConfigMapPath)
+	if !mapsEqual(merged, data) {
+		t.Errorf("merged ConfigMap data does not match: got %v", merged)
+	}
+}
+
+func TestShardedConfigMapEntryTooLarge(t *testing.T) {
+	vmiName = "vmi-shards-test"
+	namespace = "vmi-shards-test"
+	rulesConfigMapName := "vmi-" + vmiName + "-alertrules"
+	testclient := newShardsTestClient(t, vmiName, namespace, rulesConfigMapName)
+
+	defer func() { maxConfigMapDataSize = DefaultMaxConfigMapDataSize }()
+	maxConfigMapDataSize = 50
+
+	err := testclient.updateShardedConfigMapByName(zap.S(), map[string]string{"big.rules": strings.Repeat("x", 50)}, rulesConfigMapName)
+	if err == nil || !strings.Contains(err.Error(), "exceeds the maximum ConfigMap data size") {
+		t.Errorf("expected an error for an entry larger than a ConfigMap, got %v", err)
+	}
+}
+
+func TestShardedConfigMapMovedKeysNeverMissing(t *testing.T) {
+	vmiName = "vmi-shards-test"
+	namespace = "vmi-shards-test"
+	rulesConfigMapName := "vmi-" + vmiName + "-alertrules"
+	testclient := newShardsTestClient(t, vmiName, namespace, rulesConfigMapName)
+
+	defer func() { maxConfigMapDataSize = DefaultMaxConfigMapDataSize }()
+	maxConfigMapDataSize = 250
+
+	// rule1 and rule2 in the primary, rule3 and rule4 in shard 1, rule5 in shard 2
+	data := make(map[string]string)
+	for i := 1; i <= 5; i++ {
+		data[fmt.Sprintf("rule%d.rules", i)] = strings.Repeat("x", 100-len("ruleN.rules"))
+	}
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	list, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).List(context.TODO(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := make(map[string]map[string]string)
+	for _, configMap := range list.Items {
+		state[configMap.Name] = configMap.Data
+	}
+
+	// Growing rule3 moves rule4 out of shard 1, into the room rule1 leaves in the primary
+	fake := testclient.ClientSet.(*k8sfake.Clientset)
+	fake.ClearActions()
+	delete(data, "rule1.rules")
+	data["rule3.rules"] = strings.Repeat("y", 200-len("ruleN.rules"))
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	primary, _ := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), rulesConfigMapName, metav1.GetOptions{})
+	if _, ok := primary.Data["rule4.rules"]; !ok {
+		t.Fatalf("expected rule4.rules to move to the primary ConfigMap, got %v", primary.Data)
+	}
+
+	// Replay the writes: rule4 is in the merged view after each of them
+	for _, action := range fake.Actions() {
+		switch action.GetVerb() {
+		case "create", "update":
+			configMap := action.(k8stesting.CreateAction).GetObject().(*corev1.ConfigMap)
+			state[configMap.Name] = configMap.Data
+		case "delete":
+			delete(state, action.(k8stesting.DeleteAction).GetName())
+		default:
+			continue
+		}
+		found := false
+		for _, configMapData := range state {
+			if _, ok := configMapData["rule4.rules"]; ok {
+				found = true
+			}
+		}
+		if !found {
+			t.Fatalf("rule4.rules missing from the merged view after %s %s", action.GetVerb(), action.GetResource().Resource)
+		}
+	}
+}
+
+func TestMountedConfigMapShards(t *testing.T) {
+	vmiName = "vmi-shards-test"
+	namespace = "vmi-shards-test"
+	rulesConfigMapName := "vmi-" + vmiName + "-alertrules"
+	testclient := newShardsTestClient(t, vmiName, namespace, rulesConfigMapName)
+
+	defer func() { maxConfigMapDataSize = DefaultMaxConfigMapDataSize }()
+	maxConfigMapDataSize = 250
+
+	// Without a Prometheus pod mounting shards, data that does not fit in the ConfigMap is rejected
+	data := map[string]string{"rule1.rules": strings.Repeat("x", 89), "rule2.rules": strings.Repeat("x", 89), "rule3.rules": strings.Repeat("x", 89)}
+	err := testclient.updateMountedConfigMapByName(zap.S(), data, rulesConfigMapName)
+	if _, ok := err.(*configMapFullError); !ok {
+		t.Fatalf("expected a configMapFullError, got %v", err)
+	}
+	rr := httptest.NewRecorder()
+	configMapUpdateFailed(rr, httptest.NewRequest("PUT", "/prometheus/rules/rule3.rules", nil), "Unable to update alertrules ConfigMap.", err)
+	verify(t, rr, http.StatusInsufficientStorage, "does not fit in it and the 0 overflow shards")
+	if shards, _ := testclient.getConfigMapShards(rulesConfigMapName); len(shards) != 0 {
+		t.Errorf("expected no shard to be created, got %d", len(shards))
+	}
+
+	// Shards mounted along with the ConfigMap by every Prometheus pod are used
+	pod := newShardsTestPod(rulesConfigMapName, 2)
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := testclient.checkMountedConfigMapFits(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shards, _ := testclient.getConfigMapShards(rulesConfigMapName); len(shards) != 0 {
+		t.Errorf("expected checking the data not to create a shard, got %d", len(shards))
+	}
+	if err := testclient.updateMountedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	shards, _ := testclient.getConfigMapShards(rulesConfigMapName)
+	if len(shards) != 1 || shards[0].Name != rulesConfigMapName+"-shard-1" {
+		t.Fatalf("expected shard 1, got %v", shards)
+	}
+	_, merged, _ := testclient.getShardedConfigMapByPath(zap.S(), PrometheusRulesConfigMapPath)
+	if !mapsEqual(merged, data) {
+		t.Errorf("merged ConfigMap data does not match: got %v", merged)
+	}
+
+	// But no more than those
+	data["rule4.rules"] = strings.Repeat("x", 89)
+	data["rule5.rules"] = strings.Repeat("x", 89)
+	data["rule6.rules"] = strings.Repeat("x", 89)
+	data["rule7.rules"] = strings.Repeat("x", 89)
+	err = testclient.updateMountedConfigMapByName(zap.S(), data, rulesConfigMapName)
+	if err == nil || !strings.Contains(err.Error(), "does not fit in it and the 2 overflow shards") {
+		t.Fatalf("expected a configMapFullError, got %v", err)
+	}
+	if shards, _ := testclient.getConfigMapShards(rulesConfigMapName); len(shards) != 1 {
+		t.Errorf("expected no shard to be created, got %d", len(shards))
+	}
+
+	// A pod mounting fewer shards limits them all
+	other := newShardsTestPod(rulesConfigMapName, 1)
+	other.Name = "vmi-" + vmiName + "-prometheus-1"
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Create(context.TODO(), other, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	delete(data, "rule6.rules")
+	delete(data, "rule7.rules")
+	if err := testclient.checkMountedConfigMapFits(zap.S(), data, rulesConfigMapName); err == nil {
+		t.Error("expected the data not to fit in the ConfigMap and 1 shard")
+	}
+
+	// Data held by shards no longer mounted is moved out of them
+	if err := testclient.updateShardedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shards, _ := testclient.getConfigMapShards(rulesConfigMapName); len(shards) != 2 {
+		t.Fatalf("expected 2 shards, got %d", len(shards))
+	}
+	delete(data, "rule5.rules")
+	if err := testclient.updateMountedConfigMapByName(zap.S(), data, rulesConfigMapName); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if shards, _ := testclient.getConfigMapShards(rulesConfigMapName); len(shards) != 1 || shards[0].Name != rulesConfigMapName+"-shard-1" {
+		t.Errorf("expected shard 2 to be deleted, got %v", shards)
+	}
+	_, merged, _ = testclient.getShardedConfigMapByPath(zap.S(), PrometheusRulesConfigMapPath)
+	if !mapsEqual(merged, data) {
+		t.Errorf("merged ConfigMap data does not match: got %v", merged)
+	}
+}
+
+func TestPodMountsConfigMap(t *testing.T) {
+	pod := corev1.Pod{Spec: corev1.PodSpec{
+		Volumes: []corev1.Volume{{Name: "targets", VolumeSource: corev1.VolumeSource{
+			ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "vmi-test-prometheus-targets"}}}}},
+		Containers: []corev1.Container{{Name: "prometheus", VolumeMounts: []corev1.VolumeMount{{Name: "targets", MountPath: "/etc/prometheus/targets/"}}}},
+	}}
+	if !podMountsConfigMap(&pod, "vmi-test-prometheus-targets", "/etc/prometheus/targets") {
+		t.Error("expected the ConfigMap to be mounted")
+	}
+	if podMountsConfigMap(&pod, "vmi-test-prometheus-targets", "/etc/prometheus/file_sd") {
+		t.Error("expected the ConfigMap not to be mounted at another path")
+	}
+	if podMountsConfigMap(&pod, "other", "/etc/prometheus/targets") {
+		t.Error("expected another ConfigMap not to be mounted")
+	}
+
+	// ConfigMaps may be sources of a projected volume
+	rules := newShardsTestPod("vmi-test-alertrules", 2)
+	if !podMountsConfigMap(rules, "vmi-test-alertrules", "/etc/prometheus/rules") ||
+		!podMountsConfigMap(rules, "vmi-test-alertrules-shard-2", "/etc/prometheus/rules") {
+		t.Error("expected the projected ConfigMaps to be mounted")
+	}
+	if podMountsConfigMap(rules, "vmi-test-alertrules-shard-3", "/etc/prometheus/rules") {
+		t.Error("expected a ConfigMap missing from the projected volume not to be mounted")
+	}
+}
+
+// Used by the shard unit tests to create a Prometheus pod projecting the given ConfigMap and its first shards in the
+// rules directory
+func newShardsTestPod(configMapName string, shards int) *corev1.Pod {
+	sources := []corev1.VolumeProjection{{ConfigMap: &corev1.ConfigMapProjection{
+		LocalObjectReference: corev1.LocalObjectReference{Name: configMapName}}}}
+	optional := true
+	for i := 1; i <= shards; i++ {
+		sources = append(sources, corev1.VolumeProjection{ConfigMap: &corev1.ConfigMapProjection{
+			LocalObjectReference: corev1.LocalObjectReference{Name: fmt.Sprintf("%s-shard-%d", configMapName, i)}, Optional: &optional}})
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "vmi-" + vmiName + "-prometheus-0", Namespace: namespace,
+			Labels: map[string]string{"app": "vmi-" + vmiName + "-prometheus"}},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "rules-volume", VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{Sources: sources}}}},
+			Containers: []corev1.Container{{Name: "prometheus", VolumeMounts: []corev1.VolumeMount{{Name: "rules-volume", MountPath: "/etc/prometheus/rules"}}}},
+		},
+	}
+}
+
+// Used by the shard unit tests to create a test clientset with an empty, labeled alertrules ConfigMap
+func newShardsTestClient(t *testing.T, vmiName string, namespace string, configMapName string) *K8s {
+	testclient := K8s{}
+
+	configMap := createEmptyTestConfigMap(configMapName, namespace)
+	configMap.Labels = map[string]string{"app": "test"}
+	testclient.ClientSet = k8sfake.NewSimpleClientset(configMap)
+
+	fakeVMIJson := gabs.New()
+	fakeVMIJson.SetP(fmt.Sprintf("%s/%s", VMIGroup, VMIVersion), "apiVersion")
+	fakeVMIJson.SetP("VMI", "kind")
+	fakeVMIJson.SetP(vmiName, VMIMetadataNamePath)
+	fakeVMIJson.SetP(namespace, "namespace")
+	fakeVMIJson.SetP(configMapName, PrometheusRulesConfigMapPath)
+
+	testServer, _, _ := getTestServerEnv(t, fakeVMIJson.String())
+
+	c, err := newRestClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	testclient.RestClient = c
+	return &testclient
+}
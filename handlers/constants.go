@@ -12,7 +12,6 @@ var ListenURL string
 
 var promtoolPath string
 var staticPath string
-var debugLevel = LevelInfo
 var masterURL string
 var kubeconfig string
 var ociConfigFile string
@@ -22,6 +21,7 @@ var namespace string
 var defaultMaxSize int64
 var defaultMinSize int64
 var backupBucket string
+var maxConfigMapDataSize = DefaultMaxConfigMapDataSize
 
 const minSizeDisk = "minSizeDisk"
 const maxSizeDisk = "maxSizeDisk"
@@ -43,6 +43,9 @@ const VMIGroup = "verrazzano.io"
 // VMIVersion version of instance resource.
 const VMIVersion = "v1"
 
+// VMIKind kind of an instance resource.
+const VMIKind = "VerrazzanoMonitoringInstance"
+
 // VMIPlural plural name for an instance resource.
 const VMIPlural = "verrazzanomonitoringinstances"
 
@@ -61,11 +64,27 @@ const PrometheusRulesConfigMapPath = "spec.prometheus.rulesConfigMap"
 // PrometheusRulesVersionsConfigMapPath path for Prometheus rules versions configMap.
 const PrometheusRulesVersionsConfigMapPath = "spec.prometheus.rulesVersionsConfigMap"
 
+// AlertmanagerConfigMapPath path for Alert Manager configMap.
+const AlertmanagerConfigMapPath = "spec.alertmanager.configMap"
+
+// AlertmanagerConfigFileName file name of Alert Manager config file.
+const AlertmanagerConfigFileName = "alertmanager.yml"
+
 // AlertmanagerTemplatesConfigMapPath for Alert Manager configMap.
 const AlertmanagerTemplatesConfigMapPath = "spec.alertmanager.templatesConfigMap"
 
 // PrometheusConfigFileName file name of Prometheus config file.
 const PrometheusConfigFileName = "prometheus.yml"
 
+// ConfigMapShardLabel label placed on the overflow shards of a ConfigMap.  Its value is the name of the primary ConfigMap.
+const ConfigMapShardLabel = "verrazzano.io/shard-of"
+
+// DefaultMaxConfigMapDataSize default number of bytes of data placed in a single ConfigMap before overflowing to a shard.
+// K8s limits a ConfigMap to 1 MiB, so leave some room for metadata.
+const DefaultMaxConfigMapDataSize = 900 * 1024
+
+// EventSourceComponent component reported as the source of Kubernetes Events.
+const EventSourceComponent = "verrazzano-monitoring-instance-api"
+
 // K8sPublicIPAddressLabel label name for IP address.
 const K8sPublicIPAddressLabel = "node.info/external.ipaddress"
@@ -10,7 +10,7 @@ import (
 // GetHealthCheck is the /healthcheck router function.
 func GetHealthCheck(w http.ResponseWriter, r *http.Request) {
 	//Only print to stdout in Debug Mode so it does not flood the Pod logs since k8s calls this API every 5 secs for liveness probes.
-	log(LevelDebug, "200 OK: %s", "Healthy")
+	requestLogger(r).Debugw("200 OK", "status", 200, "detail", "Healthy")
 	w.WriteHeader(200)
 	// Write output in json Format has per API healthcheck response best practices.
 	w.Write([]byte("{\"description\": \"Health of Verrazzano Monitoring Instance API service\", \"status\": \"pass\"}"))
@@ -28,37 +28,16 @@ import (
 	"strconv"
 
 	"github.com/Jeffail/gabs/v2"
+	"go.uber.org/zap"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-// LevelAll is all log level.
-const LevelAll = 0
-
-// LevelDebug is debug log level.
-const LevelDebug = 1
-
-// LevelInfo is info log level.
-const LevelInfo = 2
-
-// LevelError is error log level.
-const LevelError = 3
-
-// LevelFatal is fatal log level.
-const LevelFatal = 4
-
-// LevelMin is minimum log level.
-const LevelMin = LevelAll
-
-// LevelMax is maximum log level.
-const LevelMax = LevelFatal
-
 const defaultWaitTime = 10 * time.Second
 
 var (
-	levelNames               = [...]string{"FINEST", "DEBUG", "INFO", "ERROR", "FATAL"}
 	errCanaryWithInvalidName = errors.New("Error: Canary with invalid Name ")
 )
 
@@ -70,101 +49,68 @@ var EndpointBackoffSchedule = wait.Backoff{
 	Jitter:   0.0,
 }
 
-// A cheesy logger until we identify a decent Golang logging package.
-func log(msgLevel int, format string, args ...interface{}) {
-	if msgLevel >= debugLevel {
-		leader := fmt.Sprintf("cirith [%s] %s: ",
-			time.Now().UTC().Format(time.RFC3339), levelName(msgLevel))
-		fmt.Fprintf(os.Stdout, leader+format+"\n", args...)
-	}
-}
-
-func levelName(level int) string {
-	if level < LevelMin {
-		level = LevelMin
-	}
-	if level > LevelMax {
-		level = LevelMax
-	}
-	return levelNames[level]
-}
-
-func execute(cmd string, args ...string) *exec.Cmd {
+func execute(logger *zap.SugaredLogger, cmd string, args ...string) *exec.Cmd {
 	concatenatedArgs := strings.Join(args, " ")
-	log(LevelInfo, "execute: %s %s", cmd, concatenatedArgs)
+	logger.Infof("execute: %s %s", cmd, concatenatedArgs)
 	return exec.Command(cmd, args...)
 }
 
-func badRequest(w http.ResponseWriter, s string) {
-	log(LevelInfo, "400 Bad Request: %s", s)
-	w.WriteHeader(400)
-	w.Write([]byte(s + "\r\n"))
+func badRequest(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 400, CodeBadRequest, s)
 }
 
 //The server understood the request but refuses to authorize it.
-func forbiddenError(w http.ResponseWriter, s string) {
-	log(LevelInfo, "403 Forbidden Error: %s", s)
-	w.WriteHeader(403)
-	w.Write([]byte(s + "\r\n"))
+func forbiddenError(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 403, CodeForbidden, s)
 }
 
 //The requested resource could not be found.
-func notFoundError(w http.ResponseWriter, s string) {
-	log(LevelInfo, "404 Not Found: %s", s)
-	w.WriteHeader(404)
-	w.Write([]byte(s + "\r\n"))
+func notFoundError(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 404, CodeNotFound, s)
 }
 
 //The request could not be completed due to a conflict with the current state of the target resource.
-func conflictError(w http.ResponseWriter, s string) {
-	log(LevelInfo, "409 Conflict Error: %s", s)
-	w.WriteHeader(409)
-	w.Write([]byte(s + "\r\n"))
+func conflictError(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 409, CodeConflict, s)
 }
 
-func internalError(w http.ResponseWriter, s string) {
-	log(LevelError, "500 Internal Server Error: %s", s)
-	w.WriteHeader(500)
-	w.Write([]byte(s + "\r\n"))
+func internalError(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 500, CodeInternalError, s)
 }
 
-func serviceUnavailable(w http.ResponseWriter, s string) {
-	log(LevelError, "503 Service Temporarily Unavailable: %s", s)
-	w.WriteHeader(503)
-	w.Write([]byte(s + "\r\n"))
+func serviceUnavailable(w http.ResponseWriter, r *http.Request, s string) {
+	problemError(w, r, 503, CodeServiceUnavailable, s)
 }
 
-func notImplemented(w http.ResponseWriter) {
-	log(LevelInfo, "501 Not Implemented")
-	w.WriteHeader(501)
-	w.Write([]byte("Not Implemented\r\n"))
+func notImplemented(w http.ResponseWriter, r *http.Request) {
+	problemError(w, r, 501, CodeNotImplemented, "Not Implemented")
 }
 
-func success(w http.ResponseWriter, s string) {
-	log(LevelInfo, "200 OK: %s", s)
+func success(w http.ResponseWriter, r *http.Request, s string) {
+	requestLogger(r).Infow("200 OK", "status", 200, "detail", s)
 	w.WriteHeader(200) // yes, it's the default
 	w.Write([]byte(s + "\r\n"))
 }
 
-func accepted(w http.ResponseWriter, s string) {
-	log(LevelInfo, "202 Accepted: %s", s)
+func accepted(w http.ResponseWriter, r *http.Request, s string) {
+	requestLogger(r).Infow("202 Accepted", "status", 202, "detail", s)
 	w.WriteHeader(202)
 	w.Write([]byte(s + "\r\n"))
 }
 
 // Only use this to avoid a unnecessary conversion
-func successBytes(w http.ResponseWriter, bytes []byte) { // it bites ;-)
-	log(LevelInfo, "200 OK: (long content not logged)")
+func successBytes(w http.ResponseWriter, r *http.Request, bytes []byte) { // it bites ;-)
+	requestLogger(r).Infow("200 OK", "status", 200, "detail", "(long content not logged)")
 	w.WriteHeader(200) // yes, it's the default
 	w.Write(bytes)
 }
 
-func saveDataToTempFile(data []byte) (*os.File, error) {
+func saveDataToTempFile(logger *zap.SugaredLogger, data []byte) (*os.File, error) {
 	rand.Seed(time.Now().UnixNano())
 
 	tf, e := os.Create(os.TempDir() + "/cirith-" + strconv.Itoa(rand.Intn(32)))
 	if e != nil {
-		log(LevelError, "cannot create temp file: %v\n", e.Error())
+		logger.Errorf("cannot create temp file: %v", e.Error())
 		return nil, e
 	}
 
@@ -172,11 +118,11 @@ func saveDataToTempFile(data []byte) (*os.File, error) {
 
 	n2, e := tf.Write(data)
 	if e != nil {
-		log(LevelError, "cannot write temp file: %v\n", e.Error())
+		logger.Errorf("cannot write temp file: %v", e.Error())
 		return nil, e
 	}
 
-	log(LevelDebug, "wrote %d bytes into %s\n", n2, tf.Name())
+	logger.Debugf("wrote %d bytes into %s", n2, tf.Name())
 
 	return tf, e
 }
@@ -198,17 +144,17 @@ func Retry(schedule wait.Backoff, fn wait.ConditionFunc) error {
 	return err
 }
 
-func (k *K8s) getNameFromVMISpec() string {
+func (k *K8s) getNameFromVMISpec(logger *zap.SugaredLogger) string {
 	var value = ""
 
 	vmi, e := k.getVMIJson()
 	if e != nil {
-		log(LevelError, "Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
+		logger.Error("Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
 	} else {
 		if vmi.Exists("metadata", "name") {
 			value = vmi.Search("metadata", "name").Data().(string)
 		} else {
-			log(LevelError, "Unable to get name from Verrazzano Monitoring Instance (VMI) Spec.")
+			logger.Error("Unable to get name from Verrazzano Monitoring Instance (VMI) Spec.")
 		}
 
 	}
@@ -216,17 +162,17 @@ func (k *K8s) getNameFromVMISpec() string {
 }
 
 // Set the storage Limits from the current VMI spec
-func (k *K8s) getStorageLimitFromVMISpec(component, limit string) string {
+func (k *K8s) getStorageLimitFromVMISpec(logger *zap.SugaredLogger, component, limit string) string {
 	var value = ""
 
 	vmi, e := k.getVMIJson()
 	if e != nil {
-		log(LevelError, "Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
+		logger.Error("Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
 	} else {
 		if vmi.Exists("spec", component, "resources", limit) {
 			value = vmi.Search("spec", component, "resources", limit).Data().(string)
 		} else {
-			log(LevelError, "Unable to get disk size limits from Verrazzano Monitoring Instance (VMI) Spec.")
+			logger.Error("Unable to get disk size limits from Verrazzano Monitoring Instance (VMI) Spec.")
 		}
 
 	}
@@ -234,17 +180,17 @@ func (k *K8s) getStorageLimitFromVMISpec(component, limit string) string {
 }
 
 // Get the storage capacity from the current VMI spec
-func (k *K8s) getStorageCapacityFromVMISpec(component string) string {
+func (k *K8s) getStorageCapacityFromVMISpec(logger *zap.SugaredLogger, component string) string {
 	var value = ""
 
 	vmi, e := k.getVMIJson()
 	if e != nil {
-		log(LevelError, "Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
+		logger.Error("Unable to get Verrazzano Monitoring Instance (VMI) Spec Json.")
 	} else {
 		if vmi.Exists("spec", component, "storage", "size") {
 			value = vmi.Search("spec", component, "storage", "size").Data().(string)
 		} else {
-			log(LevelError, "Unable to get disk capacity from Verrazzano Monitoring Instance (VMI) Spec.")
+			logger.Error("Unable to get disk capacity from Verrazzano Monitoring Instance (VMI) Spec.")
 		}
 
 	}
@@ -257,45 +203,45 @@ func (k *K8s) getStorageCapacityFromVMISpec(component string) string {
 //      double is limited to a maximum value of maxSize
 //  halve returns and error if current capacity is already at minSizeGb
 //       halve is limited to a minimum of minSizeGb
-func (k *K8s) modifyStorageCapacity(component string, factor float32) (string, error) {
+func (k *K8s) modifyStorageCapacity(logger *zap.SugaredLogger, component string, factor float32) (string, error) {
 
 	var maxSize resource.Quantity
 	var minSize resource.Quantity
 
-	currentStorageCapacity := k.getStorageCapacityFromVMISpec(component)
+	currentStorageCapacity := k.getStorageCapacityFromVMISpec(logger, component)
 
 	currentQuantity, err := resource.ParseQuantity(currentStorageCapacity)
 	if err != nil {
-		log(LevelError, "Error: %v", err)
+		logger.Errorf("Error: %v", err)
 		return currentStorageCapacity, errors.New("Failed to get current storage capacity: " + err.Error())
 	}
-	log(LevelDebug, "currentSize:%v", currentQuantity)
+	logger.Debugf("currentSize:%v", currentQuantity)
 
-	maxSize, err = resource.ParseQuantity(k.getStorageLimitFromVMISpec(component, maxSizeDisk))
+	maxSize, err = resource.ParseQuantity(k.getStorageLimitFromVMISpec(logger, component, maxSizeDisk))
 	if err != nil {
-		log(LevelError, "Using default max size: %v ,%v", defaultMaxSize, err)
+		logger.Errorf("Using default max size: %v ,%v", defaultMaxSize, err)
 		tmpQuantity := resource.NewQuantity(defaultMaxSize*1024*1024*1024, resource.BinarySI)
 		tmpQuantity.DeepCopyInto(&maxSize)
 	}
-	log(LevelDebug, "maxSize:%v", maxSize)
+	logger.Debugf("maxSize:%v", maxSize)
 
-	minSize, err = resource.ParseQuantity(k.getStorageLimitFromVMISpec(component, minSizeDisk))
+	minSize, err = resource.ParseQuantity(k.getStorageLimitFromVMISpec(logger, component, minSizeDisk))
 	if err != nil {
-		log(LevelError, "Using default min size: %v, %v", defaultMinSize, err)
+		logger.Errorf("Using default min size: %v, %v", defaultMinSize, err)
 		tmpQuantity := resource.NewQuantity(defaultMinSize*1024*1024*1024, resource.BinarySI)
 		tmpQuantity.DeepCopyInto(&minSize)
 	}
-	log(LevelDebug, "minSize:%v", minSize)
+	logger.Debugf("minSize:%v", minSize)
 
 	newSize := resource.NewQuantity(int64(float32(currentQuantity.Value())*factor), resource.BinarySI)
-	log(LevelDebug, "newSize:%v", newSize)
+	logger.Debugf("newSize:%v", newSize)
 
 	if newSize.Cmp(maxSize) == 1 {
-		log(LevelError, "Request exceeds maximum disk size: %s", maxSize.String())
+		logger.Errorf("Request exceeds maximum disk size: %s", maxSize.String())
 		return currentStorageCapacity, errors.New("Request exceeds the maximum disk size " + maxSize.String())
 	}
 	if newSize.Cmp(minSize) == -1 {
-		log(LevelError, "Request exceeds minimum disk size allowed: %s", minSize.String())
+		logger.Errorf("Request exceeds minimum disk size allowed: %s", minSize.String())
 		return currentStorageCapacity, errors.New("Request exceeds the minimum disk size " + minSize.String())
 	}
 
@@ -342,22 +288,24 @@ func (k *K8s) getSecretByName(name string) (map[string][]byte, error) {
 
 // getConfigMapByPath looks up the ConfigMap at the given path in the spec, and returns the name and the ConfigMap.
 // Note that the ConfigMap name is required if you want to update the ConfigMap data.
-func (k *K8s) getConfigMapByPath(path string) (string, map[string]string, error) {
+func (k *K8s) getConfigMapByPath(logger *zap.SugaredLogger, path string) (string, map[string]string, error) {
+	defer observeKubernetesAPICall("getConfigMapByPath", time.Now())
 	vmi, err := k.getVMIJson()
 	if err != nil {
-		log(LevelError, "Unable to get Verrazzano Monitoring Instance (VMI) JSON: %v", err)
+		logger.Errorf("Unable to get Verrazzano Monitoring Instance (VMI) JSON: %v", err)
 		return "", nil, err
 	}
 	configMapName := vmi.Path(path).Data().(string)
 	cm, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
 	if err != nil {
-		log(LevelError, "Unable to get ConfigMap %s: %v", configMapName, err)
+		logger.Errorf("Unable to get ConfigMap %s: %v", configMapName, err)
 		return "", nil, err
 	}
 	return configMapName, cm.Data, nil
 }
 
-func (k *K8s) updateConfigMapByName(updatedMap map[string]string, name string) error {
+func (k *K8s) updateConfigMapByName(logger *zap.SugaredLogger, updatedMap map[string]string, name string) error {
+	defer observeKubernetesAPICall("updateConfigMapByName", time.Now())
 	cm, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
 
 	if err != nil {
@@ -383,12 +331,13 @@ func (k *K8s) updateConfigMapByName(updatedMap map[string]string, name string) e
 		if reflect.DeepEqual(cm.Data, updatedMap) {
 			return true, nil
 		}
-		fmt.Println("configmap ", cm.Name, " in namespace ", cm.Namespace, " does not appear updated: ", cm.Data)
+		logger.Debugw("ConfigMap does not appear updated yet", "configmap", cm.Name, "namespace", cm.Namespace)
 		return false, nil
 	})
 
 	if err != nil {
 		if err == wait.ErrWaitTimeout {
+			propagationTimeouts.WithLabelValues("configmap", name).Inc()
 			return fmt.Errorf("verification of the updated configuration timed out %v", defaultWaitTime)
 		}
 		return err
@@ -403,8 +352,9 @@ func (k *K8s) sortKeysFromConfigMap(configMap map[string]string, fileName string
 
 	keyList := make([]string, 0, len(configMap))
 	for k := range configMap {
-		// If a fileName was provided, ignore any keys that don't match the provided filename
-		if fileName != "" && strings.HasPrefix(k, fileName) {
+		// If a fileName was provided, ignore any keys that don't match the provided filename.
+		// Change metadata is stored alongside the versions, but is not a version itself.
+		if fileName != "" && strings.HasPrefix(k, fileName) && !strings.HasSuffix(k, changeMetadataSuffix) {
 			keyList = append(keyList, k)
 		}
 	}
@@ -461,6 +411,7 @@ func (k *K8s) updateSecretByName(updatedSecret map[string][]byte, name string) e
 
 	if err != nil {
 		if err == wait.ErrWaitTimeout {
+			propagationTimeouts.WithLabelValues("secret", name).Inc()
 			return fmt.Errorf("verification of the updated secret timed out %v", defaultWaitTime)
 		}
 		return err
@@ -502,31 +453,31 @@ func ValidateConfigMapKeyName(keyName string) error {
 func Close(c io.Closer) {
 	err := c.Close()
 	if err != nil {
-		log(LevelError, "error closing: %v", err)
+		zap.S().Errorf("error closing: %v", err)
 	}
 }
 
 // makeTar writes a Tar, with one entry for the given data and name, to the given writer
-func makeTar(data []byte, entryName string, writer io.Writer) error {
+func makeTar(logger *zap.SugaredLogger, data []byte, entryName string, writer io.Writer) error {
 	tarWriter := tar.NewWriter(writer)
-	log(LevelDebug, "Created new tar writer")
+	logger.Debug("Created new tar writer")
 	defer Close(tarWriter)
 	hdr := tar.Header{
 		Name: entryName,
 		Mode: 0600,
 		Size: int64(len(data)),
 	}
-	log(LevelDebug, "Created new tar header")
+	logger.Debug("Created new tar header")
 	if err := tarWriter.WriteHeader(&hdr); err != nil {
-		log(LevelError, "problem writing tar header: %v", err)
+		logger.Errorf("problem writing tar header: %v", err)
 		return err
 	}
-	log(LevelDebug, "Wrote tar header")
+	logger.Debug("Wrote tar header")
 	if _, err := tarWriter.Write(data); err != nil {
-		log(LevelError, "problem writing tar body: %v", err)
+		logger.Errorf("problem writing tar body: %v", err)
 		return err
 	}
-	log(LevelInfo, "Created tar for %s (%d bytes)", entryName, len(data))
+	logger.Infof("Created tar for %s (%d bytes)", entryName, len(data))
 	return nil
 }
 
@@ -545,8 +496,8 @@ func within(t1, t2 time.Time, threshold time.Duration) bool {
 
 // copyFile copies the given data to the given directory in the given pod and container.  Note that the destDir
 // must already exist on the container
-func (k *K8s) copyFile(data []byte, fileName string, destDir string, podName string, containerName string) error {
-	log(LevelDebug, "Copying file %s to %s:%s", fileName, podName, containerName)
+func (k *K8s) copyFile(logger *zap.SugaredLogger, data []byte, fileName string, destDir string, podName string, containerName string) error {
+	logger.Debugf("Copying file %s to %s:%s", fileName, podName, containerName)
 
 	// Following approach used by implementation of `kubectl cp`
 	// <https://github.com/kubernetes/kubernetes/blob/master/pkg/kubectl/cmd/cp/cp.go>, create a pipe, and then a
@@ -556,9 +507,9 @@ func (k *K8s) copyFile(data []byte, fileName string, destDir string, podName str
 
 	go func() {
 		defer Close(writer)
-		err := makeTar(data, fileName, writer)
+		err := makeTar(logger, data, fileName, writer)
 		if err != nil {
-			log(LevelError, "Problem making tar: %v", err)
+			logger.Errorf("Problem making tar: %v", err)
 		}
 	}()
 
@@ -578,7 +529,7 @@ func (k *K8s) copyFile(data []byte, fileName string, destDir string, podName str
 		Param("stderr", "true")
 	executor, err := remotecommand.NewSPDYExecutor(k.Config, "POST", request.URL())
 	if err != nil {
-		log(LevelError, "problem executing POST request to copy file: %s", err.Error())
+		logger.Errorf("problem executing POST request to copy file: %s", err.Error())
 		return err
 	}
 	var (
@@ -587,16 +538,16 @@ func (k *K8s) copyFile(data []byte, fileName string, destDir string, podName str
 	)
 	err = executor.Stream(remotecommand.StreamOptions{Stdin: reader, Stdout: &execOut1, Stderr: &execErr1, Tty: false})
 	if err != nil {
-		log(LevelError, "Copying file %s to %s:%s failed: %v", fileName, podName, containerName, err)
+		logger.Errorf("Copying file %s to %s:%s failed: %v", fileName, podName, containerName, err)
 		return err
 	}
-	log(LevelInfo, "Copied file %s to %s:%s", fileName, podName, containerName)
+	logger.Infof("Copied file %s to %s:%s", fileName, podName, containerName)
 	return nil
 }
 
 // deleteFile deletes the file at the given path on the given pod/container.
-func (k *K8s) deleteFile(filePath string, podName string, containerName string) error {
-	log(LevelDebug, "Deleting file %s on %s:%s", filePath, podName, containerName)
+func (k *K8s) deleteFile(logger *zap.SugaredLogger, filePath string, podName string, containerName string) error {
+	logger.Debugf("Deleting file %s on %s:%s", filePath, podName, containerName)
 
 	request := k.ClientSet.CoreV1().RESTClient().Post().
 		Resource("pods").
@@ -611,7 +562,7 @@ func (k *K8s) deleteFile(filePath string, podName string, containerName string)
 		Param("stderr", "true")
 	executor, err := remotecommand.NewSPDYExecutor(k.Config, "POST", request.URL())
 	if err != nil {
-		log(LevelError, "problem executing POST request to send delete-file command: %s", err.Error())
+		logger.Errorf("problem executing POST request to send delete-file command: %s", err.Error())
 		return err
 	}
 	var (
@@ -620,20 +571,20 @@ func (k *K8s) deleteFile(filePath string, podName string, containerName string)
 	)
 	err = executor.Stream(remotecommand.StreamOptions{Stdout: &execOut1, Stderr: &execErr1, Tty: false})
 	if err != nil {
-		log(LevelError, "Deleting file %s:%s:%s failed: %v", podName, containerName, filePath, err)
+		logger.Errorf("Deleting file %s:%s:%s failed: %v", podName, containerName, filePath, err)
 		return err
 	}
-	log(LevelInfo, "Deleted file %s on %s:%s", filePath, podName, containerName)
+	logger.Infof("Deleted file %s on %s:%s", filePath, podName, containerName)
 	return nil
 }
 
 // getNodeIPs returns a list of public IPs for all nodes in the configured cluster.
-func (k *K8s) getNodeIPs() ([]string, error) {
+func (k *K8s) getNodeIPs(logger *zap.SugaredLogger) ([]string, error) {
 
 	// Construct a map of node names => public IPs for easy lookup below
 	nodes, err := k.ClientSet.CoreV1().Nodes().List(context.TODO(), metav1.ListOptions{})
 	if err != nil {
-		log(LevelError, "Unable to list nodes: %v", err)
+		logger.Errorf("Unable to list nodes: %v", err)
 		return []string{}, err
 
 	}
@@ -706,7 +657,7 @@ func sendRequest(action, myURL, host string, headers map[string]string, payload
 func WaitForEndpointAvailable(action, myURL, host string, headers map[string]string, payload string, reqUserName string, reqPassword string) error {
 	var err error
 	expectedStatusCode := http.StatusOK
-	log(LevelInfo, "Waiting for %s to reach status code %d...\n", myURL, expectedStatusCode)
+	zap.S().Infof("Waiting for %s to reach status code %d...", myURL, expectedStatusCode)
 	startTime := time.Now()
 
 	err = Retry(EndpointBackoffSchedule, func() (bool, error) {
@@ -719,7 +670,7 @@ func WaitForEndpointAvailable(action, myURL, host string, headers map[string]str
 		}
 		return false, nil
 	})
-	log(LevelInfo, "Wait time: %s \n", time.Since(startTime))
+	zap.S().Infof("Wait time: %s", time.Since(startTime))
 	if err != nil {
 		return err
 	}
@@ -731,12 +682,12 @@ func WaitForEndpointAvailable(action, myURL, host string, headers map[string]str
 // (PodPhase == PodRunning && [*]ContainerStatus.Ready == true). Note that even through we are ensure that the containers
 // and pod are running, we cannot ensure the pod is actually ready to service requests.
 // See docs for more information: https://kubernetes.io/docs/concepts/workloads/pods/pod-lifecycle/
-func (k *K8s) RestartPodsByLabel(label string, waitTime time.Duration, skipValidation string) error {
+func (k *K8s) RestartPodsByLabel(logger *zap.SugaredLogger, label string, waitTime time.Duration, skipValidation string) error {
 
 	// Following is a hack to skip validation during unit testing, when no container is running
 	vmi, err := k.getVMIJson()
 	if err != nil {
-		log(LevelError, "Unable to get Verrazzano Monitoring Instance (VMI) JSON: %v", err)
+		logger.Errorf("Unable to get Verrazzano Monitoring Instance (VMI) JSON: %v", err)
 		return err
 	}
 
@@ -744,18 +695,18 @@ func (k *K8s) RestartPodsByLabel(label string, waitTime time.Duration, skipValid
 	if skipValidationObj == nil || !skipValidationObj.(bool) {
 		pods, err := k.getPodsByLabel(label)
 		if err != nil {
-			log(LevelError, "RestartPodsByLabel() %s: list pods failed %v", err.Error())
+			logger.Errorw("Unable to list the pods to restart", "label", label, "error", err)
 			return err
 		}
 		if len(pods.Items) == 0 {
 			// This is an error. In case of Restart pod, a pod should exist.
 			errMessage := fmt.Sprintf("no pods with label %s found to restart", label)
-			log(LevelError, errMessage)
+			logger.Error(errMessage)
 			return errors.New(errMessage)
 		}
-		err = k.deletePods(pods)
+		err = k.deletePods(logger, pods)
 		if err != nil {
-			log(LevelError, "RestartPodsByLabel() %s: delete pods failed %v", err.Error())
+			logger.Errorw("Unable to delete the pods to restart", "label", label, "error", err)
 			return err
 		}
 	}
@@ -774,8 +725,8 @@ func (k *K8s) getPodsByLabel(label string) (*corev1.PodList, error) {
 // getReadyPodsByLabel returns a PodList that match the specified label *and* whose overall PodPhase is equal to
 // PodRunning. When allContainersReady is true, it will also ensure that each container in the pod is Ready in addition
 // to verifying the PodPhase.
-func (k *K8s) getReadyPodsByLabel(label string, allContainersReady bool) (*corev1.PodList, error) {
-	log(LevelDebug, "Looking for ready pods with label %s", label)
+func (k *K8s) getReadyPodsByLabel(logger *zap.SugaredLogger, label string, allContainersReady bool) (*corev1.PodList, error) {
+	logger.Debugf("Looking for ready pods with label %s", label)
 	var podsInPhase []corev1.Pod
 	podList, err := k.ClientSet.CoreV1().Pods(namespace).List(context.TODO(), metav1.ListOptions{LabelSelector: label})
 	if err != nil {
@@ -783,28 +734,28 @@ func (k *K8s) getReadyPodsByLabel(label string, allContainersReady bool) (*corev
 	}
 	for i := range podList.Items {
 		if corev1.PodRunning == podList.Items[i].Status.Phase {
-			log(LevelDebug, "pod %s is running", podList.Items[i].Name)
+			logger.Debugf("pod %s is running", podList.Items[i].Name)
 			containersReady := true
 			if allContainersReady {
 				for j := range podList.Items[i].Spec.Containers {
 					if !podList.Items[i].Status.ContainerStatuses[j].Ready {
-						log(LevelDebug, "not accepting pod %s since container %d is NOT ready", podList.Items[i].Name, j)
+						logger.Debugf("not accepting pod %s since container %d is NOT ready", podList.Items[i].Name, j)
 						containersReady = false
 					}
 				}
 				// allContainersReady is true, only add if containers were all found to be ready
 				if containersReady {
-					log(LevelDebug, "accepting pod %s since all its containers are ready", podList.Items[i].Name)
+					logger.Debugf("accepting pod %s since all its containers are ready", podList.Items[i].Name)
 					podsInPhase = append(podsInPhase, podList.Items[i])
 				}
 			} else {
 				// allContainersReady was false, we only have to evaluate pod is in phase
-				log(LevelDebug, "accepting pod %s since it is PodRunning", podList.Items[i].Name)
+				logger.Debugf("accepting pod %s since it is PodRunning", podList.Items[i].Name)
 				podsInPhase = append(podsInPhase, podList.Items[i])
 			}
 
 		} else {
-			log(LevelDebug, "not accepting pod %s since it is NOT PodRunning", podList.Items[i].Name)
+			logger.Debugf("not accepting pod %s since it is NOT PodRunning", podList.Items[i].Name)
 		}
 	}
 	podList.Items = podsInPhase
@@ -814,9 +765,9 @@ func (k *K8s) getReadyPodsByLabel(label string, allContainersReady bool) (*corev
 // deletePods makes a request to delete all pods in the podList sequentially without waiting for each
 // request to be started (or completed). Even though the each pod is deleted sequentially, pods that rely on at least
 // one of the replicas being up at all times for data availability (e.g. AlertManager) should use the deletePod function.
-func (k *K8s) deletePods(podList *corev1.PodList) error {
+func (k *K8s) deletePods(logger *zap.SugaredLogger, podList *corev1.PodList) error {
 	for _, pod := range podList.Items {
-		log(LevelInfo, "deleting pods %s in namespace %s\n", pod.Name, namespace)
+		logger.Infof("deleting pods %s in namespace %s", pod.Name, namespace)
 		if err := k.ClientSet.CoreV1().Pods(pod.Namespace).Delete(context.TODO(), pod.Name, metav1.DeleteOptions{}); err == nil {
 			return err
 		}
@@ -825,7 +776,7 @@ func (k *K8s) deletePods(podList *corev1.PodList) error {
 }
 
 // deletePod deletes a single pod with a given name
-func (k *K8s) deletePod(podName string) error {
-	log(LevelInfo, "deletePod %s in namespace %s\n", podName, namespace)
+func (k *K8s) deletePod(logger *zap.SugaredLogger, podName string) error {
+	logger.Infof("deletePod %s in namespace %s", podName, namespace)
 	return k.ClientSet.CoreV1().Pods(namespace).Delete(context.TODO(), podName, metav1.DeleteOptions{})
 }
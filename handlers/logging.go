@@ -0,0 +1,70 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+
+	"go.uber.org/zap"
+)
+
+// RequestIDHeader header carrying the ID of a request.  The ID is taken from the request if provided, or generated
+// otherwise, and is always echoed in the response.
+const RequestIDHeader = "X-Request-ID"
+
+// Request IDs provided by clients end up in every log line, so only accept reasonable ones.
+var requestIDRegex = regexp.MustCompile(`^[-._:a-zA-Z0-9]{1,128}$`)
+
+type requestIDContextKey struct{}
+type loggerContextKey struct{}
+
+// requestIDMiddleware assigns an ID to every request, and a logger that attaches the ID and the VMI name to every line
+// logged while serving the request.
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !requestIDRegex.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		logger := zap.S().With("requestID", id, "vmi", vmiName, "method", r.Method, "path", r.URL.Path)
+		ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+		ctx = context.WithValue(ctx, loggerContextKey{}, logger)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		zap.S().Errorf("Unable to generate a request ID: %v", err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// requestID returns the ID of the given request, or an empty string if it has none.
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey{}).(string)
+	return id
+}
+
+// requestLogger returns the logger for the given request.
+func requestLogger(r *http.Request) *zap.SugaredLogger {
+	if logger, ok := r.Context().Value(loggerContextKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return zap.S().With("vmi", vmiName, "method", r.Method, "path", r.URL.Path)
+}
+
+// withLogFields returns a shallow copy of the request whose logger also attaches the given fields, such as the
+// resource or version being served.
+func withLogFields(r *http.Request, keysAndValues ...interface{}) *http.Request {
+	logger := requestLogger(r).With(keysAndValues...)
+	return r.WithContext(context.WithValue(r.Context(), loggerContextKey{}, logger))
+}
@@ -0,0 +1,50 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestID(r)
+		requestLogger(r).Infow("Serving request")
+	}))
+
+	tests := []struct {
+		name     string
+		provided string
+		echoed   bool
+	}{
+		{"generated", "", false},
+		{"provided", "3f2c9a1e-7b44-4d0e-9c55-0a1b2c3d4e5f", true},
+		{"invalid", "bad id\nwith newline", false},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/healthcheck", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tt.provided != "" {
+			req.Header.Set(RequestIDHeader, tt.provided)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		id := rr.Header().Get(RequestIDHeader)
+		if id == "" || id != seen {
+			t.Errorf("%s: expected the request ID %q to be echoed, got %q", tt.name, seen, id)
+		}
+		if tt.echoed != (id == tt.provided) {
+			t.Errorf("%s: unexpected request ID %q", tt.name, id)
+		}
+		if !requestIDRegex.MatchString(id) {
+			t.Errorf("%s: invalid request ID %q", tt.name, id)
+		}
+	}
+}
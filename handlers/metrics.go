@@ -0,0 +1,225 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Prefix of all metrics about the API server itself.
+const metricsNamespace = "vmi_api"
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_requests_total",
+		Help:      "Number of HTTP requests, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	promtoolDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "promtool_validation_duration_seconds",
+		Help:      "Duration of promtool validations, by type of file checked.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"type"})
+
+	promtoolFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "promtool_validation_failures_total",
+		Help:      "Number of files that failed promtool validation, by type of file checked.",
+	}, []string{"type"})
+
+	kubernetesAPIDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "kubernetes_api_call_duration_seconds",
+		Help:      "Latency of Kubernetes API calls, by operation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+
+	propagationTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "propagation_timeouts_total",
+		Help:      "Number of ConfigMap or Secret updates that were not observed before the verification poll timed out.",
+	}, []string{"kind", "name"})
+
+	pushgatewayGroupsExpired = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "pushgateway_groups_expired_total",
+		Help:      "Number of PushGateway groups deleted for not being pushed within -pushgatewayGroupTTL.",
+	})
+)
+
+var (
+	configMapEntriesDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "configmap_entries"),
+		"Number of rules files or saved versions in each ConfigMap named in the VMI spec, including its shards.",
+		[]string{"configmap"}, nil)
+
+	configMapSizeBytesDesc = prometheus.NewDesc(prometheus.BuildFQName(metricsNamespace, "", "configmap_size_bytes"),
+		"Size of the data in each ConfigMap, counted the same way as -maxConfigMapDataSize.",
+		[]string{"configmap"}, nil)
+)
+
+// Paths in the VMI spec of the ConfigMaps whose entries and size are reported
+var configMapMetricsPaths = []string{PrometheusConfigMapPath, PrometheusVersionsConfigMapPath,
+	PrometheusRulesConfigMapPath, PrometheusRulesVersionsConfigMapPath}
+
+// configMapCollector reports the entries and size of the ConfigMaps named in the VMI spec, and of their shards.  They
+// are read when the metrics are scraped, so they are reported from startup, whether or not any request touched them.
+type configMapCollector struct {
+	sync.Mutex
+	k *K8s
+}
+
+var configMapMetrics = &configMapCollector{}
+
+func init() {
+	prometheus.MustRegister(httpRequestsTotal, httpRequestDuration, promtoolDuration, promtoolFailures,
+		kubernetesAPIDuration, propagationTimeouts, pushgatewayGroupsExpired, configMapMetrics)
+}
+
+// setClient sets the client the ConfigMaps are read with.  Nothing is reported until it is set.
+func (c *configMapCollector) setClient(k *K8s) {
+	c.Lock()
+	defer c.Unlock()
+	c.k = k
+}
+
+func (c *configMapCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- configMapEntriesDesc
+	ch <- configMapSizeBytesDesc
+}
+
+func (c *configMapCollector) Collect(ch chan<- prometheus.Metric) {
+	c.Lock()
+	k := c.k
+	c.Unlock()
+	if k == nil {
+		return
+	}
+	vmi, err := k.getVMIJson()
+	if err != nil {
+		zap.S().Errorw("Unable to read the VMI for the ConfigMap metrics", "error", err)
+		return
+	}
+	seen := make(map[string]bool)
+	for _, path := range configMapMetricsPaths {
+		name, ok := vmi.Path(path).Data().(string)
+		if !ok || name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		configMap, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), name, metav1.GetOptions{})
+		if err != nil {
+			zap.S().Errorw("Unable to read a ConfigMap for the ConfigMap metrics", "configmap", name, "error", err)
+			continue
+		}
+		shards, err := k.getConfigMapShards(name)
+		if err != nil {
+			zap.S().Errorw("Unable to list the shards of a ConfigMap for the ConfigMap metrics", "configmap", name, "error", err)
+			continue
+		}
+		entries := configMapEntryCount(configMap.Data)
+		ch <- prometheus.MustNewConstMetric(configMapSizeBytesDesc, prometheus.GaugeValue, float64(configMapDataSize(configMap.Data)), name)
+		for _, shard := range shards {
+			entries += configMapEntryCount(shard.Data)
+			ch <- prometheus.MustNewConstMetric(configMapSizeBytesDesc, prometheus.GaugeValue, float64(configMapDataSize(shard.Data)), shard.Name)
+		}
+		ch <- prometheus.MustNewConstMetric(configMapEntriesDesc, prometheus.GaugeValue, float64(entries), name)
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// metricsMiddleware counts and times every request by route template, so that paths with file names in them do not
+// create a new series per file.
+func metricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		code := strconv.Itoa(recorder.status)
+		httpRequestsTotal.WithLabelValues(route, r.Method, code).Inc()
+		httpRequestDuration.WithLabelValues(route, r.Method, code).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeKubernetesAPICall records the latency of a Kubernetes API operation started at the given time.  Meant to be
+// deferred.
+func observeKubernetesAPICall(operation string, start time.Time) {
+	kubernetesAPIDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// observePromtool records the duration and result of a promtool check of the given type of file.
+func observePromtool(fileType string, start time.Time, err error) {
+	promtoolDuration.WithLabelValues(fileType).Observe(time.Since(start).Seconds())
+	if err != nil {
+		promtoolFailures.WithLabelValues(fileType).Inc()
+	}
+}
+
+// configMapEntryCount returns the number of rules files or versions in the data of a ConfigMap, leaving out their
+// change metadata.
+func configMapEntryCount(data map[string]string) int {
+	entries := 0
+	for key := range data {
+		if !strings.HasSuffix(key, changeMetadataSuffix) {
+			entries++
+		}
+	}
+	return entries
+}
+
+// configMapDataSize returns the size of the data of a ConfigMap, counted the same way as -maxConfigMapDataSize.
+func configMapDataSize(data map[string]string) int {
+	size := 0
+	for key, value := range data {
+		size += len(key) + len(value)
+	}
+	return size
+}
@@ -0,0 +1,48 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	vmiName = "vmi-metrics-test"
+	namespace = "vmi-metrics-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	// The ConfigMaps are reported before any request reads them
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `vmi_api_configmap_entries{configmap="vmi-vmi-metrics-test-prometheus-config-versions"} 3`)
+	verify(t, rr, http.StatusOK, `vmi_api_configmap_size_bytes{configmap="vmi-vmi-metrics-test-prometheus-config"}`)
+
+	// Requests are counted by route template, rather than by path
+	req, err = http.NewRequest("GET", "/prometheus/config?version=2018-01-02T15-04-05", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "myconfig1")
+
+	req, err = http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `vmi_api_http_requests_total{code="200",method="GET",route="/prometheus/config"}`)
+	verify(t, rr, http.StatusOK, `vmi_api_http_request_duration_seconds_count{code="200",method="GET",route="/prometheus/config"}`)
+	verify(t, rr, http.StatusOK, `vmi_api_kubernetes_api_call_duration_seconds_count{operation="getConfigMapByPath"}`)
+	verify(t, rr, http.StatusOK, `vmi_api_configmap_entries{configmap="vmi-vmi-metrics-test-prometheus-config-versions"} 3`)
+	verify(t, rr, http.StatusOK, `vmi_api_configmap_size_bytes{configmap="vmi-vmi-metrics-test-prometheus-config-versions"}`)
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"sigs.k8s.io/yaml"
+)
+
+// Media types of the representations served and accepted by the config and rules endpoints, and of the patches
+// accepted by PATCH /prometheus/config
+const (
+	ContentTypeJSON = "application/json"
+	ContentTypeYAML = "application/yaml"
+	ContentTypeText = "text/plain"
+
+	ContentTypeJSONPatch  = "application/json-patch+json"
+	ContentTypeMergePatch = "application/merge-patch+json"
+)
+
+// Other names clients commonly use for YAML
+var yamlMediaTypes = map[string]bool{
+	ContentTypeYAML:      true,
+	"application/x-yaml": true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+type acceptedMediaType struct {
+	mediaType string
+	quality   float64
+}
+
+// preferredContentType returns the media type, JSON, YAML or plain text, preferred by the client according to its
+// Accept header, application/problem+json counting as JSON.  The given default is returned if the client has no
+// preference between them.
+func preferredContentType(r *http.Request, defaultType string) string {
+	var accepted []acceptedMediaType
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil {
+			quality = q
+		}
+		accepted = append(accepted, acceptedMediaType{mediaType: mediaType, quality: quality})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].quality > accepted[j].quality })
+
+	for _, a := range accepted {
+		if a.quality <= 0 {
+			continue
+		}
+		if a.mediaType == ContentTypeJSON || a.mediaType == ProblemContentType {
+			return ContentTypeJSON
+		}
+		if yamlMediaTypes[a.mediaType] {
+			return ContentTypeYAML
+		}
+		if a.mediaType == ContentTypeText {
+			return ContentTypeText
+		}
+	}
+	return defaultType
+}
+
+// successYAML returns a document stored as YAML, such as prometheus.yml or a rules file, converted to JSON if the
+// client prefers it.
+func successYAML(w http.ResponseWriter, r *http.Request, content string) {
+	if preferredContentType(r, ContentTypeYAML) == ContentTypeJSON {
+		b, err := yaml.YAMLToJSON([]byte(content))
+		if err != nil {
+			internalError(w, r, "Unable to convert the stored YAML to JSON: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		successBytes(w, r, b)
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeYAML)
+	success(w, r, content)
+}
+
+// successJSON returns the given value as JSON, or as YAML if the client prefers it.
+func successJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	if preferredContentType(r, ContentTypeJSON) == ContentTypeYAML {
+		b, err := yaml.Marshal(v)
+		if err != nil {
+			internalError(w, r, "Unable to convert the response to YAML: "+err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeYAML)
+		successBytes(w, r, b)
+		return
+	}
+	b, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		internalError(w, r, "Unable to convert the response to JSON: "+err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", ContentTypeJSON)
+	successBytes(w, r, b)
+}
+
+// errUnsupportedMediaType is returned by requestBodyAsYAML for a body that is neither JSON nor YAML.
+var errUnsupportedMediaType = errors.New("the Content-Type must be " + ContentTypeJSON + " or " + ContentTypeYAML)
+
+// requestBodyAsYAML returns the given request body as YAML, converting it from JSON if the request Content-Type says
+// it is JSON.  Bodies with a YAML Content-Type, a text/* one or none at all are taken to be YAML, as they always
+// were; any other Content-Type is rejected with errUnsupportedMediaType.
+func requestBodyAsYAML(r *http.Request, body []byte) ([]byte, error) {
+	contentType := r.Header.Get("Content-Type")
+	if contentType == "" {
+		return body, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	switch {
+	case err != nil:
+		return nil, errUnsupportedMediaType
+	case mediaType == ContentTypeJSON:
+		return yaml.JSONToYAML(body)
+	case yamlMediaTypes[mediaType], strings.HasPrefix(mediaType, "text/"):
+		return body, nil
+	}
+	return nil, errUnsupportedMediaType
+}
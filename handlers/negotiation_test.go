@@ -0,0 +1,117 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreferredContentType(t *testing.T) {
+	tests := []struct {
+		accept   string
+		expected string
+	}{
+		{"", ContentTypeYAML},
+		{"*/*", ContentTypeYAML},
+		{"application/json", ContentTypeJSON},
+		{"text/yaml", ContentTypeYAML},
+		{"application/yaml;q=0.5, application/json", ContentTypeJSON},
+		{"application/json;q=0.2, application/x-yaml;q=0.8", ContentTypeYAML},
+		{"application/json;q=0", ContentTypeYAML},
+		{"application/problem+json", ContentTypeJSON},
+		{"text/plain, application/json;q=0.5", ContentTypeText},
+	}
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", "/prometheus/config", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept", tt.accept)
+		if actual := preferredContentType(req, ContentTypeYAML); actual != tt.expected {
+			t.Errorf("Accept %q: expected %s, got %s", tt.accept, tt.expected, actual)
+		}
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	vmiName = "vmi-negotiation-test"
+	namespace = "vmi-negotiation-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	// YAML by default
+	req, err := http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "scrape_configs:")
+	if contentType := rr.Header().Get("Content-Type"); contentType != ContentTypeYAML {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+
+	// JSON on request
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"scrape_configs":[`)
+	if contentType := rr.Header().Get("Content-Type"); contentType != ContentTypeJSON {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+
+	// Lists are JSON by default, and YAML on request
+	req, err = http.NewRequest("GET", "/prometheus/config/versions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/yaml")
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusVersions).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "versions:\n- version: 2019-05-02T15-04-05")
+	if contentType := rr.Header().Get("Content-Type"); contentType != ContentTypeYAML {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+}
+
+func TestRequestBodyAsYAML(t *testing.T) {
+	req, err := http.NewRequest("PUT", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"global":{"scrape_interval":"20s"}}`)
+
+	// Without a JSON Content-Type, bodies are taken as they are
+	b, err := requestBodyAsYAML(req, body)
+	if err != nil || string(b) != string(body) {
+		t.Errorf("unexpected body %q: %v", b, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	b, err = requestBodyAsYAML(req, body)
+	if err != nil || !strings.Contains(string(b), "global:\n  scrape_interval: 20s") {
+		t.Errorf("unexpected body %q: %v", b, err)
+	}
+
+	if _, err = requestBodyAsYAML(req, []byte(`{"global":`)); err == nil {
+		t.Error("expected invalid JSON to be rejected")
+	}
+
+	// YAML and text/* bodies are taken as they are, anything else is rejected
+	for _, contentType := range []string{ContentTypeYAML, "application/x-yaml", "text/plain; charset=utf-8"} {
+		req.Header.Set("Content-Type", contentType)
+		b, err = requestBodyAsYAML(req, body)
+		if err != nil || string(b) != string(body) {
+			t.Errorf("unexpected body %q for %s: %v", b, contentType, err)
+		}
+	}
+	for _, contentType := range []string{"application/xml", "application/octet-stream", "not a media type"} {
+		req.Header.Set("Content-Type", contentType)
+		if _, err = requestBodyAsYAML(req, body); err != errUnsupportedMediaType {
+			t.Errorf("expected %s to be rejected, got %v", contentType, err)
+		}
+	}
+}
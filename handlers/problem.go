@@ -0,0 +1,143 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ProblemContentType media type of RFC 7807 error responses
+const ProblemContentType = "application/problem+json"
+
+// Base of the type URI of every problem.  The URIs only identify the problem type, they do not need to resolve.
+const problemTypeBase = "https://verrazzano.io/problems/"
+
+// Stable error codes returned in the "code" member of a problem.  Clients can rely on these not changing.
+const (
+	CodeBadRequest                  = "BAD_REQUEST"
+	CodeForbidden                   = "FORBIDDEN"
+	CodeNotFound                    = "NOT_FOUND"
+	CodeConflict                    = "CONFLICT"
+	CodeInternalError               = "INTERNAL_ERROR"
+	CodeNotImplemented              = "NOT_IMPLEMENTED"
+	CodeServiceUnavailable          = "SERVICE_UNAVAILABLE"
+	CodeInvalidFileName             = "INVALID_FILE_NAME"
+	CodeInvalidName                 = "INVALID_NAME"
+	CodeInvalidVersion              = "INVALID_VERSION"
+	CodeInvalidYAML                 = "INVALID_YAML"
+	CodeInvalidJSON                 = "INVALID_JSON"
+	CodeRuleNotFound                = "RULE_NOT_FOUND"
+	CodeTemplateNotFound            = "TEMPLATE_NOT_FOUND"
+	CodeRemoteStorageNotFound       = "REMOTE_STORAGE_NOT_FOUND"
+	CodeVersionNotFound             = "VERSION_NOT_FOUND"
+	CodeRuleValidationFailed        = "RULE_VALIDATION_FAILED"
+	CodeConfigValidationFailed      = "CONFIG_VALIDATION_FAILED"
+	CodeReservedJobRemoved          = "RESERVED_JOB_REMOVED"
+	CodeDeprecatedEndpoint          = "DEPRECATED_ENDPOINT"
+	CodeUnsupportedMediaType        = "UNSUPPORTED_MEDIA_TYPE"
+	CodeInvalidPatch                = "INVALID_PATCH"
+	CodeInvalidRelabelConfig        = "INVALID_RELABEL_CONFIG"
+	CodeJobNotFound                 = "JOB_NOT_FOUND"
+	CodeRevealForbidden             = "REVEAL_FORBIDDEN"
+	CodeSecretPlaceholderUnresolved = "SECRET_PLACEHOLDER_UNRESOLVED"
+	CodeRuleLintFailed              = "RULE_LINT_FAILED"
+	CodeRuleHasDependents           = "RULE_HAS_DEPENDENTS"
+	CodeInvalidRuleTemplate         = "INVALID_RULE_TEMPLATE"
+	CodeInvalidSLO                  = "INVALID_SLO"
+	CodeSLONotFound                 = "SLO_NOT_FOUND"
+	CodeSilenceNotFound             = "SILENCE_NOT_FOUND"
+	CodeReceiverNotFound            = "RECEIVER_NOT_FOUND"
+	CodeInvalidTemplate             = "INVALID_TEMPLATE"
+	CodeInvalidTargetGroup          = "INVALID_TARGET_GROUP"
+	CodeTargetGroupNotFound         = "TARGET_GROUP_NOT_FOUND"
+	CodeInvalidCanary               = "INVALID_CANARY"
+	CodeCanaryNotFound              = "CANARY_NOT_FOUND"
+	CodePushGatewayGroupNotFound    = "PUSHGATEWAY_GROUP_NOT_FOUND"
+	CodeConfigMapFull               = "CONFIGMAP_FULL"
+	CodeConfigMapNotMounted         = "CONFIGMAP_NOT_MOUNTED"
+	CodeSecretNotMounted            = "SECRET_NOT_MOUNTED"
+)
+
+// Problem is an RFC 7807 problem details object, with extension members for the error code, the request ID and, for
+// validation failures, the validator output and the offending line numbers.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"requestID,omitempty"`
+	Output    string `json:"output,omitempty"`
+	Lines     []int  `json:"lines,omitempty"`
+}
+
+// Matches the line numbers in promtool and YAML parser messages, e.g. "yaml: line 12: did not find expected key"
+var problemLineRegex = regexp.MustCompile(`\bline (\d+)`)
+
+// writeProblem writes an error response.  Clients preferring JSON, weighing their Accept header the same way as for
+// successful responses, get a problem+json document; other clients get the detail as plain text, as before.
+func writeProblem(w http.ResponseWriter, r *http.Request, p *Problem) {
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Type == "" {
+		p.Type = problemTypeBase + strings.ToLower(strings.Replace(p.Code, "_", "-", -1))
+	}
+	p.Instance = r.URL.Path
+	p.RequestID = requestID(r)
+
+	logger := requestLogger(r)
+	if p.Status >= http.StatusInternalServerError {
+		logger.Errorw(strconv.Itoa(p.Status)+" "+p.Title, "status", p.Status, "code", p.Code, "detail", p.Detail)
+	} else {
+		logger.Infow(strconv.Itoa(p.Status)+" "+p.Title, "status", p.Status, "code", p.Code, "detail", p.Detail)
+	}
+
+	if preferredContentType(r, ContentTypeText) != ContentTypeJSON {
+		w.WriteHeader(p.Status)
+		w.Write([]byte(p.Detail + "\r\n"))
+		return
+	}
+	b, _ := json.Marshal(p)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(p.Status)
+	w.Write(b)
+}
+
+// problemError writes an error response with the given status and error code.
+func problemError(w http.ResponseWriter, r *http.Request, status int, code string, detail string) {
+	writeProblem(w, r, &Problem{Status: status, Code: code, Detail: detail})
+}
+
+// validationFailed writes a 400 response for content rejected by a validator such as promtool, including the
+// validator output and the line numbers it complains about.
+func validationFailed(w http.ResponseWriter, r *http.Request, code string, detail string, output string) {
+	writeProblem(w, r, &Problem{
+		Status: http.StatusBadRequest,
+		Code:   code,
+		Detail: detail,
+		Output: output,
+		Lines:  problemLines(output),
+	})
+}
+
+// problemLines returns the distinct line numbers mentioned in the given validator output, in order of appearance.
+func problemLines(output string) []int {
+	var lines []int
+	seen := make(map[int]bool)
+	for _, match := range problemLineRegex.FindAllStringSubmatch(output, -1) {
+		line, err := strconv.Atoi(match[1])
+		if err != nil || seen[line] {
+			continue
+		}
+		seen[line] = true
+		lines = append(lines, line)
+	}
+	return lines
+}
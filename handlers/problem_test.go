@@ -0,0 +1,118 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestProblemResponses(t *testing.T) {
+	vmiName = "vmi-problem-test"
+	namespace = "vmi-problem-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	// Clients not asking for JSON still get plain text
+	req, err := http.NewRequest("GET", "/prometheus/config?version=bob", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "ERROR: The version timestamp provided is not valid.")
+	if strings.HasPrefix(rr.Body.String(), "{") {
+		t.Errorf("expected a plain text error, got %s", rr.Body.String())
+	}
+
+	// Clients asking for JSON get a problem with a stable code
+	req.Header.Set("Accept", "application/problem+json, text/plain;q=0.5")
+	req.Header.Set(RequestIDHeader, "problem-test-1")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusBadRequest)
+	if contentType := rr.Header().Get("Content-Type"); contentType != ProblemContentType {
+		t.Errorf("unexpected Content-Type %q", contentType)
+	}
+	var problem Problem
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Status != http.StatusBadRequest || problem.Code != CodeInvalidVersion || problem.Title != "Bad Request" ||
+		problem.Instance != "/prometheus/config" || problem.RequestID != "problem-test-1" ||
+		problem.Type != "https://verrazzano.io/problems/invalid-version" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+
+	// Clients refusing JSON, or preferring plain text, still get plain text
+	for _, accept := range []string{"application/json;q=0, text/plain", "text/plain, application/problem+json;q=0.5"} {
+		req.Header.Set("Accept", accept)
+		rr = httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		verify(t, rr, http.StatusBadRequest, "ERROR: The version timestamp provided is not valid.")
+		if contentType := rr.Header().Get("Content-Type"); contentType == ProblemContentType {
+			t.Errorf("Accept %q: expected a plain text error, got %s", accept, rr.Body.String())
+		}
+	}
+
+	// Removing a reserved scrape job is reported as such
+	body := `global:
+  scrape_interval: 20s
+rule_files:
+  - '/etc/prometheus/rules/*.rules'
+scrape_configs:
+  - job_name: prometheus
+`
+	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusBadRequest)
+	problem = Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != CodeReservedJobRemoved {
+		t.Errorf("expected code %s, got %+v", CodeReservedJobRemoved, problem)
+	}
+
+	// Invalid YAML reports the offending line
+	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader("global:\n  scrape_interval: 20s\n bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusBadRequest)
+	problem = Problem{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != CodeInvalidYAML || len(problem.Lines) == 0 || problem.Output == "" {
+		t.Errorf("unexpected problem: %+v", problem)
+	}
+}
+
+func TestProblemLines(t *testing.T) {
+	output := `Checking /tmp/cirith-1
+  FAILED:
+yaml: unmarshal errors:
+  line 3: field foo not found in type rulefmt.RuleGroups
+  line 9: field bar not found in type rulefmt.RuleGroups
+  line 3: field baz not found in type rulefmt.RuleGroups`
+	if lines := problemLines(output); !reflect.DeepEqual(lines, []int{3, 9}) {
+		t.Errorf("unexpected lines %v", lines)
+	}
+	if lines := problemLines("SUCCESS"); lines != nil {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql"
+)
+
+// This can be set from the command line via -prometheusURL.  It defaults to the Prometheus service of the VMI.
+var prometheusURL string
+
+// getPrometheusURL returns the base URL of the Prometheus HTTP API.
+func getPrometheusURL() string {
+	if prometheusURL != "" {
+		return strings.TrimSuffix(prometheusURL, "/")
+	}
+	return "http://vmi-" + vmiName + "-prometheus:9090"
+}
+
+// PrometheusSeries is a series returned by a Prometheus query.  Value is set for instant queries, as a
+// [timestamp, "value"] pair, and Values for range queries.
+type PrometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Value  []interface{}     `json:"value,omitempty"`
+	Values [][]interface{}   `json:"values,omitempty"`
+}
+
+// LastValue returns the value of an instant query series, or the last value of a range query series.
+func (series PrometheusSeries) LastValue() float64 {
+	sample := series.Value
+	if len(series.Values) > 0 {
+		sample = series.Values[len(series.Values)-1]
+	}
+	if len(sample) != 2 {
+		return 0
+	}
+	s, _ := sample[1].(string)
+	value, _ := strconv.ParseFloat(s, 64)
+	return value
+}
+
+type prometheusAPIResponse struct {
+	Status    string          `json:"status"`
+	Data      json.RawMessage `json:"data"`
+	ErrorType string          `json:"errorType,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+type prometheusQueryData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+// prometheusAPIGet calls the given endpoint of the Prometheus HTTP API, e.g. "/api/v1/rules", and decodes the data of
+// the response.
+func prometheusAPIGet(apiPath string, params url.Values, data interface{}) error {
+	apiURL := getPrometheusURL() + apiPath
+	if len(params) > 0 {
+		apiURL += "?" + params.Encode()
+	}
+	resp, body, err := sendRequest("GET", apiURL, "", map[string]string{"Accept": ContentTypeJSON}, "", "", "")
+	if err != nil {
+		return err
+	}
+	var response prometheusAPIResponse
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return fmt.Errorf("unexpected response from Prometheus, status %d: %v", resp.StatusCode, err)
+	}
+	if response.Status != "success" {
+		return fmt.Errorf("Prometheus returned %s: %s", response.ErrorType, response.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Prometheus returned status %d", resp.StatusCode)
+	}
+	return json.Unmarshal(response.Data, data)
+}
+
+// queryPrometheus runs an instant query, or a range query if params has a start, and returns the series found.
+// Scalar and string results are returned as a single series with no labels.
+func queryPrometheus(params url.Values) ([]PrometheusSeries, error) {
+	apiPath := "/api/v1/query"
+	if params.Get("start") != "" {
+		apiPath = "/api/v1/query_range"
+	}
+	var data prometheusQueryData
+	if err := prometheusAPIGet(apiPath, params, &data); err != nil {
+		return nil, err
+	}
+	switch data.ResultType {
+	case "scalar", "string":
+		var value []interface{}
+		if err := json.Unmarshal(data.Result, &value); err != nil {
+			return nil, err
+		}
+		return []PrometheusSeries{{Metric: map[string]string{}, Value: value}}, nil
+	default:
+		series := make([]PrometheusSeries, 0)
+		if err := json.Unmarshal(data.Result, &series); err != nil {
+			return nil, err
+		}
+		return series, nil
+	}
+}
+
+// prometheusQueryFunc runs the instant queries of templates, such as {{ query "up" }}, against the Prometheus HTTP API.
+func prometheusQueryFunc(ctx context.Context, query string, ts time.Time) (promql.Vector, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	params.Set("time", strconv.FormatFloat(float64(ts.UnixNano())/1e9, 'f', -1, 64))
+	series, err := queryPrometheus(params)
+	if err != nil {
+		return nil, err
+	}
+	vector := make(promql.Vector, 0, len(series))
+	for _, s := range series {
+		vector = append(vector, promql.Sample{
+			Point:  promql.Point{T: ts.UnixNano() / int64(time.Millisecond), V: s.LastValue()},
+			Metric: labels.FromMap(s.Metric),
+		})
+	}
+	return vector, nil
+}
@@ -0,0 +1,116 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"bytes"
+	"errors"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+var errPrometheusConfigNotMapping = errors.New("the Prometheus configuration is not a YAML mapping")
+
+// setPrometheusConfigListItem replaces the item of a top-level list of prometheus.yml whose key field has the given
+// value, such as the scrape job with job_name canary-api, or appends it if there is none.  A nil item removes it, along
+// with the list if it is left empty.  Only that item is rewritten: comments and the order of keys elsewhere in the file
+// are kept.  It returns the new prometheus.yml, and whether the item was found.
+func setPrometheusConfigListItem(content string, list string, key string, value string, item interface{}) ([]byte, bool, error) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(content), &document); err != nil {
+		return nil, false, err
+	}
+	if document.Kind == 0 {
+		document = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return nil, false, errPrometheusConfigNotMapping
+	}
+
+	var itemNode *yamlv3.Node
+	if item != nil {
+		itemNode = &yamlv3.Node{}
+		if err := itemNode.Encode(item); err != nil {
+			return nil, false, err
+		}
+	}
+
+	// Find the list, adding it if needed
+	listIndex := -1
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == list {
+			listIndex = i
+			break
+		}
+	}
+	if listIndex < 0 {
+		if itemNode == nil {
+			return []byte(content), false, nil
+		}
+		root.Content = append(root.Content, &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: list},
+			&yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"})
+		listIndex = len(root.Content) - 2
+	}
+	items := root.Content[listIndex+1]
+	if items.Kind != yamlv3.SequenceNode {
+		// An empty list, e.g. "scrape_configs:"
+		*items = yamlv3.Node{Kind: yamlv3.SequenceNode, Tag: "!!seq"}
+	}
+
+	found := false
+	for i, existing := range items.Content {
+		if !hasMappingValue(existing, key, value) {
+			continue
+		}
+		found = true
+		if itemNode == nil {
+			items.Content = append(items.Content[:i], items.Content[i+1:]...)
+		} else {
+			// Keep the comments around the item
+			itemNode.HeadComment, itemNode.LineComment, itemNode.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+			items.Content[i] = itemNode
+		}
+		break
+	}
+	if !found && itemNode != nil {
+		items.Content = append(items.Content, itemNode)
+	}
+	if itemNode == nil && len(items.Content) == 0 {
+		root.Content = append(root.Content[:listIndex], root.Content[listIndex+2:]...)
+	}
+
+	b, err := encodePrometheusConfig(&document)
+	if err != nil {
+		return nil, false, err
+	}
+	return b, found, nil
+}
+
+// encodePrometheusConfig returns the YAML of a prometheus.yml document, with its comments.
+func encodePrometheusConfig(document *yamlv3.Node) ([]byte, error) {
+	var b bytes.Buffer
+	encoder := yamlv3.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// hasMappingValue returns whether a YAML node is a mapping with the given scalar value for key.
+func hasMappingValue(node *yamlv3.Node, key string, value string) bool {
+	if node.Kind != yamlv3.MappingNode {
+		return false
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1].Kind == yamlv3.ScalarNode && node.Content[i+1].Value == value
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+const editTestConfig = `# Managed by the platform team
+global:
+  scrape_interval: 20s # keep in sync with the dashboards
+scrape_configs:
+# The Prometheus server itself
+- job_name: prometheus
+  static_configs:
+  - targets: ['localhost:9090']
+- job_name: canary-api
+  scrape_interval: 1m
+`
+
+func TestSetPrometheusConfigListItem(t *testing.T) {
+	// Replace an item, keeping the comments and the order of keys of the rest of the file
+	b, found, err := setPrometheusConfigListItem(editTestConfig, "scrape_configs", "job_name", "canary-api",
+		map[string]interface{}{"job_name": "canary-api", "scrape_interval": "5m"})
+	if err != nil || !found {
+		t.Fatalf("expected the job to be replaced, got %v, %v", found, err)
+	}
+	config := string(b)
+	for _, expected := range []string{"# Managed by the platform team", "# keep in sync with the dashboards",
+		"# The Prometheus server itself", "scrape_interval: 5m"} {
+		if !strings.Contains(config, expected) {
+			t.Errorf("expected %q in %s", expected, config)
+		}
+	}
+	if strings.Index(config, "global:") > strings.Index(config, "scrape_configs:") || strings.Contains(config, "scrape_interval: 1m") {
+		t.Errorf("unexpected configuration: %s", config)
+	}
+
+	// Add one, creating its list
+	b, found, err = setPrometheusConfigListItem(config, "remote_write", "name", "thanos", map[string]interface{}{"name": "thanos", "url": "http://thanos"})
+	if err != nil || found || !strings.Contains(string(b), "remote_write:\n  - name: thanos") {
+		t.Errorf("expected the endpoint to be added, got %v, %v: %s", found, err, b)
+	}
+
+	// And remove it, along with its list
+	b, found, err = setPrometheusConfigListItem(string(b), "remote_write", "name", "thanos", nil)
+	if err != nil || !found || strings.Contains(string(b), "remote_write") {
+		t.Errorf("expected the endpoint to be removed, got %v, %v: %s", found, err, b)
+	}
+	if _, found, _ = setPrometheusConfigListItem(string(b), "remote_write", "name", "thanos", nil); found {
+		t.Error("expected no endpoint to be found")
+	}
+	if _, _, err = setPrometheusConfigListItem("- not a mapping", "scrape_configs", "job_name", "x", nil); err == nil {
+		t.Error("expected a configuration that is not a mapping to be rejected")
+	}
+}
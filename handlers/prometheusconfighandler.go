@@ -4,10 +4,10 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"mime"
 	"net/http"
 	"os"
 	"regexp"
@@ -15,6 +15,8 @@ import (
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
+	jsonpatch "github.com/evanphx/json-patch"
+	"go.uber.org/zap"
 	"sigs.k8s.io/yaml"
 )
 
@@ -28,8 +30,12 @@ var (
 	errPrometheusConfigJobKubernetesPodsNotDefined = errors.New("Error: Prometheus YAML does not have job scrape_configs[2].job_name=kubernetes-pods defined. Please do a get of the existing Prometheus config file and append to it")
 )
 
-// GetPrometheusConfig returns the Prometheus configuration.
+// GetPrometheusConfig returns the Prometheus configuration, with its secrets redacted unless revealed.
 func (k *K8s) GetPrometheusConfig(w http.ResponseWriter, r *http.Request) {
+	reveal, ok := revealRequested(w, r)
+	if !ok {
+		return
+	}
 
 	mapPath := PrometheusConfigMapPath
 	configName := "prometheus-config"
@@ -39,12 +45,13 @@ func (k *K8s) GetPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 	var version string
 	if len(r.FormValue("version")) > 0 {
 		version = r.FormValue("version")
+		r = withLogFields(r, "version", version)
 
 		// Validate the timestamp
 		re, _ := regexp.Compile("^[0-9-T]*$")
 		actVersion := re.ReplaceAllString(version, "")
 		if actVersion != "" {
-			badRequest(w, "ERROR: The version timestamp provided is not valid.")
+			problemError(w, r, http.StatusBadRequest, CodeInvalidVersion, "ERROR: The version timestamp provided is not valid.")
 			return
 		}
 
@@ -54,18 +61,18 @@ func (k *K8s) GetPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Get the proper configMap
-	_, configMap, err := k.getConfigMapByPath(mapPath)
+	_, configMap, err := k.getShardedConfigMapByPath(requestLogger(r), mapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read %s ConfigMap: %v", configName, err))
+		internalError(w, r, fmt.Sprintf("Unable to read %s ConfigMap: %v", configName, err))
 		return
 	}
 
 	// Respond appropriately if the configmap is empty.
 	if len(configMap) == 0 {
 		if configName == "prometheus-config" {
-			internalError(w, "The "+configName+" configMap appears to be empty.")
+			internalError(w, r, "The "+configName+" configMap appears to be empty.")
 		} else {
-			notFoundError(w, "No older versions of the Prometheus configuration were found.")
+			problemError(w, r, http.StatusNotFound, CodeVersionNotFound, "No older versions of the Prometheus configuration were found.")
 		}
 		return
 	}
@@ -73,23 +80,29 @@ func (k *K8s) GetPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 	// Results were returned, look for the requested key
 	configValue := configMap[keyName]
 	if len(configValue) == 0 {
-		notFoundError(w, "Unable to find the requested Prometheus configuration.")
+		problemError(w, r, http.StatusNotFound, CodeVersionNotFound, "Unable to find the requested Prometheus configuration.")
 		return
 	}
-	success(w, configValue)
+	if !reveal {
+		configValue, err = redactPrometheusConfig(configValue)
+		if err != nil {
+			internalError(w, r, "Unable to redact the secrets of the Prometheus configuration: "+err.Error())
+			return
+		}
+	}
+	successYAML(w, r, configValue)
 }
 
 // GetPrometheusVersions returns the Prometheus version.
 func (k *K8s) GetPrometheusVersions(w http.ResponseWriter, r *http.Request) {
 
-	var result []byte
-	resultMap := make(map[string][]string)
-	resultMap["versions"] = make([]string, 0)
+	resultMap := make(map[string][]VersionInfo)
+	resultMap["versions"] = make([]VersionInfo, 0)
 
 	// Get the prometheus-config-versions ConfigMap
-	_, configMap, err := k.getConfigMapByPath(PrometheusVersionsConfigMapPath)
+	_, configMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusVersionsConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read prometheus-config-versions ConfigMap: %v", err))
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config-versions ConfigMap: %v", err))
 		return
 	}
 
@@ -97,69 +110,185 @@ func (k *K8s) GetPrometheusVersions(w http.ResponseWriter, r *http.Request) {
 	// We only want to return the timestamps
 	keyList := k.sortKeysFromConfigMap(configMap, PrometheusConfigFileName)
 
-	// If no keys are found, then we have no saved configs
-	if len(keyList) == 0 {
-		success(w, "No older versions of the Prometheus configuration were found.")
-		return
-	}
 	for k := range keyList {
-		resultMap["versions"] = append(resultMap["versions"], strings.Replace(keyList[k], PrometheusConfigFileName+"-", "", 1))
+		resultMap["versions"] = append(resultMap["versions"], getVersionInfo(requestLogger(r), configMap, keyList[k], PrometheusConfigFileName))
 	}
-	result, _ = json.MarshalIndent(resultMap, "", "\t")
-	successBytes(w, result)
+	successJSON(w, r, resultMap)
 
 }
 
 // PutPrometheusConfig saves the Prometheus configuration.
+// The change metadata provided with the request is saved alongside the backup of the replaced configuration.
 func (k *K8s) PutPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 	b, e := ioutil.ReadAll(r.Body)
 	if e != nil {
-		internalError(w, "Unable to read request Body: "+e.Error())
+		internalError(w, r, "Unable to read request Body: "+e.Error())
+		return
+	}
+	b, e = requestBodyAsYAML(r, b)
+	if e == errUnsupportedMediaType {
+		problemError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"The Content-Type must be "+ContentTypeJSON+" or "+ContentTypeYAML)
+		return
+	}
+	if e != nil {
+		validationFailed(w, r, CodeInvalidJSON, "Unable to convert the provided JSON to YAML: "+e.Error(), e.Error())
+		return
+	}
+	k.savePrometheusConfig(w, r, b)
+}
+
+// PatchPrometheusConfig applies a JSON Patch (RFC 6902) or a JSON merge patch (RFC 7396) to the Prometheus
+// configuration, and saves the result as PutPrometheusConfig would.
+func (k *K8s) PatchPrometheusConfig(w http.ResponseWriter, r *http.Request) {
+	patch, e := ioutil.ReadAll(r.Body)
+	if e != nil {
+		internalError(w, r, "Unable to read request Body: "+e.Error())
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != ContentTypeJSONPatch && mediaType != ContentTypeMergePatch {
+		problemError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"The Content-Type must be "+ContentTypeJSONPatch+" or "+ContentTypeMergePatch)
+		return
+	}
+
+	_, currentConfigMap, err := k.getConfigMapByPath(requestLogger(r), PrometheusConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	current, e := yaml.YAMLToJSON([]byte(currentConfigMap[PrometheusConfigFileName]))
+	if e != nil {
+		internalError(w, r, "Unable to convert the current Prometheus configuration to JSON: "+e.Error())
+		return
+	}
+
+	var patched []byte
+	if mediaType == ContentTypeJSONPatch {
+		var jsonPatch jsonpatch.Patch
+		jsonPatch, e = jsonpatch.DecodePatch(patch)
+		if e == nil {
+			patched, e = jsonPatch.Apply(current)
+		}
+	} else {
+		patched, e = jsonpatch.MergePatch(current, patch)
+	}
+	if e != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidPatch, "Unable to apply the patch to the Prometheus configuration: "+e.Error())
 		return
 	}
 
+	b, e := yaml.JSONToYAML(patched)
+	if e != nil {
+		internalError(w, r, "Unable to convert the patched Prometheus configuration to YAML: "+e.Error())
+		return
+	}
+	k.savePrometheusConfig(w, r, b)
+}
+
+// savePrometheusConfig validates the given prometheus.yml, saves a backup of the current one along with the change
+// metadata provided with the request, and replaces it.  Secret placeholders are replaced by the current secrets.
+// It returns whether the given configuration is now current.
+func (k *K8s) savePrometheusConfig(w http.ResponseWriter, r *http.Request, b []byte) bool {
+	changed, problem := k.replacePrometheusConfig(r, b)
+	if problem != nil {
+		writeProblem(w, r, problem)
+		return false
+	}
+	prometheusConfigSaved(w, r, changed)
+	return true
+}
+
+// prometheusConfigSaved writes the response to a saved prometheus.yml.
+func prometheusConfigSaved(w http.ResponseWriter, r *http.Request, changed bool) {
+	if !changed {
+		success(w, r, "The provided body is identical to the current Prometheus configuration. No action will be taken.")
+		return
+	}
+	// returning HTTP status "202: Accepted".
+	// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
+	// before the response is sent.
+	accepted(w, r, "The Prometheus configuration is being updated.")
+}
+
+// replacePrometheusConfig does the work of savePrometheusConfig, without writing the response.  It returns whether
+// the configuration changed, or the problem rejecting it.
+func (k *K8s) replacePrometheusConfig(r *http.Request, b []byte) (bool, *Problem) {
+	b, problem := k.validatePrometheusConfig(r, b)
+	if problem != nil {
+		return false, problem
+	}
+	return k.storePrometheusConfig(r, b)
+}
+
+// validatePrometheusConfig checks the given prometheus.yml, with its secret placeholders replaced by the current
+// secrets, and returns it as it is to be saved, or the problem rejecting it.
+func (k *K8s) validatePrometheusConfig(r *http.Request, b []byte) ([]byte, *Problem) {
+	// Placeholders left by redaction stand for the current secrets
+	if strings.Contains(string(b), SecretPlaceholder) {
+		_, currentConfigMap, err := k.getConfigMapByPath(requestLogger(r), PrometheusConfigMapPath)
+		if err != nil {
+			return nil, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+				Detail: fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err)}
+		}
+		restored, err := restoreRedactedSecrets(b, currentConfigMap[PrometheusConfigFileName])
+		if err != nil {
+			return nil, &Problem{Status: http.StatusBadRequest, Code: CodeSecretPlaceholderUnresolved,
+				Detail: "Prometheus configuration was not updated. " + err.Error()}
+		}
+		b = restored
+	}
+
 	// Convert provided update in the body to json and parse
 	jsonObject, e := yaml.YAMLToJSON(b)
 	if e != nil {
-		badRequest(w, "Unable to convert the provided YAML to JSON: "+e.Error())
-		return
+		return nil, &Problem{Status: http.StatusBadRequest, Code: CodeInvalidYAML,
+			Detail: "Unable to convert the provided YAML to JSON: " + e.Error(), Output: e.Error(), Lines: problemLines(e.Error())}
 	}
 	jsonParsedObj, e := gabs.ParseJSON([]byte(string(jsonObject)))
 	if e != nil {
-		internalError(w, "Unable to parse JSON: "+e.Error())
-		return
+		return nil, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: "Unable to parse JSON: " + e.Error()}
 	}
 
 	// Validate this is a proper prometheus yaml. i.e. customers have not removed stuff added by VMI Team.
 	if validStatus, e := ValidateVMIPrometheusElements(jsonParsedObj); e != nil || !validStatus {
-		badRequest(w, "Prometheus configuration was not updated. Reserved section of prometheus.yml was altered: "+e.Error())
-		return
+		return nil, &Problem{Status: http.StatusBadRequest, Code: reservedConfigErrorCode(e),
+			Detail: "Prometheus configuration was not updated. Reserved section of prometheus.yml was altered: " + e.Error()}
 	}
 
 	// Validate with promtool
-	promOut, e := checkPrometheusConfig(b)
-	log(LevelInfo, "%s\n", promOut)
+	promOut, e := checkPrometheusConfig(requestLogger(r), b)
+	requestLogger(r).Infow("promtool check config", "output", string(promOut))
 	if e != nil {
-		badRequest(w, "Prometheus configuration was not updated.  Failed to validate with promtool: "+string(promOut)+" :ErrorMsg: "+e.Error())
-		return
+		return nil, &Problem{Status: http.StatusBadRequest, Code: CodeConfigValidationFailed,
+			Detail: "Prometheus configuration was not updated.  Failed to validate with promtool: " + string(promOut) + " :ErrorMsg: " + e.Error(),
+			Output: string(promOut), Lines: problemLines(string(promOut))}
 	}
+	return b, nil
+}
 
+// storePrometheusConfig saves a backup of the current prometheus.yml, along with its change metadata, and replaces it with
+// the given one, already validated, recording the change metadata provided with the request.  It returns whether the configuration changed.
+func (k *K8s) storePrometheusConfig(r *http.Request, b []byte) (bool, *Problem) {
 	// Get the configmaps
-	currentConfigMapName, currentConfigMap, err := k.getConfigMapByPath(PrometheusConfigMapPath)
+	currentConfigMapName, currentConfigMap, err := k.getConfigMapByPath(requestLogger(r), PrometheusConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
-		return
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err)}
 	}
-	savedConfigMapName, savedConfigMap, err := k.getConfigMapByPath(PrometheusVersionsConfigMapPath)
+	savedConfigMapName, savedConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusVersionsConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read prometheus-config-versions ConfigMap: %v", err))
-		return
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: fmt.Sprintf("Unable to read prometheus-config-versions ConfigMap: %v", err)}
 	}
 
-	// Special check... did the user make any changes?  If not, take no action and exit
-	if currentConfigMap[PrometheusConfigFileName] == string(b) {
-		success(w, "The provided body is identical to the current Prometheus configuration. No action will be taken.")
-		return
+	setAuditContent(r, currentConfigMap[PrometheusConfigFileName], string(b))
+
+	// Special check... did the user make any changes?  If not, take no action and exit.  The line break ending the
+	// configuration as returned by GET does not count.
+	if strings.TrimRight(currentConfigMap[PrometheusConfigFileName], "\r\n") == strings.TrimRight(string(b), "\r\n") {
+		return false, nil
 	}
 
 	// Copy the current prometheus.yml to the versions ConfigMap
@@ -172,6 +301,7 @@ func (k *K8s) PutPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 		savedConfigMap = make(map[string]string)
 	}
 	savedConfigMap[keyName] = currentConfigMap[PrometheusConfigFileName]
+	saveChangeMetadata(savedConfigMap, PrometheusConfigFileName, keyName, getChangeMetadata(r))
 
 	// How many backups do we have?  Do we need to delete any old ones?
 	// K8S configmaps have limited space; very large configs can fill the versions configMap.
@@ -185,29 +315,36 @@ func (k *K8s) PutPrometheusConfig(w http.ResponseWriter, r *http.Request) {
 			}
 			// Delete any backups that are MaxBackupHours or older.
 			if k.isOldVersion(keyList[j], PrometheusConfigFileName, timeNow) {
-				delete(savedConfigMap, keyList[j])
+				deleteVersion(savedConfigMap, keyList[j])
 			}
 		}
 	}
 
 	// Okay, updating the older configMap is completed.  Save it!
-	e = k.updateConfigMapByName(savedConfigMap, savedConfigMapName)
+	e := k.updateShardedConfigMapByName(requestLogger(r), savedConfigMap, savedConfigMapName)
 	if e != nil {
-		internalError(w, "Unable to save a backup of prometheus.yml to prometheus-config-versions ConfigMap. "+e.Error())
-		return
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: "Unable to save a backup of prometheus.yml to prometheus-config-versions ConfigMap. " + e.Error()}
 	}
 
 	// Finally, update the current Configmap with the new version (validated) provided by the user
 	currentConfigMap[PrometheusConfigFileName] = string(b)
-	e = k.updateConfigMapByName(currentConfigMap, currentConfigMapName)
+	e = k.updateConfigMapByName(requestLogger(r), currentConfigMap, currentConfigMapName)
 	if e != nil {
-		internalError(w, "Unable to update prometheus-config ConfigMap: "+e.Error())
-		return
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: "Unable to update prometheus-config ConfigMap: " + e.Error()}
 	}
-	// returning HTTP status "202: Accepted".
-	// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
-	// before the response is sent.
-	accepted(w, "The Prometheus configuration is being updated.")
+	return true, nil
+}
+
+// reservedConfigErrorCode returns the error code for a configuration rejected by ValidateVMIPrometheusElements.
+func reservedConfigErrorCode(e error) string {
+	switch e {
+	case errPrometheusConfigJobsNotDefined, errPrometheusConfigJobPrometheusNotDefined,
+		errPrometheusConfigJobPushGatewayNotDefined, errPrometheusConfigJobKubernetesPodsNotDefined:
+		return CodeReservedJobRemoved
+	}
+	return CodeConfigValidationFailed
 }
 
 // ValidateVMIPrometheusElements validates the Prometheus configuration.
@@ -215,7 +352,6 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 	var scrapeConfig = "scrape_configs"
 	var jobNameParameter = "job_name"
 	var configString = g.String()
-	log(LevelInfo, "%s", "Prometheus Config: "+g.String())
 
 	if configString == "null" {
 		return false, errPrometheusConfigEmptyFile
@@ -229,7 +365,7 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 
 	noOfScrapeConfigs, e := g.ArrayCountP(scrapeConfig)
 	if e != nil {
-		log(LevelError, "%s", "Unable to read scrape configs: "+e.Error())
+		zap.S().Error("Unable to read scrape configs: " + e.Error())
 		return false, e
 	}
 	if noOfScrapeConfigs < 3 {
@@ -239,7 +375,7 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 	jobNameElement, e := g.ArrayElementP(0, scrapeConfig)
 	jobName := jobNameElement.Path(jobNameParameter).Data().(string)
 	if e != nil || jobName == "" {
-		log(LevelError, "%s", "Unable to read scrape config job_name: prometheus: "+e.Error())
+		zap.S().Error("Unable to read scrape config job_name: prometheus: " + e.Error())
 		return false, e
 	}
 
@@ -250,7 +386,7 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 	jobNameElement, e = g.ArrayElementP(1, scrapeConfig)
 	jobName = jobNameElement.Path(jobNameParameter).Data().(string)
 	if e != nil || jobName == "" {
-		log(LevelError, "%s", "Unable to read scrape config job_name: PushGateway: "+e.Error())
+		zap.S().Error("Unable to read scrape config job_name: PushGateway: " + e.Error())
 		return false, e
 	}
 
@@ -261,7 +397,7 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 	jobNameElement, e = g.ArrayElementP(2, scrapeConfig)
 	jobName = jobNameElement.Path(jobNameParameter).Data().(string)
 	if e != nil || jobName == "" {
-		log(LevelError, "%s", "Unable to read scrape config job_name: kubernetes-pods: "+e.Error())
+		zap.S().Error("Unable to read scrape config job_name: kubernetes-pods: " + e.Error())
 		return false, e
 	}
 
@@ -272,19 +408,21 @@ func ValidateVMIPrometheusElements(g *gabs.Container) (bool, error) {
 	return true, nil
 }
 
-func checkPrometheusConfig(b []byte) ([]byte, error) {
+func checkPrometheusConfig(logger *zap.SugaredLogger, b []byte) ([]byte, error) {
 
-	tf, e := saveDataToTempFile(b)
+	tf, e := saveDataToTempFile(logger, b)
 	if e != nil {
-		log(LevelError, "failed to create temp file: %v \n", e)
+		logger.Errorf("failed to create temp file: %v", e)
 		return nil, e
 	}
 	defer os.Remove(tf.Name())
 
-	promtoolCommand := execute(promtoolPath, "check", "config", tf.Name())
+	start := time.Now()
+	promtoolCommand := execute(logger, promtoolPath, "check", "config", tf.Name())
 	promtoolOutput, err := promtoolCommand.CombinedOutput()
+	observePromtool("config", start, err)
 	if err != nil {
-		log(LevelDebug, "%s check config %s failed: (%s) %v\n",
+		logger.Debugf("%s check config %s failed: (%s) %v",
 			promtoolPath, tf.Name(), promtoolOutput, err)
 	}
 	return promtoolOutput, err
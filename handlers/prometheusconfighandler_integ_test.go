@@ -8,8 +8,11 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"reflect"
 	"strings"
 	"testing"
+
+	"go.uber.org/zap"
 )
 
 func TestPutPrometheusConfigHandler(t *testing.T) {
@@ -90,7 +93,7 @@ scrape_configs:
 	}
 
 	// Verify we get three versions files back
-	var versionsMap map[string][]string
+	var versionsMap map[string][]VersionInfo
 	err = json.Unmarshal([]byte(rr.Body.String()), &versionsMap)
 	if err != nil {
 		t.Fatal(err)
@@ -126,10 +129,11 @@ scrape_configs:
 	verify(t, rr, http.StatusBadRequest, "Invalid Prometheus YAML: it does not have the mandatory name global.scrape_interval.")
 
 	// Run the PUT command
-	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader(testBody))
+	req, err = http.NewRequest("PUT", "/prometheus/config?ticket=OPS-42", strings.NewReader(testBody))
 	if err != nil {
 		t.Fatal(err)
 	}
+	req.Header.Set("X-Change-Author", "jdoe")
 
 	rr = httptest.NewRecorder()
 	handler = http.HandlerFunc(testclient.PutPrometheusConfig)
@@ -160,6 +164,8 @@ scrape_configs:
 	}
 	if len(versionsMap["versions"]) != 4 {
 		t.Errorf("handler returned an unexpected number of versions: expected 3. Output: %v", versionsMap["versions"])
+	} else if newest := versionsMap["versions"][0]; newest.Author != "" {
+		t.Errorf("expected no change metadata for the version created before the API server: %v", newest)
 	}
 
 	// Verify the prometheus-config ConfigMap was updated succcessfully
@@ -186,6 +192,29 @@ scrape_configs:
 
 	// Check the status code and content is what we expect.
 	verify(t, rr, http.StatusOK, "The provided body is identical to the current Prometheus configuration.")
+
+	// Replacing the configuration again saves it with the change metadata of the PUT that created it
+	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader(strings.Replace(testBody, "fake_NEW_NAME", "fake_OTHER_NAME", 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.PutPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	req, err = http.NewRequest("GET", "/prometheus/config/versions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusVersions).ServeHTTP(rr, req)
+	versionsMap = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &versionsMap); err != nil {
+		t.Fatal(err)
+	}
+	if newest := versionsMap["versions"][0]; newest.Author != "jdoe" || newest.Ticket != "OPS-42" {
+		t.Errorf("handler returned unexpected change metadata for the newest version: %v", newest)
+	}
 }
 
 func TestPutBadPrometheusConfig(t *testing.T) {
@@ -227,3 +256,200 @@ scrape_configs:
 	expectedMessage := "Error: Prometheus YAML does not have scrape_configs jobs defined."
 	verify(t, rr, http.StatusBadRequest, expectedMessage)
 }
+
+func TestPatchPrometheusConfigHandler(t *testing.T) {
+
+	vmiName = "vmi-prom-test"
+	namespace = "vmi-prom-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	handler := http.HandlerFunc(testclient.PatchPrometheusConfig)
+
+	req, err := http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	original := rr.Body.String()
+	if strings.Contains(original, "scrape_interval: 30s") {
+		t.Fatalf("the original configuration is already patched: %s", original)
+	}
+
+	// JSON Patch
+	req, err = http.NewRequest("PATCH", "/prometheus/config",
+		strings.NewReader(`[{"op": "replace", "path": "/global/scrape_interval", "value": "30s"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json-patch+json")
+	req.Header.Set("X-Change-Comment", "Scrape less often")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	// The configuration replaced is saved as the newest version
+	newest := getNewestTestPrometheusVersion(t, testclient)
+	if newest != original {
+		t.Errorf("expected the newest version to be the configuration before the patch, got %s", newest)
+	}
+
+	// Merge patch
+	req, err = http.NewRequest("PATCH", "/prometheus/config",
+		strings.NewReader(`{"remote_write": [{"url": "https://metrics.example.com/api/v1/write"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/merge-patch+json")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	// Both changes are applied, and the rest of the configuration is kept
+	req, err = http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "scrape_interval: 30s")
+	verify(t, rr, http.StatusOK, "https://metrics.example.com/api/v1/write")
+	verify(t, rr, http.StatusOK, "__meta_kubernetes_pod_annotation_fakekdev_io_scrape")
+
+	// The merge patch saved the configuration patched by the first.  Versions are named by the second, so it may have
+	// replaced the version saved by the first patch.
+	newest = getNewestTestPrometheusVersion(t, testclient)
+	if !strings.Contains(newest, "scrape_interval: 30s") || strings.Contains(newest, "https://metrics.example.com/api/v1/write") {
+		t.Errorf("expected the newest version to be the configuration before the merge patch, got %s", newest)
+	}
+}
+
+// getNewestTestPrometheusVersion returns the content of the newest saved version of the Prometheus configuration.
+func getNewestTestPrometheusVersion(t *testing.T, testclient *K8s) string {
+	req, err := http.NewRequest("GET", "/prometheus/config/versions", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusVersions).ServeHTTP(rr, req)
+	var versions map[string][]VersionInfo
+	if err := json.Unmarshal(rr.Body.Bytes(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	if len(versions["versions"]) < 4 {
+		t.Fatalf("expected a new version, got %+v", versions["versions"])
+	}
+
+	req, err = http.NewRequest("GET", "/prometheus/config?version="+versions["versions"][0].Version, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusOK)
+	return rr.Body.String()
+}
+
+func TestPutRedactedPrometheusConfig(t *testing.T) {
+
+	vmiName = "vmi-prom-test"
+	namespace = "vmi-prom-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	// Give the federation job a password
+	configMapName, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap[PrometheusConfigFileName] = strings.Replace(configMap[PrometheusConfigFileName], "   scheme: http\n",
+		"   scheme: http\n   basic_auth:\n     username: federator\n     password: s3cr3t\n", 1)
+	if err := testclient.updateConfigMapByName(zap.S(), configMap, configMapName); err != nil {
+		t.Fatal(err)
+	}
+
+	// Read it redacted, and write it back with a change
+	req, err := http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "password: <secret>")
+	redacted := strings.Replace(rr.Body.String(), "scrape_interval: 120s", "scrape_interval: 60s", 1)
+
+	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader(redacted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.PutPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	// The password is kept
+	_, configMap, err = testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := configMap[PrometheusConfigFileName]
+	if !strings.Contains(config, "password: s3cr3t") || !strings.Contains(config, "scrape_interval: 60s") {
+		t.Errorf("unexpected prometheus.yml: %s", config)
+	}
+}
+
+func TestPutUnchangedRedactedPrometheusConfig(t *testing.T) {
+
+	vmiName = "vmi-prom-test"
+	namespace = "vmi-prom-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	// Give the federation job a password
+	configMapName, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap[PrometheusConfigFileName] = strings.Replace(configMap[PrometheusConfigFileName], "   scheme: http\n",
+		"   scheme: http\n   basic_auth:\n     username: federator\n     password: s3cr3t\n", 1)
+	if err := testclient.updateConfigMapByName(zap.S(), configMap, configMapName); err != nil {
+		t.Fatal(err)
+	}
+	before := configMap[PrometheusConfigFileName]
+	_, versionsBefore, err := testclient.getShardedConfigMapByPath(zap.S(), PrometheusVersionsConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Read it redacted, and write it back as it is
+	req, err := http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "password: <secret>")
+
+	req, err = http.NewRequest("PUT", "/prometheus/config", strings.NewReader(rr.Body.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(testclient.PutPrometheusConfig).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "The provided body is identical to the current Prometheus configuration.")
+
+	// Neither the configuration nor its versions changed
+	_, configMap, err = testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if configMap[PrometheusConfigFileName] != before {
+		t.Errorf("expected prometheus.yml to be unchanged, got %s", configMap[PrometheusConfigFileName])
+	}
+	_, versionsAfter, err := testclient.getShardedConfigMapByPath(zap.S(), PrometheusVersionsConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versionsAfter, versionsBefore) {
+		t.Errorf("expected no new version, got %v", versionsAfter)
+	}
+}
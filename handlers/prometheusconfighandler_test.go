@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/Jeffail/gabs/v2"
@@ -66,9 +67,17 @@ func TestGetPrometheusVersionsHandler(t *testing.T) {
 	namespace = "vmi-prom-test"
 	expectedOutput := `{
 	"versions": [
-		"2019-05-02T15-04-05",
-		"2018-01-02T15-04-05",
-		"2016-02-02T15-04-05"
+		{
+			"version": "2019-05-02T15-04-05"
+		},
+		{
+			"version": "2018-01-02T15-04-05",
+			"author": "jdoe",
+			"comment": "Scrape every 5s"
+		},
+		{
+			"version": "2016-02-02T15-04-05"
+		}
 	]
 }`
 	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
@@ -83,6 +92,60 @@ func TestGetPrometheusVersionsHandler(t *testing.T) {
 	verify(t, rr, http.StatusOK, expectedOutput)
 }
 
+func TestPutPrometheusConfigUnsupportedMediaType(t *testing.T) {
+
+	vmiName = "vmi-prom-test"
+	namespace = "vmi-prom-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	req, err := http.NewRequest("PUT", "/prometheus/config", strings.NewReader("<global><scrape_interval>10s</scrape_interval></global>"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/xml")
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testclient.PutPrometheusConfig)
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusUnsupportedMediaType, "The Content-Type must be application/json or application/yaml")
+}
+
+func TestPatchPrometheusConfigHandlerErrors(t *testing.T) {
+
+	vmiName = "vmi-prom-test"
+	namespace = "vmi-prom-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+
+	// Not a patch
+	req, err := http.NewRequest("PATCH", "/prometheus/config", strings.NewReader("global:\n  scrape_interval: 10s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testclient.PatchPrometheusConfig)
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusUnsupportedMediaType, "The Content-Type must be application/json-patch+json or application/merge-patch+json")
+
+	// A JSON Patch that does not apply
+	req, err = http.NewRequest("PATCH", "/prometheus/config", strings.NewReader(`[{"op": "replace", "path": "/no/such", "value": 1}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", ContentTypeJSONPatch)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "Unable to apply the patch to the Prometheus configuration")
+
+	// A merge patch that removes a reserved job
+	req, err = http.NewRequest("PATCH", "/prometheus/config", strings.NewReader(`{"scrape_configs": [{"job_name": "prometheus"}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", ContentTypeMergePatch)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "Reserved section of prometheus.yml was altered")
+}
+
 // ##############################################################################################
 //  PROMETHEUS CONFIG HANDLER TEST UTILITIES
 // ##############################################################################################
@@ -186,5 +249,7 @@ func getDefaultPrometheusVersionsMap(keyName string) map[string]string {
 	value2 := "myconfig2"
 	value3 := "myconfig3"
 
-	return map[string]string{key1: value1, key2: value2, key3: value3}
+	meta1 := `{"author":"jdoe","comment":"Scrape every 5s"}`
+
+	return map[string]string{key1: value1, key1 + changeMetadataSuffix: meta1, key2: value2, key3: value3}
 }
@@ -4,7 +4,6 @@
 package handlers
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/ioutil"
@@ -17,6 +16,7 @@ import (
 	"time"
 
 	"github.com/Jeffail/gabs/v2"
+	"go.uber.org/zap"
 	"sigs.k8s.io/yaml"
 )
 
@@ -32,21 +32,15 @@ var (
 // GetPrometheusRuleNames returns a JSON with names of all current Prometheus rules files.
 func (k *K8s) GetPrometheusRuleNames(w http.ResponseWriter, r *http.Request) {
 
-	var result []byte
 	resultMap := make(map[string][]string)
 	resultMap["alertrules"] = make([]string, 0)
 
 	// Get the current alertrules configmap
-	_, configMap, err := k.getConfigMapByPath(PrometheusRulesConfigMapPath)
+	_, configMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
 		return
 	}
-	if len(configMap) == 0 {
-		success(w, "No Prometheus alert rules were found.")
-		return
-	}
-
 	// Grab all the keys from the configmap and return a sorted list.
 	ruleNames := make([]string, len(configMap))
 	i := 0
@@ -58,35 +52,34 @@ func (k *K8s) GetPrometheusRuleNames(w http.ResponseWriter, r *http.Request) {
 	for k := range ruleNames {
 		resultMap["alertrules"] = append(resultMap["alertrules"], ruleNames[k])
 	}
-	result, _ = json.MarshalIndent(resultMap, "", "\t")
-	successBytes(w, result)
+	successJSON(w, r, resultMap)
 }
 
 // GetPrometheusRuleVersions takes the user-provided rule file name and
 // returns a JSON with all available versions of that file.
 func (k *K8s) GetPrometheusRuleVersions(w http.ResponseWriter, r *http.Request) {
 
-	var result []byte
-	resultMap := make(map[string][]string)
-	resultMap["versions"] = make([]string, 0)
+	resultMap := make(map[string][]VersionInfo)
+	resultMap["versions"] = make([]VersionInfo, 0)
 
 	fileName := path.Base(path.Dir(r.URL.Path))
+	r = withLogFields(r, "resource", fileName)
 
 	// Validate the file name provided
 	if !strings.HasSuffix(fileName, ".rules") {
-		badRequest(w, "ERROR: The file name provided must end with: .rules")
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: The file name provided must end with: .rules")
 		return
 	}
 	err := validateName(fileName)
 	if err != nil {
-		badRequest(w, "ERROR: Invalid File Name: "+err.Error())
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+err.Error())
 		return
 	}
 
 	// Go check that the user requested a real rules file
-	_, currentConfigMap, err := k.getConfigMapByPath(PrometheusRulesConfigMapPath)
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
 		return
 	}
 	exists := false
@@ -96,40 +89,27 @@ func (k *K8s) GetPrometheusRuleVersions(w http.ResponseWriter, r *http.Request)
 		}
 	}
 	if !exists {
-		notFoundError(w, "ERROR: Unable to find a current Prometheus Alert rule called: "+fileName)
+		problemError(w, r, http.StatusNotFound, CodeRuleNotFound, "ERROR: Unable to find a current Prometheus Alert rule called: "+fileName)
 		return
 	}
 
 	// Get the saved configmap
-	_, savedConfigMap, err := k.getConfigMapByPath(PrometheusRulesVersionsConfigMapPath)
+	_, savedConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesVersionsConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
-		return
-	}
-	// Exit immediately if there are no saved rules - this is not an error
-	if len(savedConfigMap) == 0 {
-		success(w, "No older versions of the Prometheus alert rule were found.")
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
 		return
 	}
-
 	// Search the saved configmap for any matching alert rules
 	// If any keys are found, stuff the timestamp in the resultMap map
 	keyList := k.sortKeysFromConfigMap(savedConfigMap, fileName)
 	if len(keyList) != 0 {
 		for k := range keyList {
-			resultMap["versions"] = append(resultMap["versions"], strings.Replace(keyList[k], fileName+"-", "", 1))
+			resultMap["versions"] = append(resultMap["versions"], getVersionInfo(requestLogger(r), savedConfigMap, keyList[k], fileName))
 		}
 	}
 
-	// Return a friendly message if no older versions were found.
-	if len(resultMap["versions"]) == 0 {
-		success(w, "No older versions of the Prometheus alert rule were found.")
-		return
-	}
-
 	// Return a JSON of the timestamps found
-	result, _ = json.MarshalIndent(resultMap, "", "\t")
-	successBytes(w, result)
+	successJSON(w, r, resultMap)
 }
 
 // GetPrometheusRules returns the contents of the requested Alert Rules file.
@@ -140,17 +120,18 @@ func (k *K8s) GetPrometheusRules(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the file
 	fileName := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", fileName)
 	if fileName == "" {
-		badRequest(w, "ERROR:  No file name was provided.")
+		badRequest(w, r, "ERROR:  No file name was provided.")
 		return
 	}
 	if !strings.Contains(fileName, ".rules") {
-		badRequest(w, "ERROR:  The requested file does not appear to be a valid file name.")
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR:  The requested file does not appear to be a valid file name.")
 		return
 	}
 	err := validateName(fileName)
 	if err != nil {
-		badRequest(w, "ERROR: Invalid File Name: "+err.Error())
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+err.Error())
 		return
 	}
 
@@ -158,20 +139,21 @@ func (k *K8s) GetPrometheusRules(w http.ResponseWriter, r *http.Request) {
 	var version = ""
 	if len(r.FormValue("version")) > 0 {
 		version = r.FormValue("version")
+		r = withLogFields(r, "version", version)
 
 		// Validate the timestamp
 		re, _ := regexp.Compile("^[0-9-T]*$")
 		actVersion := re.ReplaceAllString(version, "")
 		if actVersion != "" {
-			badRequest(w, "ERROR: The version timestamp provided is not valid.")
+			problemError(w, r, http.StatusBadRequest, CodeInvalidVersion, "ERROR: The version timestamp provided is not valid.")
 			return
 		}
 	}
 
 	// Go check that the user requested a real rules file
-	_, configMap, err := k.getConfigMapByPath(PrometheusRulesConfigMapPath)
+	_, configMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
 		return
 	}
 	exists := false
@@ -181,16 +163,16 @@ func (k *K8s) GetPrometheusRules(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if !exists {
-		notFoundError(w, "Unable to find a current Prometheus Alert rule called: "+fileName)
+		problemError(w, r, http.StatusNotFound, CodeRuleNotFound, "Unable to find a current Prometheus Alert rule called: "+fileName)
 		return
 	}
 
 	// Was a timestamp provided?
 	// This means the user wants the contents of an older saved version
 	if version != "" {
-		_, configMap, err = k.getConfigMapByPath(PrometheusRulesVersionsConfigMapPath)
+		_, configMap, err = k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesVersionsConfigMapPath)
 		if err != nil {
-			internalError(w, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
+			internalError(w, r, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
 			return
 		}
 		configName = "alertrules-versions"
@@ -200,20 +182,18 @@ func (k *K8s) GetPrometheusRules(w http.ResponseWriter, r *http.Request) {
 	// Go get the requested file
 	for k, v := range configMap {
 		if k == fileName {
-			log(LevelDebug, "%s", "Found requested file: "+fileName+" in "+configName+" configMap")
-			success(w, v)
+			requestLogger(r).Debug("Found requested file: " + fileName + " in " + configName + " configMap")
+			successYAML(w, r, v)
 			return
 		}
 	}
 
 	// If not found, return an appropriate error...
-	error := ""
 	if version != "" {
-		error = "Unable to find the requested file version: " + version
+		problemError(w, r, http.StatusNotFound, CodeVersionNotFound, "Unable to find the requested file version: "+version)
 	} else {
-		error = "Unable to find the requested alert rules file: " + fileName
+		problemError(w, r, http.StatusNotFound, CodeRuleNotFound, "Unable to find the requested alert rules file: "+fileName)
 	}
-	notFoundError(w, error)
 }
 
 // DeletePrometheusRules removes the requested current Alert Rules file.
@@ -222,30 +202,36 @@ func (k *K8s) DeletePrometheusRules(w http.ResponseWriter, r *http.Request) {
 
 	// Validate the file
 	fileName := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", fileName)
 	if fileName == "" {
-		badRequest(w, "ERROR:  No file name was provided.")
+		badRequest(w, r, "ERROR:  No file name was provided.")
 		return
 	}
 	if !strings.HasSuffix(fileName, ".rules") {
-		badRequest(w, "ERROR: File name must end with: .rules")
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: File name must end with: .rules")
 		return
 	}
 	err := validateName(fileName)
 	if err != nil {
-		badRequest(w, "ERROR: Unable to validate the provided file name.")
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Unable to validate the provided file name.")
 		return
 	}
+	k.deletePrometheusRules(w, r, fileName)
+}
 
+// deletePrometheusRules deletes a rules file and all its versions, and writes the response.  It returns whether the
+// rules file was removed from the alertrules ConfigMap.
+func (k *K8s) deletePrometheusRules(w http.ResponseWriter, r *http.Request, fileName string) bool {
 	// Go get the configmaps
-	currentConfigMapName, currentConfigMap, err := k.getConfigMapByPath(PrometheusRulesConfigMapPath)
+	currentConfigMapName, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
-		return
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		return false
 	}
-	savedConfigMapName, savedConfigMap, err := k.getConfigMapByPath(PrometheusRulesVersionsConfigMapPath)
+	savedConfigMapName, savedConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesVersionsConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
-		return
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
+		return false
 	}
 
 	// One-time step:  need to initialize the empty map the first time
@@ -256,167 +242,216 @@ func (k *K8s) DeletePrometheusRules(w http.ResponseWriter, r *http.Request) {
 	// Go find the file we want to delete
 	for j := range currentConfigMap {
 		if j == fileName {
-			log(LevelDebug, "%s", "Found existing file: "+fileName+" in alertrules configMap")
+			requestLogger(r).Debug("Found existing file: " + fileName + " in alertrules configMap")
+			orphanWarnings, problem := checkOrphanedRules(r, fileName, "", currentConfigMap)
+			if problem != nil {
+				writeProblem(w, r, problem)
+				return false
+			}
+			setAuditContent(r, currentConfigMap[j], "")
 
 			// Delete the current version.
 			delete(currentConfigMap, j)
-			e := k.updateConfigMapByName(currentConfigMap, currentConfigMapName)
+			e := k.updateMountedConfigMapByName(requestLogger(r), currentConfigMap, currentConfigMapName)
 			if e != nil {
-				internalError(w, "Unable to update alertrules ConfigMap. "+e.Error())
-				return
+				configMapUpdateFailed(w, r, "Unable to update alertrules ConfigMap.", e)
+				return false
 			}
 
-			// Delete all the saved versions too
+			// Delete all the saved versions too, and the change metadata of the current one
 			keyList := k.sortKeysFromConfigMap(savedConfigMap, fileName)
 			for s := range keyList {
-				delete(savedConfigMap, keyList[s])
+				deleteVersion(savedConfigMap, keyList[s])
 			}
-			e = k.updateConfigMapByName(savedConfigMap, savedConfigMapName)
+			delete(savedConfigMap, fileName+changeMetadataSuffix)
+			e = k.updateShardedConfigMapByName(requestLogger(r), savedConfigMap, savedConfigMapName)
 			if e != nil {
-				internalError(w, "Unable to update alertrules-versions ConfigMap. "+e.Error())
-				return
+				internalError(w, r, "Unable to update alertrules-versions ConfigMap. "+e.Error())
+				return true
 			}
 
+			// The versions are gone, so the change metadata of the deletion is only kept in the audit record of the request.
+			metadata := getChangeMetadata(r)
+			requestLogger(r).Infow("Alert rule deleted", "author", metadata.Author, "comment", metadata.Comment, "ticket", metadata.Ticket)
+
 			// returning HTTP status "202: Accepted".
 			// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
 			// before the response is sent.
-			accepted(w, "The current alert rule: "+fileName+" and all older versions are being deleted.")
-			return
+			accepted(w, r, "The current alert rule: "+fileName+" and all older versions are being deleted."+orphanWarnings)
+			return true
 		}
 	}
-	notFoundError(w, "No action taken. Unable to find a current alert rule called: "+fileName)
+	problemError(w, r, http.StatusNotFound, CodeRuleNotFound, "No action taken. Unable to find a current alert rule called: "+fileName)
+	return false
 }
 
 // PutPrometheusUnnamedRules PUT /prometheus/rules has been deprecated.  Return a friendly error message instead.
 func (k *K8s) PutPrometheusUnnamedRules(w http.ResponseWriter, r *http.Request) {
-	badRequest(w, fmt.Sprintf("ERROR:  This endpoint has been deprecated in Cirith v1.\nPlease use:  PUT /prometheus/rules/%s", unnamedRules))
+	problemError(w, r, http.StatusBadRequest, CodeDeprecatedEndpoint, fmt.Sprintf("ERROR:  This endpoint has been deprecated in Cirith v1.\nPlease use:  PUT /prometheus/rules/%s", unnamedRules))
 }
 
 // PutPrometheusRules updates the requested Alert Rules file with the provided body.
-// If not a new rule, save a backup copy of the current rule.
+// If not a new rule, save a backup copy of the current rule, along with the change metadata provided with the request.
 func (k *K8s) PutPrometheusRules(w http.ResponseWriter, r *http.Request) {
 	b, e := ioutil.ReadAll(r.Body)
 	if e != nil {
-		internalError(w, "ERROR: Unable to read request Body.")
+		internalError(w, r, "ERROR: Unable to read request Body.")
+		return
+	}
+	b, e = requestBodyAsYAML(r, b)
+	if e == errUnsupportedMediaType {
+		problemError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMediaType,
+			"ERROR: The Content-Type must be "+ContentTypeJSON+" or "+ContentTypeYAML+".")
+		return
+	}
+	if e != nil {
+		validationFailed(w, r, CodeInvalidJSON, "ERROR: Unable to convert JSON to YAML.", e.Error())
 		return
 	}
 
 	// Validate the provided file name
 	fileName := path.Base(r.URL.Path)
-	if fileName == "" {
-		badRequest(w, "ERROR:  No file name was provided.")
+	r = withLogFields(r, "resource", fileName)
+	if !validateRulesFileName(w, r, fileName) {
 		return
 	}
+	k.savePrometheusRules(w, r, fileName, b)
+}
+
+// validateRulesFileName checks the name of a rules file, and writes a 400 response if it is invalid.
+func validateRulesFileName(w http.ResponseWriter, r *http.Request, fileName string) bool {
+	if fileName == "" {
+		badRequest(w, r, "ERROR:  No file name was provided.")
+		return false
+	}
 	if fileName == ".rules" {
-		badRequest(w, "ERROR: Invalid file name.")
-		return
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid file name.")
+		return false
 	}
 	if !strings.HasSuffix(fileName, ".rules") {
-		badRequest(w, "ERROR: File name must end with: .rules")
-		return
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: File name must end with: .rules")
+		return false
 	}
-	e = validateName(fileName)
-	if e != nil {
-		badRequest(w, "ERROR: The file name provided is invalid.")
-		return
+	if validateName(fileName) != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: The file name provided is invalid.")
+		return false
 	}
+	return true
+}
 
+// checkPrometheusRuleFile validates a rules file on its own, and returns the problem with it, if any.
+func checkPrometheusRuleFile(r *http.Request, b []byte) *Problem {
 	// Convert provided update in the body to json and parse
 	jsonObject, e := yaml.YAMLToJSON(b)
 	if e != nil {
-		badRequest(w, "ERROR: Unable to convert YAML to JSON.")
-		return
+		return &Problem{Status: http.StatusBadRequest, Code: CodeInvalidYAML, Detail: "ERROR: Unable to convert YAML to JSON.",
+			Output: e.Error(), Lines: problemLines(e.Error())}
 	}
 	jsonParsedObj, e := gabs.ParseJSON([]byte(string(jsonObject)))
 	if e != nil {
-		internalError(w, "Unable to parse JSON")
-		return
+		return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: "Unable to parse JSON"}
 	}
 
 	// Validate this is a proper Rule file.
 	if validStatus, e := ValidatePrometheusRuleElements(jsonParsedObj); e != nil || !validStatus {
-		badRequest(w, "No action taken. Did not create/update Rule: "+e.Error())
-		return
+		return &Problem{Status: http.StatusBadRequest, Code: CodeRuleValidationFailed, Detail: "No action taken. Did not create/update Rule: " + e.Error()}
 	}
 
 	// Validate with promtool
-	promOut, e := checkPrometheusRules(b)
-	log(LevelDebug, "%s\n", promOut)
+	promOut, e := checkPrometheusRules(requestLogger(r), b)
+	requestLogger(r).Debugw("promtool check rules", "output", string(promOut))
 	if e != nil {
-		badRequest(w, "No action taken.  Failed to validate with promtool: "+string(promOut)+" :ErrorMsg: "+e.Error())
-		return
+		return &Problem{Status: http.StatusBadRequest, Code: CodeRuleValidationFailed,
+			Detail: "No action taken.  Failed to validate with promtool: " + string(promOut) + " :ErrorMsg: " + e.Error(),
+			Output: string(promOut), Lines: problemLines(string(promOut))}
+	}
+	return nil
+}
+
+// checkRuleFileAgainstOthers checks a rules file against the rule lint policy and the other current rules files.  It
+// returns the warnings to report, or the problem rejecting the file.
+func (k *K8s) checkRuleFileAgainstOthers(r *http.Request, fileName string, b []byte, current map[string]string) (string, *Problem) {
+	lintWarnings, problem := k.lintPutRules(r, fileName, b, current)
+	if problem != nil {
+		return "", problem
+	}
+	orphanWarnings, problem := checkOrphanedRules(r, fileName, string(b), current)
+	if problem != nil {
+		return "", problem
+	}
+	return lintWarnings + orphanWarnings, nil
+}
+
+// savePrometheusRules validates and saves a rules file, keeping a version of the file replaced, and writes the response.
+func (k *K8s) savePrometheusRules(w http.ResponseWriter, r *http.Request, fileName string, b []byte) bool {
+	if problem := checkPrometheusRuleFile(r, b); problem != nil {
+		writeProblem(w, r, problem)
+		return false
 	}
 
 	// Go get the configmaps
-	currentConfigMapName, currentConfigMap, err := k.getConfigMapByPath(PrometheusRulesConfigMapPath)
+	currentConfigMapName, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
-		return
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		return false
 	}
-	savedConfigMapName, savedConfigMap, err := k.getConfigMapByPath(PrometheusRulesVersionsConfigMapPath)
+	savedConfigMapName, savedConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesVersionsConfigMapPath)
 	if err != nil {
-		internalError(w, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
-		return
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
+		return false
+	}
+
+	// Check the rules against the lint policy, and the other rules files
+	warnings, problem := k.checkRuleFileAgainstOthers(r, fileName, b, currentConfigMap)
+	if problem != nil {
+		writeProblem(w, r, problem)
+		return false
 	}
 
 	// One-time step:  need to initialize the empty map the first time
 	if savedConfigMap == nil {
 		savedConfigMap = make(map[string]string)
 	}
+	setAuditContent(r, currentConfigMap[fileName], string(b))
 
 	// Does this rule already exist?
-	for j := range currentConfigMap {
-		if j == fileName {
-			log(LevelDebug, "%s", "Found existing file: "+fileName+" in alertrules configMap")
+	if current, ok := currentConfigMap[fileName]; ok {
+		requestLogger(r).Debug("Found existing file: " + fileName + " in alertrules configMap")
 
-			// Special check... did the user actually make any updates?  If not, take no action and exit
-			if currentConfigMap[fileName] == string(b) {
-				success(w, "The provided body is identical to the current Alert Rule: "+fileName+". No action will be taken.")
-				return
-			}
+		// Special check... did the user actually make any updates?  If not, take no action and exit
+		if current == string(b) {
+			success(w, r, "The provided body is identical to the current Alert Rule: "+fileName+". No action will be taken.")
+			return true
+		}
 
-			// We need to back up the current file first
-			timeNow := time.Now().UTC()
-			keyName := fileName + "-" + timeNow.Format(Layout)
-			savedConfigMap[keyName] = currentConfigMap[fileName]
+		// Make sure the new file fits before keeping a version of the current one
+		currentConfigMap[fileName] = string(b)
+		if e := k.checkMountedConfigMapFits(requestLogger(r), currentConfigMap, currentConfigMapName); e != nil {
+			configMapUpdateFailed(w, r, "Unable to update alertrules ConfigMap.", e)
+			return false
+		}
 
-			// How many backups do we have?  Do we need to delete any old ones?
-			// K8S configmaps have limited space; very large configs can fill the versions configMap.
-			keyList := k.sortKeysFromConfigMap(savedConfigMap, fileName)
-			if len(keyList) > MaxBackupFiles {
-				for j := range keyList {
-
-					// We want to keep at least MaxBackupFiles...
-					if j < MaxBackupFiles {
-						continue
-					}
-					// Delete any backups that are MaxBackupHours or older.
-					if k.isOldVersion(keyList[j], fileName, timeNow) {
-						delete(savedConfigMap, keyList[j])
-					}
-				}
-			}
+		// We need to back up the current file first
+		k.backupRulesVersion(r, savedConfigMap, fileName, current, time.Now().UTC())
 
-			// Okay, we're done messing with the savedConfigMap... Save it
-			e = k.updateConfigMapByName(savedConfigMap, savedConfigMapName)
-			if e != nil {
-				internalError(w, "Unable to update alertrules-versions ConfigMap. "+e.Error())
-				return
-			}
+		// Okay, we're done messing with the savedConfigMap... Save it
+		e := k.updateShardedConfigMapByName(requestLogger(r), savedConfigMap, savedConfigMapName)
+		if e != nil {
+			internalError(w, r, "Unable to update alertrules-versions ConfigMap. "+e.Error())
+			return false
+		}
 
-			// Finally, update the current configmap
-			currentConfigMap[fileName] = string(b)
-			e = k.updateConfigMapByName(currentConfigMap, currentConfigMapName)
-			if e != nil {
-				internalError(w, "Unable to update alertrules ConfigMap. "+e.Error())
-				return
-			}
-			// returning HTTP status "202: Accepted".
-			// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
-			// before the response is sent.
-			accepted(w, "The existing rule: "+fileName+" is being updated.")
-			return
+		// Finally, update the current configmap
+		e = k.updateMountedConfigMapByName(requestLogger(r), currentConfigMap, currentConfigMapName)
+		if e != nil {
+			configMapUpdateFailed(w, r, "Unable to update alertrules ConfigMap.", e)
+			return false
 		}
+		// returning HTTP status "202: Accepted".
+		// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
+		// before the response is sent.
+		accepted(w, r, "The existing rule: "+fileName+" is being updated."+warnings)
+		return true
 	}
 
 	// Apparently, no such rule exists, so we'll create a new one.
@@ -425,17 +460,56 @@ func (k *K8s) PutPrometheusRules(w http.ResponseWriter, r *http.Request) {
 		currentConfigMap = make(map[string]string)
 	}
 	currentConfigMap[fileName] = string(b)
+	if e := k.checkMountedConfigMapFits(requestLogger(r), currentConfigMap, currentConfigMapName); e != nil {
+		configMapUpdateFailed(w, r, "Unable to update the alertrules configmap:", e)
+		return false
+	}
+
+	// Record who created the file
+	saveChangeMetadata(savedConfigMap, fileName, "", getChangeMetadata(r))
+	e := k.updateShardedConfigMapByName(requestLogger(r), savedConfigMap, savedConfigMapName)
+	if e != nil {
+		internalError(w, r, "Unable to update alertrules-versions ConfigMap. "+e.Error())
+		return false
+	}
 
 	// Update the current configmap
-	e = k.updateConfigMapByName(currentConfigMap, currentConfigMapName)
+	e = k.updateMountedConfigMapByName(requestLogger(r), currentConfigMap, currentConfigMapName)
 	if e != nil {
-		internalError(w, "Unable to update the alertrules configmap: "+e.Error())
-		return
+		configMapUpdateFailed(w, r, "Unable to update the alertrules configmap:", e)
+		return false
 	}
 	// returning HTTP status "202: Accepted".
 	// Changes to ConfigMap instances are eventually propagated to the consuming containers, but this might not complete
 	// before the response is sent.
-	accepted(w, "A new rule file: "+fileName+" is being created.")
+	accepted(w, r, "A new rule file: "+fileName+" is being created."+warnings)
+	return true
+}
+
+// backupRulesVersion saves the given content of a rules file as a version, along with the change metadata of the
+// current version, records the change metadata of the request as that of the new current version, and deletes the
+// versions of the file that are too old.
+func (k *K8s) backupRulesVersion(r *http.Request, savedConfigMap map[string]string, fileName string, content string, timeNow time.Time) {
+	keyName := fileName + "-" + timeNow.Format(Layout)
+	savedConfigMap[keyName] = content
+	saveChangeMetadata(savedConfigMap, fileName, keyName, getChangeMetadata(r))
+
+	// How many backups do we have?  Do we need to delete any old ones?
+	// K8S configmaps have limited space; very large configs can fill the versions configMap.
+	keyList := k.sortKeysFromConfigMap(savedConfigMap, fileName)
+	if len(keyList) > MaxBackupFiles {
+		for j := range keyList {
+
+			// We want to keep at least MaxBackupFiles...
+			if j < MaxBackupFiles {
+				continue
+			}
+			// Delete any backups that are MaxBackupHours or older.
+			if k.isOldVersion(keyList[j], fileName, timeNow) {
+				deleteVersion(savedConfigMap, keyList[j])
+			}
+		}
+	}
 }
 
 // ValidatePrometheusRuleElements does some basic validation on the rule file.
@@ -452,27 +526,29 @@ func ValidatePrometheusRuleElements(g *gabs.Container) (bool, error) {
 
 	_, e := g.ArrayCountP(ruleTopElement)
 	if e != nil {
-		log(LevelError, "%s", "Did not find any rules group: "+e.Error())
+		zap.S().Error("Did not find any rules group: " + e.Error())
 		return false, errPrometheusRuleDoesNotHaveSingleGroupDefined
 	}
 
-	log(LevelDebug, "%s", "Prometheus Rule: "+g.String())
+	zap.S().Debug("Prometheus Rule: " + g.String())
 	return true, nil
 }
 
-func checkPrometheusRules(b []byte) ([]byte, error) {
-	tf, e := saveDataToTempFile(b)
+func checkPrometheusRules(logger *zap.SugaredLogger, b []byte) ([]byte, error) {
+	tf, e := saveDataToTempFile(logger, b)
 	if e != nil {
-		log(LevelError, "failed to create temp file for: (%s) %v\n", tf.Name(), e)
+		logger.Errorf("failed to create temp file for: (%s) %v", tf.Name(), e)
 		return nil, e
 	}
 
 	defer os.Remove(tf.Name())
 
-	promtoolCommand := execute(promtoolPath, "check", "rules", tf.Name())
+	start := time.Now()
+	promtoolCommand := execute(logger, promtoolPath, "check", "rules", tf.Name())
 	promtoolOutput, err := promtoolCommand.CombinedOutput()
+	observePromtool("rules", start, err)
 	if err != nil {
-		log(LevelDebug, "%s check rules %s failed: (%s) %v\n",
+		logger.Debugf("%s check rules %s failed: (%s) %v",
 			promtoolPath, tf.Name(), promtoolOutput, err)
 	}
 	return promtoolOutput, err
@@ -5,8 +5,10 @@
 package handlers
 
 import (
+	"context"
 	"fmt"
 	"github.com/Jeffail/gabs/v2"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	k8sfake "k8s.io/client-go/kubernetes/fake"
 	"net/http"
 	"net/http/httptest"
@@ -82,7 +84,7 @@ func TestCreateUpdateDeletePrometheusNamedRules(t *testing.T) {
 	handler := http.HandlerFunc(testclient.GetPrometheusRuleNames)
 	handler.ServeHTTP(rr, req)
 
-	verify(t, rr, http.StatusOK, "No Prometheus alert rules were found.")
+	verify(t, rr, http.StatusOK, `"alertrules": []`)
 
 	/* *** Request a non-existent current file *** */
 	req, err = http.NewRequest("GET", "/prometheus/rules/noSuch.rules", nil)
@@ -174,7 +176,7 @@ func TestCreateUpdateDeletePrometheusNamedRules(t *testing.T) {
 	handler = http.HandlerFunc(testclient.GetPrometheusRuleVersions)
 	handler.ServeHTTP(rr, req)
 
-	verify(t, rr, http.StatusOK, "No older versions of the Prometheus alert rule were found.")
+	verify(t, rr, http.StatusOK, `"versions": []`)
 
 	/* *** Get testRules1 *** */
 	req, err = http.NewRequest("GET", "/prometheus/rules/"+testRules1, nil)
@@ -337,7 +339,7 @@ func TestCreateUpdateDeletePrometheusNamedRules(t *testing.T) {
 	handler = http.HandlerFunc(testclient.GetPrometheusRuleNames)
 	handler.ServeHTTP(rr, req)
 
-	verify(t, rr, http.StatusOK, "No Prometheus alert rules were found.")
+	verify(t, rr, http.StatusOK, `"alertrules": []`)
 
 	/* *** Get All Older Rules for testRules1- should be none *** */
 	req, err = http.NewRequest("GET", "/prometheus/rules/"+testRules1+"/versions", nil)
@@ -538,6 +540,204 @@ func TestCreateUpdateDeletePrometheusUnnamedRules(t *testing.T) {
 	verify(t, rr, http.StatusOK, unnamedRules)
 }
 
+func TestLintPrometheusRules(t *testing.T) {
+	vmiName = "vmi-prometheus-rules-lint-test"
+	namespace = "vmi-prometheus-rules-lint-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	lintConfigMap := getTestConfigMap(getRuleLintConfigMapName(), namespace, ruleLintPolicyKey, `rules:
+- name: severity
+  check: required_label
+  label: severity
+  values: [critical, warning]
+- name: runbook
+  check: required_annotation
+  annotation: runbook_url
+  level: warn
+- name: unique-alert
+  check: unique_alert_name
+`)
+	if _, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), lintConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	instanceDownBody := `groups:
+- name: example
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    labels:
+      severity: %s
+    annotations:
+      summary: Instance down`
+
+	/* *** A lint error rejects the rules file *** */
+	req, err := http.NewRequest("PUT", "/prometheus/rules/a.rules", strings.NewReader(fmt.Sprintf(instanceDownBody, "page")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(testclient.PutPrometheusRules)
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, `the severity label is "page", expected one of: critical, warning`)
+
+	/* *** Lint warnings are listed in the response *** */
+	req, err = http.NewRequest("PUT", "/prometheus/rules/a.rules", strings.NewReader(fmt.Sprintf(instanceDownBody, "critical")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "warn: a.rules/example/InstanceDown: the alert has no runbook_url annotation (runbook)")
+
+	/* *** The same alert in another file is rejected *** */
+	req, err = http.NewRequest("PUT", "/prometheus/rules/b.rules", strings.NewReader(fmt.Sprintf(instanceDownBody, "warning")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "the alert is also defined in a.rules")
+
+	/* *** Lint all current rules files *** */
+	req, err = http.NewRequest("GET", "/prometheus/rules/lint", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler = http.HandlerFunc(testclient.LintPrometheusRules)
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"warnings": 1`)
+	verify(t, rr, http.StatusOK, `"errors": 0`)
+}
+
+func TestPrometheusRulesConflicts(t *testing.T) {
+	vmiName = "vmi-rules-conflicts-test"
+	namespace = "vmi-rules-conflicts-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	handler := http.HandlerFunc(testclient.PutPrometheusRules)
+
+	testRulesBody := `groups:
+- name: example
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    labels:
+      severity: page`
+
+	req, err := http.NewRequest("PUT", "/prometheus/rules/a.rules", strings.NewReader(testRulesBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "A new rule file: a.rules is being created.")
+	if strings.Contains(rr.Body.String(), "Lint warnings") {
+		t.Errorf("unexpected lint warnings: %s", rr.Body.String())
+	}
+
+	/* *** Without a rule lint policy, conflicts with other files are warnings *** */
+	req, err = http.NewRequest("PUT", "/prometheus/rules/b.rules", strings.NewReader(testRulesBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "warn: b.rules/example/: the group is also defined in a.rules (unique-group-name)")
+	verify(t, rr, http.StatusAccepted, "warn: b.rules/example/InstanceDown: the alert, with the same labels, is also defined in a.rules (unique-alert)")
+
+	/* *** The rule lint policy can make them errors *** */
+	lintConfigMap := getTestConfigMap(getRuleLintConfigMapName(), namespace, ruleLintPolicyKey, `rules:
+- name: unique-alert
+  check: unique_alert
+  level: error`)
+	if _, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), lintConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("PUT", "/prometheus/rules/c.rules", strings.NewReader(testRulesBody))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "error: c.rules/example/InstanceDown: the alert, with the same labels, is also defined in a.rules, b.rules (unique-alert)")
+}
+
+func TestPrometheusRulesDependents(t *testing.T) {
+	vmiName = "vmi-rules-graph-test"
+	namespace = "vmi-rules-graph-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	putHandler := http.HandlerFunc(testclient.PutPrometheusRules)
+	deleteHandler := http.HandlerFunc(testclient.DeletePrometheusRules)
+
+	recordingBody := `groups:
+- name: http-recording
+  rules:
+  - record: job:http_requests:rate5m
+    expr: sum by (job) (rate(http_requests_total[5m]))`
+	alertBody := `groups:
+- name: http-alerts
+  rules:
+  - alert: NoRequests
+    expr: job:http_requests:rate5m == 0
+    for: 10m`
+
+	for fileName, body := range map[string]string{"recording.rules": recordingBody, "alerts.rules": alertBody} {
+		req, err := http.NewRequest("PUT", "/prometheus/rules/"+fileName, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		putHandler.ServeHTTP(rr, req)
+		verifyStatus(t, rr, http.StatusAccepted)
+	}
+
+	/* *** The graph shows the alert depends on the recording rule *** */
+	req, err := http.NewRequest("GET", "/prometheus/rules/graph?format=dot", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetPrometheusRuleGraph).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"alerts.rules/http-alerts/NoRequests" -> "recording.rules/http-recording/job:http_requests:rate5m";`)
+
+	/* *** Removing the recording rule is refused *** */
+	req, err = http.NewRequest("PUT", "/prometheus/rules/recording.rules", strings.NewReader(strings.Replace(recordingBody, "rate5m", "rate1m", -1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	putHandler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusConflict, "alerts.rules/http-alerts/NoRequests queries job:http_requests:rate5m")
+
+	req, err = http.NewRequest("DELETE", "/prometheus/rules/recording.rules", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	deleteHandler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusConflict, "use ?force=true to proceed anyway")
+
+	/* *** Unless forced *** */
+	req, err = http.NewRequest("DELETE", "/prometheus/rules/recording.rules?force=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	deleteHandler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "Dependent rules no longer getting their series:\nalerts.rules/http-alerts/NoRequests queries job:http_requests:rate5m")
+}
+
 func newRulesTestClient(t *testing.T, vmiName string, namespace string, configName string) *K8s {
 	testclient := K8s{}
 
@@ -0,0 +1,318 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"go.uber.org/zap"
+)
+
+// Metrics the PushGateway adds to each group, with the time of its last successful and failed push
+const (
+	pushTimeMetric        = "push_time_seconds"
+	pushFailureTimeMetric = "push_failure_time_seconds"
+)
+
+// These can be set from the command line via -pushgatewayURL and -pushgatewayGroupTTL.  The URL defaults to the
+// PushGateway service of the VMI, and groups never expire unless a TTL is set.
+var (
+	pushgatewayURL      string
+	pushgatewayGroupTTL time.Duration
+)
+
+// How often the janitor looks for groups not pushed within the TTL
+var pushgatewayJanitorInterval = time.Minute
+
+// PushGatewayGroup is a group of metrics pushed to the PushGateway, identified by its job and grouping labels.
+// LastPush is the time of its last successful push, LastPushFailure the time of its last failed one, if any.
+type PushGatewayGroup struct {
+	Labels             map[string]string `json:"labels"`
+	LastPush           *time.Time        `json:"lastPush,omitempty"`
+	LastPushFailure    *time.Time        `json:"lastPushFailure,omitempty"`
+	LastPushSuccessful bool              `json:"lastPushSuccessful"`
+	Metrics            []string          `json:"metrics"`
+}
+
+// pushgatewayMetricFamily is a metric family of a group, as returned by the PushGateway /api/v1/metrics endpoint.
+type pushgatewayMetricFamily struct {
+	Metrics []struct {
+		Value string `json:"value"`
+	} `json:"metrics"`
+}
+
+// getPushGatewayURL returns the base URL of the PushGateway.
+func getPushGatewayURL() string {
+	if pushgatewayURL != "" {
+		return strings.TrimSuffix(pushgatewayURL, "/")
+	}
+	return "http://vmi-" + vmiName + "-prometheus-gw:9091"
+}
+
+// pushTime returns the time of a push time metric family, nil if the group has none.
+func pushTime(raw json.RawMessage) *time.Time {
+	var family pushgatewayMetricFamily
+	if len(raw) == 0 || json.Unmarshal(raw, &family) != nil || len(family.Metrics) == 0 {
+		return nil
+	}
+	seconds, err := strconv.ParseFloat(family.Metrics[0].Value, 64)
+	if err != nil || seconds <= 0 {
+		return nil
+	}
+	whole, fraction := math.Modf(seconds)
+	t := time.Unix(int64(whole), int64(fraction*1e9)).UTC()
+	return &t
+}
+
+// parsePushGatewayGroups parses the data of a response of the PushGateway /api/v1/metrics endpoint: one object per
+// group, with its labels, whether its last push succeeded, and its metric families by name.
+func parsePushGatewayGroups(data []map[string]json.RawMessage) ([]PushGatewayGroup, error) {
+	groups := make([]PushGatewayGroup, 0, len(data))
+	for _, fields := range data {
+		group := PushGatewayGroup{Metrics: make([]string, 0)}
+		if err := json.Unmarshal(fields["labels"], &group.Labels); err != nil {
+			return nil, fmt.Errorf("invalid labels of a group: %v", err)
+		}
+		if successful, ok := fields["last_push_successful"]; ok {
+			if err := json.Unmarshal(successful, &group.LastPushSuccessful); err != nil {
+				return nil, fmt.Errorf("invalid last_push_successful of a group: %v", err)
+			}
+		}
+		group.LastPush = pushTime(fields[pushTimeMetric])
+		group.LastPushFailure = pushTime(fields[pushFailureTimeMetric])
+		for name := range fields {
+			if name != "labels" && name != "last_push_successful" && name != pushTimeMetric && name != pushFailureTimeMetric {
+				group.Metrics = append(group.Metrics, name)
+			}
+		}
+		sort.Strings(group.Metrics)
+		groups = append(groups, group)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		return pushGatewayGroupPath(groups[i].Labels) < pushGatewayGroupPath(groups[j].Labels)
+	})
+	return groups, nil
+}
+
+// pushGatewayPathElement returns a label of a grouping key as an element of a PushGateway URL path.  Values with a
+// slash, or empty, are base64 encoded, as the PushGateway expects.
+func pushGatewayPathElement(name string, value string) string {
+	if value == "" {
+		return name + "@base64/="
+	}
+	if strings.Contains(value, "/") {
+		return name + "@base64/" + base64.RawURLEncoding.EncodeToString([]byte(value))
+	}
+	return name + "/" + url.PathEscape(value)
+}
+
+// pushGatewayGroupPath returns the path of a group under /metrics: its job, then its other grouping labels by name.
+func pushGatewayGroupPath(labels map[string]string) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		if name != "job" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	groupPath := "/metrics/" + pushGatewayPathElement("job", labels["job"])
+	for _, name := range names {
+		groupPath += "/" + pushGatewayPathElement(name, labels[name])
+	}
+	return groupPath
+}
+
+// getPushGatewayGroups returns the groups of the PushGateway.
+func getPushGatewayGroups() ([]PushGatewayGroup, error) {
+	resp, body, err := sendRequest("GET", getPushGatewayURL()+"/api/v1/metrics", "", map[string]string{"Accept": ContentTypeJSON}, "", "", "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("the PushGateway returned status %d: %s", resp.StatusCode, strings.TrimSpace(body))
+	}
+	var response struct {
+		Status string                       `json:"status"`
+		Data   []map[string]json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		return nil, fmt.Errorf("unexpected response from the PushGateway: %v", err)
+	}
+	if response.Status != "success" {
+		return nil, fmt.Errorf("the PushGateway returned %s", response.Status)
+	}
+	return parsePushGatewayGroups(response.Data)
+}
+
+// deletePushGatewayGroup deletes all the metrics of a group from the PushGateway.
+func deletePushGatewayGroup(labels map[string]string) error {
+	resp, body, err := sendRequest("DELETE", getPushGatewayURL()+pushGatewayGroupPath(labels), "", nil, "", "", "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("the PushGateway returned status %d: %s", resp.StatusCode, strings.TrimSpace(body))
+	}
+	return nil
+}
+
+// sameLabels returns whether two label sets are equal.
+func sameLabels(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// staleGroups returns the groups last pushed successfully longer than the TTL ago.  Groups never pushed successfully
+// are left alone.
+func staleGroups(groups []PushGatewayGroup, ttl time.Duration, now time.Time) []PushGatewayGroup {
+	var stale []PushGatewayGroup
+	for _, group := range groups {
+		if group.LastPush != nil && now.Sub(*group.LastPush) > ttl {
+			stale = append(stale, group)
+		}
+	}
+	return stale
+}
+
+// findPushGatewayGroup returns the group with the given labels, nil if there is none.
+func findPushGatewayGroup(groups []PushGatewayGroup, labels map[string]string) *PushGatewayGroup {
+	for i := range groups {
+		if sameLabels(groups[i].Labels, labels) {
+			return &groups[i]
+		}
+	}
+	return nil
+}
+
+// expireStalePushGatewayGroups deletes the groups not pushed within the TTL, and returns how many were deleted.
+//
+// The PushGateway has no conditional delete, so a group pushed again after it was found stale could be deleted along
+// with the new push.  The groups are read again once the stale ones are known, and a group whose push time moved is
+// kept, which narrows the time for a push to be lost to that of the deletions themselves.
+func expireStalePushGatewayGroups(now time.Time) int {
+	groups, err := getPushGatewayGroups()
+	if err != nil {
+		zap.S().Errorw("Unable to get the PushGateway groups", "error", err)
+		return 0
+	}
+	stale := staleGroups(groups, pushgatewayGroupTTL, now)
+	if len(stale) == 0 {
+		return 0
+	}
+	latest, err := getPushGatewayGroups()
+	if err != nil {
+		zap.S().Errorw("Unable to get the PushGateway groups", "error", err)
+		return 0
+	}
+	deleted := 0
+	for _, group := range stale {
+		current := findPushGatewayGroup(latest, group.Labels)
+		if current == nil || current.LastPush == nil || !current.LastPush.Equal(*group.LastPush) {
+			zap.S().Infow("Kept a PushGateway group pushed since it was found stale", "group", pushGatewayGroupPath(group.Labels))
+			continue
+		}
+		if err := deletePushGatewayGroup(group.Labels); err != nil {
+			zap.S().Errorw("Unable to delete a stale PushGateway group", "group", pushGatewayGroupPath(group.Labels), "error", err)
+			continue
+		}
+		deleted++
+		pushgatewayGroupsExpired.Inc()
+		zap.S().Infow("Deleted a stale PushGateway group", "group", pushGatewayGroupPath(group.Labels), "lastPush", group.LastPush)
+	}
+	return deleted
+}
+
+// StartPushGatewayJanitor deletes the PushGateway groups not pushed within -pushgatewayGroupTTL, every minute, until
+// stop is closed.  It does nothing if no TTL is set.
+func StartPushGatewayJanitor(stop <-chan struct{}) {
+	if pushgatewayGroupTTL <= 0 {
+		return
+	}
+	zap.S().Infow("Starting the PushGateway janitor", "ttl", pushgatewayGroupTTL.String())
+	go func() {
+		ticker := time.NewTicker(pushgatewayJanitorInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				expireStalePushGatewayGroups(now)
+			}
+		}
+	}()
+}
+
+// GetPushGatewayGroups returns the groups of the PushGateway with the time of their last push, optionally only those
+// of the given ?job=.
+func (k *K8s) GetPushGatewayGroups(w http.ResponseWriter, r *http.Request) {
+	job := r.URL.Query().Get("job")
+	groups, err := getPushGatewayGroups()
+	if err != nil {
+		serviceUnavailable(w, r, "Unable to get the groups of the PushGateway: "+err.Error())
+		return
+	}
+	result := make([]PushGatewayGroup, 0, len(groups))
+	for _, group := range groups {
+		if job == "" || group.Labels["job"] == job {
+			result = append(result, group)
+		}
+	}
+	successJSON(w, r, result)
+}
+
+// DeletePushGatewayGroup deletes the group of the given job, and the grouping labels given as query parameters, such
+// as ?instance=batch-1.
+func (k *K8s) DeletePushGatewayGroup(w http.ResponseWriter, r *http.Request) {
+	labels := map[string]string{"job": path.Base(r.URL.Path)}
+	for name, values := range r.URL.Query() {
+		if !model.LabelName(name).IsValid() || name == "job" {
+			problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: Invalid grouping label: "+name)
+			return
+		}
+		labels[name] = values[0]
+	}
+	groupPath := pushGatewayGroupPath(labels)
+	r = withLogFields(r, "resource", groupPath)
+
+	groups, err := getPushGatewayGroups()
+	if err != nil {
+		serviceUnavailable(w, r, "Unable to get the groups of the PushGateway: "+err.Error())
+		return
+	}
+	found := false
+	for _, group := range groups {
+		if sameLabels(group.Labels, labels) {
+			found = true
+			break
+		}
+	}
+	if !found {
+		problemError(w, r, http.StatusNotFound, CodePushGatewayGroupNotFound, "No action taken. Unable to find a PushGateway group: "+groupPath)
+		return
+	}
+	if err := deletePushGatewayGroup(labels); err != nil {
+		serviceUnavailable(w, r, "Unable to delete the PushGateway group: "+err.Error())
+		return
+	}
+	success(w, r, "The PushGateway group: "+groupPath+" has been deleted.")
+}
@@ -0,0 +1,192 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPushGatewayGroup returns a group of the PushGateway /api/v1/metrics endpoint, last pushed at the given time.
+func testPushGatewayGroup(labels string, pushed time.Time) string {
+	return fmt.Sprintf(`{"labels": %s, "last_push_successful": true,
+  "push_time_seconds": {"time_stamp": "%s", "type": "GAUGE", "metrics": [{"labels": %s, "value": "%d.5e+00"}]},
+  "push_failure_time_seconds": {"time_stamp": "%s", "type": "GAUGE", "metrics": [{"labels": %s, "value": "0e+00"}]},
+  "backup_duration_seconds": {"time_stamp": "%s", "type": "GAUGE", "metrics": [{"labels": %s, "value": "42"}]}}`,
+		labels, pushed.Format(time.RFC3339), labels, pushed.Unix(), pushed.Format(time.RFC3339), labels, pushed.Format(time.RFC3339), labels)
+}
+
+// fakePushGateway serves groups on /api/v1/metrics, and deletes them on DELETE /metrics/job/...
+type fakePushGateway struct {
+	sync.Mutex
+	groups map[string]string
+	lists  int
+	// Called after each list of the groups, e.g. to push a group meanwhile
+	afterList func(groups map[string]string)
+}
+
+func (f *fakePushGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.Lock()
+	defer f.Unlock()
+	switch {
+	case r.Method == "GET" && r.URL.Path == "/api/v1/metrics":
+		f.lists++
+		groups := make([]string, 0, len(f.groups))
+		for _, group := range f.groups {
+			groups = append(groups, group)
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprintf(w, `{"status": "success", "data": [%s]}`, strings.Join(groups, ","))
+		if f.afterList != nil {
+			f.afterList(f.groups)
+		}
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.EscapedPath(), "/metrics/job"):
+		delete(f.groups, r.URL.EscapedPath())
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestPushGatewayGroupPath(t *testing.T) {
+	for labels, expected := range map[string]string{
+		`{"job": "backup"}`: "/metrics/job/backup",
+		`{"job": "backup", "instance": "db-1", "env": "prod"}`:  "/metrics/job/backup/env/prod/instance/db-1",
+		`{"job": "backup", "path": "/var/lib/db", "shard": ""}`: "/metrics/job/backup/path@base64/L3Zhci9saWIvZGI/shard@base64/=",
+		`{"job": "a/b"}`: "/metrics/job@base64/YS9i",
+	} {
+		var labelSet map[string]string
+		if err := json.Unmarshal([]byte(labels), &labelSet); err != nil {
+			t.Fatal(err)
+		}
+		if groupPath := pushGatewayGroupPath(labelSet); groupPath != expected {
+			t.Errorf("got %s, want %s", groupPath, expected)
+		}
+	}
+}
+
+func TestParsePushGatewayGroups(t *testing.T) {
+	pushed := time.Date(2020, 10, 1, 10, 0, 0, 0, time.UTC)
+	var data []map[string]json.RawMessage
+	body := "[" + testPushGatewayGroup(`{"job": "backup", "instance": "db-1"}`, pushed) + "]"
+	if err := json.Unmarshal([]byte(body), &data); err != nil {
+		t.Fatal(err)
+	}
+	groups, err := parsePushGatewayGroups(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 1 {
+		t.Fatalf("expected one group, got %+v", groups)
+	}
+	group := groups[0]
+	if group.LastPush == nil || !group.LastPush.Equal(pushed.Add(500*time.Millisecond)) {
+		t.Errorf("unexpected last push: %v", group.LastPush)
+	}
+	if group.LastPushFailure != nil || !group.LastPushSuccessful {
+		t.Errorf("expected no failed push, got %+v", group)
+	}
+	if len(group.Metrics) != 1 || group.Metrics[0] != "backup_duration_seconds" {
+		t.Errorf("unexpected metrics: %v", group.Metrics)
+	}
+
+	// Only the groups pushed longer than the TTL ago are stale
+	if stale := staleGroups(groups, time.Hour, pushed.Add(30*time.Minute)); len(stale) != 0 {
+		t.Errorf("expected no stale group, got %+v", stale)
+	}
+	if stale := staleGroups(groups, time.Hour, pushed.Add(2*time.Hour)); len(stale) != 1 {
+		t.Errorf("expected a stale group, got %+v", stale)
+	}
+}
+
+func TestPushGatewayGroups(t *testing.T) {
+	vmiName = "pushgateway-test"
+	namespace = "pushgateway-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	send := func(method string, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	now := time.Now().UTC()
+	pushgateway := &fakePushGateway{groups: map[string]string{
+		"/metrics/job/backup/instance/db-1": testPushGatewayGroup(`{"job": "backup", "instance": "db-1"}`, now.Add(-48*time.Hour)),
+		"/metrics/job/backup/instance/db-2": testPushGatewayGroup(`{"job": "backup", "instance": "db-2"}`, now),
+		"/metrics/job/report":               testPushGatewayGroup(`{"job": "report"}`, now),
+	}}
+	server := httptest.NewServer(pushgateway)
+	pushgatewayURL = server.URL
+	defer func() { pushgatewayURL = "" }()
+
+	/* *** List the groups *** */
+	rr := send("GET", "/pushgateway/groups")
+	verify(t, rr, http.StatusOK, `"instance": "db-2"`)
+	verify(t, rr, http.StatusOK, `"lastPushSuccessful": true`)
+	rr = send("GET", "/pushgateway/groups?job=report")
+	if strings.Contains(rr.Body.String(), `"job": "backup"`) {
+		t.Errorf("expected only the groups of the report job, got %s", rr.Body.String())
+	}
+
+	/* *** Delete a group *** */
+	rr = send("DELETE", "/pushgateway/groups/backup?instance=db-2")
+	verify(t, rr, http.StatusOK, "The PushGateway group: /metrics/job/backup/instance/db-2 has been deleted.")
+	rr = send("DELETE", "/pushgateway/groups/backup?instance=db-2")
+	verify(t, rr, http.StatusNotFound, "Unable to find a PushGateway group: /metrics/job/backup/instance/db-2")
+	rr = send("DELETE", "/pushgateway/groups/backup")
+	verifyStatus(t, rr, http.StatusNotFound)
+	rr = send("DELETE", "/pushgateway/groups/backup?not-valid=1")
+	verifyStatus(t, rr, http.StatusBadRequest)
+
+	/* *** The janitor deletes the stale groups, reading the groups again only once *** */
+	pushgatewayGroupTTL = 24 * time.Hour
+	defer func() { pushgatewayGroupTTL = 0 }()
+	pushgateway.Lock()
+	pushgateway.groups["/metrics/job/backup/instance/db-3"] = testPushGatewayGroup(`{"job": "backup", "instance": "db-3"}`, now.Add(-72*time.Hour))
+	pushgateway.lists = 0
+	pushgateway.Unlock()
+	if deleted := expireStalePushGatewayGroups(now); deleted != 2 {
+		t.Errorf("expected two stale groups to be deleted, got %d", deleted)
+	}
+	if pushgateway.lists != 2 {
+		t.Errorf("expected the groups to be listed twice, got %d", pushgateway.lists)
+	}
+	if _, ok := pushgateway.groups["/metrics/job/backup/instance/db-1"]; ok {
+		t.Error("expected the stale group to be deleted")
+	}
+	if len(pushgateway.groups) != 1 {
+		t.Errorf("expected the report group to be kept, got %v", pushgateway.groups)
+	}
+
+	// A group pushed again after it was found stale is kept
+	pushgateway.Lock()
+	pushgateway.groups["/metrics/job/backup/instance/db-1"] = testPushGatewayGroup(`{"job": "backup", "instance": "db-1"}`, now.Add(-48*time.Hour))
+	pushgateway.afterList = func(groups map[string]string) {
+		groups["/metrics/job/backup/instance/db-1"] = testPushGatewayGroup(`{"job": "backup", "instance": "db-1"}`, now)
+	}
+	pushgateway.Unlock()
+	if deleted := expireStalePushGatewayGroups(now); deleted != 0 {
+		t.Errorf("expected no group to be deleted, got %d", deleted)
+	}
+	if _, ok := pushgateway.groups["/metrics/job/backup/instance/db-1"]; !ok {
+		t.Error("expected the group pushed again to be kept")
+	}
+
+	/* *** The PushGateway cannot be called *** */
+	server.Close()
+	rr = send("GET", "/pushgateway/groups")
+	verify(t, rr, http.StatusServiceUnavailable, "Unable to get the groups of the PushGateway")
+}
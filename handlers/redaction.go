@@ -0,0 +1,193 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// SecretPlaceholder replaces secrets in the Prometheus configuration returned by the API.  When found in a
+// configuration written back, it stands for the secret currently at the same place.
+const SecretPlaceholder = "<secret>"
+
+// Fields of prometheus.yml holding secrets, wherever they appear: basic_auth.password, bearer_token,
+// authorization.credentials, oauth2.client_secret and the EC2 service discovery secret_key.
+var secretFields = map[string]bool{
+	"password":      true,
+	"bearer_token":  true,
+	"credentials":   true,
+	"client_secret": true,
+	"secret_key":    true,
+}
+
+// This can be set from the command line via -revealUsers.  Only these users, as passed in the -trustedUserHeader
+// header, may read the Prometheus configuration with its secrets.
+var revealUsers = map[string]bool{}
+
+var errSecretPlaceholderUnresolved = errors.New("Error: a " + SecretPlaceholder + " placeholder does not match any current secret")
+
+// redactPrometheusConfig replaces the secrets in the given prometheus.yml with placeholders.  Only the secrets are
+// rewritten: comments and the order of keys are kept, and the configuration is returned verbatim if it has no secrets.
+func redactPrometheusConfig(config string) (string, error) {
+	var document yamlv3.Node
+	if err := yamlv3.Unmarshal([]byte(config), &document); err != nil {
+		// Not something we can look into, so not something holding secrets we know of either
+		return config, nil
+	}
+	if !redactSecrets(&document) {
+		return config, nil
+	}
+	b, err := encodePrometheusConfig(&document)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// redactSecrets replaces the secrets under the given node with placeholders, and returns whether there were any.
+func redactSecrets(node *yamlv3.Node) bool {
+	redacted := false
+	if node.Kind == yamlv3.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			value := node.Content[i+1]
+			if secretFields[node.Content[i].Value] && value.Kind == yamlv3.ScalarNode && value.Value != "" {
+				setSecret(value, SecretPlaceholder, "!!str")
+				redacted = true
+			} else if redactSecrets(value) {
+				redacted = true
+			}
+		}
+		return redacted
+	}
+	for _, child := range node.Content {
+		if redactSecrets(child) {
+			redacted = true
+		}
+	}
+	return redacted
+}
+
+// setSecret sets the value of a secret scalar node, quoting it if needed.
+func setSecret(node *yamlv3.Node, value string, tag string) {
+	node.Value = value
+	node.Tag = tag
+	node.Style = 0
+}
+
+// restoreRedactedSecrets replaces the placeholders in the given prometheus.yml with the secrets at the same place in
+// the current one.  Entries of lists are matched by job_name or name if they have one, by position otherwise.  Only
+// the placeholders are rewritten: comments and the order of keys are kept.  A configuration written back as it was
+// read is the current one, verbatim, as re-encoding it may change its layout.  The line break ending responses is
+// ignored.
+func restoreRedactedSecrets(config []byte, current string) ([]byte, error) {
+	if redacted, err := redactPrometheusConfig(current); err == nil &&
+		strings.TrimRight(redacted, "\r\n") == strings.TrimRight(string(config), "\r\n") {
+		return []byte(current), nil
+	}
+	var document, currentDocument yamlv3.Node
+	if err := yamlv3.Unmarshal(config, &document); err != nil {
+		return nil, err
+	}
+	if err := yamlv3.Unmarshal([]byte(current), &currentDocument); err != nil {
+		return nil, err
+	}
+	if err := restoreSecrets(&document, &currentDocument, ""); err != nil {
+		return nil, err
+	}
+	return encodePrometheusConfig(&document)
+}
+
+func restoreSecrets(node *yamlv3.Node, current *yamlv3.Node, path string) error {
+	switch node.Kind {
+	case yamlv3.DocumentNode:
+		for i, child := range node.Content {
+			var currentChild *yamlv3.Node
+			if current != nil && current.Kind == yamlv3.DocumentNode && i < len(current.Content) {
+				currentChild = current.Content[i]
+			}
+			if err := restoreSecrets(child, currentChild, path); err != nil {
+				return err
+			}
+		}
+	case yamlv3.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i].Value, node.Content[i+1]
+			currentValue := mappingValue(current, key)
+			if value.Kind == yamlv3.ScalarNode && value.Value == SecretPlaceholder {
+				if !secretFields[key] || currentValue == nil || currentValue.Kind != yamlv3.ScalarNode ||
+					currentValue.Value == SecretPlaceholder {
+					return fmt.Errorf("%v: %s", errSecretPlaceholderUnresolved, path+key)
+				}
+				setSecret(value, currentValue.Value, currentValue.Tag)
+			} else if err := restoreSecrets(value, currentValue, path+key+"."); err != nil {
+				return err
+			}
+		}
+	case yamlv3.SequenceNode:
+		for i, entry := range node.Content {
+			if err := restoreSecrets(entry, matchingEntry(entry, current, i), path+strconv.Itoa(i)+"."); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of the given key of a mapping node, nil if there is none.
+func mappingValue(node *yamlv3.Node, key string) *yamlv3.Node {
+	if node == nil || node.Kind != yamlv3.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// matchingEntry returns the entry of the current list matching the given entry, at the given index of its list.
+func matchingEntry(entry *yamlv3.Node, currentList *yamlv3.Node, index int) *yamlv3.Node {
+	if currentList == nil || currentList.Kind != yamlv3.SequenceNode {
+		return nil
+	}
+	for _, idField := range []string{"job_name", "name"} {
+		id := mappingValue(entry, idField)
+		if id == nil || id.Kind != yamlv3.ScalarNode {
+			continue
+		}
+		for _, current := range currentList.Content {
+			if hasMappingValue(current, idField, id.Value) {
+				return current
+			}
+		}
+		return nil
+	}
+	if index < len(currentList.Content) {
+		return currentList.Content[index]
+	}
+	return nil
+}
+
+// revealRequested returns whether the client asked for the secrets, and is allowed to see them.  A client asking but
+// not allowed gets a 403 response.  Only the user verified by the authenticating proxy counts, so secrets are never
+// revealed unless -trustedUserHeader is set.
+func revealRequested(w http.ResponseWriter, r *http.Request) (reveal bool, ok bool) {
+	if r.URL.Query().Get("reveal") != "true" {
+		return false, true
+	}
+	user := verifiedUser(r)
+	if user == "" || !revealUsers[user] {
+		problemError(w, r, http.StatusForbidden, CodeRevealForbidden, "ERROR: Not allowed to reveal the secrets of the Prometheus configuration.")
+		return false, false
+	}
+	requestLogger(r).Infow("Revealing the secrets of the Prometheus configuration", "user", user)
+	return true, true
+}
@@ -0,0 +1,161 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+const redactionTestConfig = `global:
+  scrape_interval: 5s
+scrape_configs:
+- job_name: prometheus
+  static_configs:
+  - targets: ['localhost:9090']
+- job_name: federate
+  basic_auth:
+    username: federator
+    password: s3cr3t
+  static_configs:
+  - targets: ['example.com:9090']
+remote_write:
+- url: https://metrics.example.com/api/v1/write
+  bearer_token: t0k3n
+`
+
+func TestRedactPrometheusConfig(t *testing.T) {
+	redacted, err := redactPrometheusConfig(redactionTestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(redacted, "s3cr3t") || strings.Contains(redacted, "t0k3n") {
+		t.Errorf("secrets not redacted: %s", redacted)
+	}
+	if strings.Count(redacted, SecretPlaceholder) != 2 || !strings.Contains(redacted, "username: federator") {
+		t.Errorf("unexpected redacted config: %s", redacted)
+	}
+
+	// Only the secrets are rewritten, comments and key order are kept
+	config := "# federation\nscrape_configs:\n- job_name: federate # upstream\n  basic_auth:\n    username: federator\n    password: s3cr3t\n"
+	expected := "# federation\nscrape_configs:\n  - job_name: federate # upstream\n    basic_auth:\n      username: federator\n      password: <secret>\n"
+	if redacted, err := redactPrometheusConfig(config); err != nil || redacted != expected {
+		t.Errorf("unexpected redacted config %q: %v", redacted, err)
+	}
+
+	// Configurations without secrets are kept verbatim
+	config = "# comment\nglobal:\n  scrape_interval: 5s\n"
+	if redacted, err := redactPrometheusConfig(config); err != nil || redacted != config {
+		t.Errorf("unexpected redacted config %q: %v", redacted, err)
+	}
+}
+
+func TestRestoreRedactedSecrets(t *testing.T) {
+	// Jobs are matched by name, wherever they moved to
+	config := `global:
+  scrape_interval: 10s
+scrape_configs:
+- job_name: federate
+  basic_auth:
+    username: federator
+    password: <secret>
+- job_name: prometheus
+remote_write:
+- url: https://metrics.example.com/api/v1/write
+  bearer_token: <secret>
+`
+	restored, err := restoreRedactedSecrets([]byte(config), redactionTestConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(restored), "password: s3cr3t") || !strings.Contains(string(restored), "bearer_token: t0k3n") ||
+		!strings.Contains(string(restored), "scrape_interval: 10s") {
+		t.Errorf("unexpected restored config: %s", restored)
+	}
+
+	// Comments are kept, and restored secrets needing quotes get them
+	config = "# federation\nscrape_configs:\n  - job_name: federate # upstream\n    basic_auth:\n      password: <secret>\n"
+	current := "scrape_configs:\n- job_name: federate\n  basic_auth:\n    password: \"123\"\n"
+	expected := "# federation\nscrape_configs:\n  - job_name: federate # upstream\n    basic_auth:\n      password: \"123\"\n"
+	if restored, err := restoreRedactedSecrets([]byte(config), current); err != nil || string(restored) != expected {
+		t.Errorf("unexpected restored config %q: %v", restored, err)
+	}
+
+	// A configuration written back as it was read, line break ending the response included, is the current one
+	current = "scrape_configs:\n - job_name: federate\n   basic_auth:\n     password: s3cr3t\n"
+	redacted, err := redactPrometheusConfig(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored, err := restoreRedactedSecrets([]byte(redacted+"\r\n"), current); err != nil || string(restored) != current {
+		t.Errorf("expected the current config, got %q: %v", restored, err)
+	}
+
+	// A placeholder with no secret behind it is an error
+	config = `scrape_configs:
+- job_name: new
+  basic_auth:
+    password: <secret>
+`
+	if _, err := restoreRedactedSecrets([]byte(config), redactionTestConfig); err == nil ||
+		!strings.Contains(err.Error(), "scrape_configs.0.basic_auth.password") {
+		t.Errorf("expected an unresolved placeholder error, got %v", err)
+	}
+}
+
+func TestGetPrometheusConfigReveal(t *testing.T) {
+	vmiName = "vmi-redaction-test"
+	namespace = "vmi-redaction-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	configMapName, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap[PrometheusConfigFileName] = redactionTestConfig
+	if err := testclient.updateConfigMapByName(zap.S(), configMap, configMapName); err != nil {
+		t.Fatal(err)
+	}
+	revealUsers = map[string]bool{"admin": true}
+	defer func() { revealUsers = map[string]bool{} }()
+	handler := http.HandlerFunc(testclient.GetPrometheusConfig)
+
+	req, err := http.NewRequest("GET", "/prometheus/config", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "password: <secret>")
+
+	req, err = http.NewRequest("GET", "/prometheus/config?reveal=true", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetBasicAuth("jdoe", "secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusForbidden, "Not allowed to reveal the secrets of the Prometheus configuration.")
+
+	// The basic auth username is not verified, so it never reveals the secrets
+	req.SetBasicAuth("admin", "secret")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusForbidden)
+
+	// Only the user passed by the authenticating proxy does
+	trustedUserHeader = "X-Remote-User"
+	defer func() { trustedUserHeader = "" }()
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusForbidden)
+
+	req.Header.Set("X-Remote-User", "admin")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "password: s3cr3t")
+}
@@ -0,0 +1,145 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/pkg/relabel"
+	"go.uber.org/zap"
+	yamlv2 "gopkg.in/yaml.v2"
+	"sigs.k8s.io/yaml"
+)
+
+// Relabel config sections of a scrape job that can be tested
+const (
+	relabelConfigsSection       = "relabel_configs"
+	metricRelabelConfigsSection = "metric_relabel_configs"
+)
+
+// RelabelTestRequest is the body of POST /prometheus/relabel/test.  The relabel configs tested are either given, or
+// taken from a job of the current Prometheus configuration.
+type RelabelTestRequest struct {
+	Job            string              `yaml:"job,omitempty"`
+	Section        string              `yaml:"section,omitempty"`
+	RelabelConfigs []*relabel.Config   `yaml:"relabel_configs,omitempty"`
+	LabelSets      []map[string]string `yaml:"labels"`
+}
+
+// RelabelTestResult is the result of relabeling one input label set.  Output is nil if the label set was dropped.
+type RelabelTestResult struct {
+	Input   map[string]string `json:"input"`
+	Steps   []RelabelTestStep `json:"steps"`
+	Output  map[string]string `json:"output"`
+	Dropped bool              `json:"dropped"`
+}
+
+// RelabelTestStep is the result of applying one relabel config.  Labels is nil if the label set was dropped.
+type RelabelTestStep struct {
+	Rule    int               `json:"rule"`
+	Action  string            `json:"action"`
+	Labels  map[string]string `json:"labels"`
+	Dropped bool              `json:"dropped"`
+}
+
+// TestRelabelConfigs applies relabel configs to label sets, and returns the labels after each relabel config.
+func (k *K8s) TestRelabelConfigs(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request RelabelTestRequest
+	if err := yamlv2.UnmarshalStrict(b, &request); err != nil {
+		validationFailed(w, r, CodeInvalidRelabelConfig, "ERROR: Unable to parse the relabel test: "+err.Error(), err.Error())
+		return
+	}
+	if len(request.LabelSets) == 0 {
+		badRequest(w, r, "ERROR: At least one label set must be provided.")
+		return
+	}
+
+	configs := request.RelabelConfigs
+	if request.Job != "" {
+		if len(configs) > 0 {
+			badRequest(w, r, "ERROR: Either a job or relabel_configs must be provided, not both.")
+			return
+		}
+		section := request.Section
+		if section == "" {
+			section = relabelConfigsSection
+		}
+		if section != relabelConfigsSection && section != metricRelabelConfigsSection {
+			badRequest(w, r, "ERROR: The section must be "+relabelConfigsSection+" or "+metricRelabelConfigsSection+".")
+			return
+		}
+		var found bool
+		configs, found, err = k.getJobRelabelConfigs(requestLogger(r), request.Job, section)
+		if err != nil {
+			internalError(w, r, "Unable to read the relabel configs of job "+request.Job+": "+err.Error())
+			return
+		}
+		if !found {
+			problemError(w, r, http.StatusNotFound, CodeJobNotFound, "Unable to find the scrape job: "+request.Job)
+			return
+		}
+	}
+
+	results := make([]RelabelTestResult, 0, len(request.LabelSets))
+	for _, labelSet := range request.LabelSets {
+		results = append(results, testRelabelConfigs(labelSet, configs))
+	}
+	successJSON(w, r, map[string][]RelabelTestResult{"results": results})
+}
+
+// testRelabelConfigs applies the given relabel configs one at a time, as Prometheus does, until the label set is dropped.
+func testRelabelConfigs(labelSet map[string]string, configs []*relabel.Config) RelabelTestResult {
+	result := RelabelTestResult{Input: labelSet, Steps: make([]RelabelTestStep, 0, len(configs))}
+	lset := labels.FromMap(labelSet)
+	for i, config := range configs {
+		lset = relabel.Process(lset, config)
+		step := RelabelTestStep{Rule: i, Action: string(config.Action)}
+		if lset == nil {
+			step.Dropped = true
+			result.Steps = append(result.Steps, step)
+			result.Dropped = true
+			return result
+		}
+		step.Labels = lset.Map()
+		result.Steps = append(result.Steps, step)
+	}
+	result.Output = lset.Map()
+	return result
+}
+
+// getJobRelabelConfigs returns the relabel configs in the given section of a scrape job of the current Prometheus
+// configuration, and whether there is such a job.
+func (k *K8s) getJobRelabelConfigs(logger *zap.SugaredLogger, job string, section string) ([]*relabel.Config, bool, error) {
+	config, err := k.getPrometheusConfigJSON(logger)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, scrapeConfig := range config.S("scrape_configs").Children() {
+		if name, ok := scrapeConfig.S("job_name").Data().(string); !ok || name != job {
+			continue
+		}
+		var configs []*relabel.Config
+		if !scrapeConfig.Exists(section) {
+			return configs, true, nil
+		}
+		// The relabel configs only know how to read themselves from YAML, with their defaults
+		b, err := yaml.JSONToYAML(scrapeConfig.S(section).Bytes())
+		if err != nil {
+			return nil, true, err
+		}
+		if err := yamlv2.Unmarshal(b, &configs); err != nil {
+			return nil, true, fmt.Errorf("invalid %s: %v", section, err)
+		}
+		return configs, true, nil
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,104 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRelabelConfigsHandler(t *testing.T) {
+	vmiName = "vmi-relabel-test"
+	namespace = "vmi-relabel-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	handler := http.HandlerFunc(testclient.TestRelabelConfigs)
+
+	// The relabel configs of the kubernetes-pods job keep annotated pods only
+	body := `job: kubernetes-pods
+labels:
+- __meta_kubernetes_pod_annotation_fakekdev_io_scrape: "true"
+  __meta_kubernetes_pod_label_app: frontend
+  __meta_kubernetes_namespace: dev
+  __meta_kubernetes_pod_name: frontend-1
+  __address__: 10.0.0.1:8080
+- __meta_kubernetes_pod_name: backend-1
+  __address__: 10.0.0.2:8080
+`
+	req, err := http.NewRequest("POST", "/prometheus/relabel/test", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusOK)
+
+	var response map[string][]RelabelTestResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	results := response["results"]
+	if len(results) != 2 {
+		t.Fatalf("expected 2 results, got %+v", results)
+	}
+	if results[0].Dropped || len(results[0].Steps) != 4 {
+		t.Errorf("unexpected result: %+v", results[0])
+	}
+	expected := map[string]string{
+		"__meta_kubernetes_pod_annotation_fakekdev_io_scrape": "true",
+		"__meta_kubernetes_pod_label_app":                     "frontend",
+		"__meta_kubernetes_namespace":                         "dev",
+		"__meta_kubernetes_pod_name":                          "frontend-1",
+		"__address__":                                         "10.0.0.1:8080",
+		"app":                                                 "frontend",
+		"kubernetes_namespace":                                "dev",
+		"kubernetes_pod_name":                                 "frontend-1",
+	}
+	if !reflect.DeepEqual(results[0].Output, expected) {
+		t.Errorf("unexpected output: %v", results[0].Output)
+	}
+	if !results[1].Dropped || results[1].Output != nil || len(results[1].Steps) != 1 || results[1].Steps[0].Action != "keep" {
+		t.Errorf("unexpected result: %+v", results[1])
+	}
+
+	// Relabel configs can also be given, as JSON
+	body = `{"relabel_configs": [{"source_labels": ["__name__"], "regex": "go_.*", "action": "drop"}],
+		"labels": [{"__name__": "go_goroutines"}, {"__name__": "up"}]}`
+	req, err = http.NewRequest("POST", "/prometheus/relabel/test", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusOK)
+	response = nil
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	results = response["results"]
+	if len(results) != 2 || !results[0].Dropped || results[1].Dropped || results[1].Output["__name__"] != "up" {
+		t.Errorf("unexpected results: %+v", results)
+	}
+
+	// Errors
+	req, err = http.NewRequest("POST", "/prometheus/relabel/test", strings.NewReader("job: nosuch\nlabels:\n- a: b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusNotFound, "Unable to find the scrape job: nosuch")
+
+	req, err = http.NewRequest("POST", "/prometheus/relabel/test",
+		strings.NewReader("relabel_configs:\n- action: nosuch\nlabels:\n- a: b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "unknown relabel action")
+}
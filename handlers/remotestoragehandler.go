@@ -0,0 +1,440 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/Jeffail/gabs/v2"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Sections of prometheus.yml managed via /prometheus/remote_write and /prometheus/remote_read
+const (
+	remoteWriteSection = "remote_write"
+	remoteReadSection  = "remote_read"
+)
+
+// Suffix of the name of the Secret holding the remote storage credentials, "vmi-{vmiName}-prometheus-remote-credentials".
+const remoteCredentialsSecretSuffix = "-prometheus-remote-credentials"
+
+// This can be set from the command line via -remoteCredentialsPath.  The remote credentials Secret must be mounted
+// there in the Prometheus container.
+var remoteCredentialsPath = "/etc/prometheus/remote-credentials"
+
+// remoteCredentialField is a credential that may be provided with a remote storage endpoint.  It is moved to the remote
+// credentials Secret, under the key "{section}-{name}-{key}", and replaced by a reference to the file the Secret key is
+// mounted as.
+type remoteCredentialField struct {
+	path     string
+	filePath string
+	key      string
+}
+
+var remoteCredentialFields = []remoteCredentialField{
+	{"basic_auth.password", "basic_auth.password_file", "password"},
+	{"bearer_token", "bearer_token_file", "bearer-token"},
+	{"authorization.credentials", "authorization.credentials_file", "credentials"},
+}
+
+// GetRemoteStorageNames returns a JSON with the names of all remote write or remote read endpoints.
+func (k *K8s) GetRemoteStorageNames(w http.ResponseWriter, r *http.Request) {
+	section := path.Base(r.URL.Path)
+
+	config, err := k.getPrometheusConfigJSON(requestLogger(r))
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	names := make([]string, 0)
+	for _, endpoint := range config.S(section).Children() {
+		if name, ok := endpoint.S("name").Data().(string); ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	successJSON(w, r, map[string][]string{section: names})
+}
+
+// GetRemoteStorage returns the requested remote write or remote read endpoint.  Credentials are never returned, only
+// references to the files holding them.
+func (k *K8s) GetRemoteStorage(w http.ResponseWriter, r *http.Request) {
+	section := path.Base(path.Dir(r.URL.Path))
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", section+"/"+name)
+
+	config, err := k.getPrometheusConfigJSON(requestLogger(r))
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	_, endpoint := findRemoteStorage(config, section, name)
+	if endpoint == nil {
+		problemError(w, r, http.StatusNotFound, CodeRemoteStorageNotFound, "Unable to find the "+section+" endpoint: "+name)
+		return
+	}
+	b, err := yaml.JSONToYAML(endpoint.Bytes())
+	if err != nil {
+		internalError(w, r, "Unable to convert the "+section+" endpoint to YAML: "+err.Error())
+		return
+	}
+	// Credentials written inline, e.g. with PUT /prometheus/config, are redacted as in the configuration itself
+	redacted, err := redactPrometheusConfig(string(b))
+	if err != nil {
+		internalError(w, r, "Unable to redact the "+section+" endpoint: "+err.Error())
+		return
+	}
+	successYAML(w, r, redacted)
+}
+
+// PutRemoteStorage creates or replaces the requested remote write or remote read endpoint.  Its credentials are moved
+// to the remote credentials Secret, so that they never appear in prometheus.yml or its saved versions.
+func (k *K8s) PutRemoteStorage(w http.ResponseWriter, r *http.Request) {
+	section := path.Base(path.Dir(r.URL.Path))
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", section+"/"+name)
+	if err := validateName(name); err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: Invalid endpoint name: "+err.Error())
+		return
+	}
+
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	jsonObject, err := yaml.YAMLToJSON(b)
+	if err != nil {
+		validationFailed(w, r, CodeInvalidYAML, "Unable to convert the provided YAML to JSON: "+err.Error(), err.Error())
+		return
+	}
+	endpoint, err := gabs.ParseJSON(jsonObject)
+	if err != nil {
+		badRequest(w, r, "Unable to parse the provided "+section+" endpoint: "+err.Error())
+		return
+	}
+	url, ok := endpoint.S("url").Data().(string)
+	if !ok || url == "" {
+		badRequest(w, r, "ERROR: The "+section+" endpoint must have a url.")
+		return
+	}
+	endpoint.Set(name, "name")
+
+	content, err := k.getPrometheusConfigYAML(requestLogger(r))
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	config, err := parsePrometheusConfig(content)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to parse the Prometheus configuration: %v", err))
+		return
+	}
+	_, current := findRemoteStorage(config, section, name)
+
+	// Move the credentials to the Secret
+	credentials := make(map[string][]byte)
+	for _, field := range remoteCredentialFields {
+		if !endpoint.ExistsP(field.path) {
+			continue
+		}
+		value, ok := endpoint.Path(field.path).Data().(string)
+		if !ok {
+			badRequest(w, r, "ERROR: "+field.path+" must be a string.")
+			return
+		}
+		key := remoteCredentialKey(section, name, field.key)
+		if value == SecretPlaceholder {
+			// The endpoint was read with GET, which redacts the credentials written inline
+			if value, ok = k.resolveRemoteCredential(current, url, field, key); !ok {
+				problemError(w, r, http.StatusBadRequest, CodeSecretPlaceholderUnresolved, fmt.Sprintf("No action taken. "+
+					"%v: %s.  The url of the endpoint must be unchanged for its current credentials to be kept.",
+					errSecretPlaceholderUnresolved, field.path))
+				return
+			}
+		}
+		credentials[key] = []byte(value)
+		endpoint.DeleteP(field.path)
+		endpoint.SetP(remoteCredentialsPath+"/"+key, field.filePath)
+	}
+	if len(credentials) > 0 {
+		if problem := k.checkRemoteCredentialsMounted(); problem != nil {
+			writeProblem(w, r, problem)
+			return
+		}
+	}
+
+	// Only the endpoint is rewritten, the comments and layout of the rest of prometheus.yml are kept
+	configYAML, _, err := setPrometheusConfigListItem(content, section, "name", name, endpoint.Data())
+	if err != nil {
+		internalError(w, r, "Unable to update the "+section+" endpoint: "+err.Error())
+		return
+	}
+	configYAML, problem := k.validatePrometheusConfig(r, configYAML)
+	if problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+
+	// The credentials must be in place before Prometheus is told to read them, and are only written once the
+	// configuration reading them is known to be valid
+	secretName, secretData, err := k.getOrCreateRemoteCredentialsSecret()
+	if err != nil {
+		internalError(w, r, "Unable to read the remote credentials Secret: "+err.Error())
+		return
+	}
+	previous := make(map[string][]byte, len(secretData))
+	for key, value := range secretData {
+		previous[key] = value
+	}
+	if len(credentials) > 0 {
+		for key, value := range credentials {
+			secretData[key] = value
+		}
+		if err := k.updateSecretByName(secretData, secretName); err != nil {
+			internalError(w, r, "Unable to update the remote credentials Secret: "+err.Error())
+			return
+		}
+	}
+	changed, problem := k.storePrometheusConfig(r, configYAML)
+	if problem != nil {
+		// Prometheus keeps the current configuration, so it must keep the current credentials too
+		if len(credentials) > 0 {
+			if err := k.updateSecretByName(previous, secretName); err != nil {
+				requestLogger(r).Errorf("Unable to restore the remote credentials Secret: %v", err)
+			}
+		}
+		writeProblem(w, r, problem)
+		return
+	}
+	prometheusConfigSaved(w, r, changed)
+	// Credentials neither provided with the endpoint nor still referenced by it, as GET returns it, can go now
+	keep := make(map[string][]byte, len(credentials))
+	for key, value := range credentials {
+		keep[key] = value
+	}
+	for _, field := range remoteCredentialFields {
+		key := remoteCredentialKey(section, name, field.key)
+		if filePath, _ := endpoint.Path(field.filePath).Data().(string); filePath == remoteCredentialsPath+"/"+key {
+			keep[key] = nil
+		}
+	}
+	k.deleteRemoteCredentials(r, secretName, section, name, keep)
+}
+
+// DeleteRemoteStorage removes the requested remote write or remote read endpoint, along with its credentials.
+func (k *K8s) DeleteRemoteStorage(w http.ResponseWriter, r *http.Request) {
+	section := path.Base(path.Dir(r.URL.Path))
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", section+"/"+name)
+
+	content, err := k.getPrometheusConfigYAML(requestLogger(r))
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	b, found, err := setPrometheusConfigListItem(content, section, "name", name, nil)
+	if err != nil {
+		internalError(w, r, "Unable to remove the "+section+" endpoint: "+err.Error())
+		return
+	}
+	if !found {
+		problemError(w, r, http.StatusNotFound, CodeRemoteStorageNotFound, "No action taken. Unable to find the "+section+" endpoint: "+name)
+		return
+	}
+
+	if !k.savePrometheusConfig(w, r, b) {
+		return
+	}
+	k.deleteRemoteCredentials(r, remoteCredentialsSecretName(), section, name, nil)
+}
+
+// getPrometheusConfigYAML returns the current prometheus.yml.
+func (k *K8s) getPrometheusConfigYAML(logger *zap.SugaredLogger) (string, error) {
+	_, configMap, err := k.getConfigMapByPath(logger, PrometheusConfigMapPath)
+	if err != nil {
+		return "", err
+	}
+	return configMap[PrometheusConfigFileName], nil
+}
+
+// getPrometheusConfigJSON returns the current prometheus.yml, parsed.
+func (k *K8s) getPrometheusConfigJSON(logger *zap.SugaredLogger) (*gabs.Container, error) {
+	content, err := k.getPrometheusConfigYAML(logger)
+	if err != nil {
+		return nil, err
+	}
+	return parsePrometheusConfig(content)
+}
+
+// parsePrometheusConfig parses prometheus.yml.
+func parsePrometheusConfig(content string) (*gabs.Container, error) {
+	jsonObject, err := yaml.YAMLToJSON([]byte(content))
+	if err != nil {
+		return nil, err
+	}
+	return gabs.ParseJSON(jsonObject)
+}
+
+// findRemoteStorage returns the index and the content of the named endpoint in the given section of prometheus.yml,
+// or a nil endpoint if there is no such endpoint.
+func findRemoteStorage(config *gabs.Container, section string, name string) (int, *gabs.Container) {
+	for i, endpoint := range config.S(section).Children() {
+		if endpointName, ok := endpoint.S("name").Data().(string); ok && endpointName == name {
+			return i, endpoint
+		}
+	}
+	return -1, nil
+}
+
+// resolveRemoteCredential returns the current credential a placeholder stands for, written inline in the current
+// endpoint or held in the remote credentials Secret.  Placeholders are only resolved for an endpoint whose url is
+// unchanged, so that a client who cannot read a credential cannot have it sent to another host either.
+func (k *K8s) resolveRemoteCredential(current *gabs.Container, url string, field remoteCredentialField, key string) (string, bool) {
+	if current == nil {
+		return "", false
+	}
+	if currentURL, _ := current.S("url").Data().(string); currentURL != url {
+		return "", false
+	}
+	if value, ok := current.Path(field.path).Data().(string); ok && value != "" && value != SecretPlaceholder {
+		return value, true
+	}
+	if filePath, _ := current.Path(field.filePath).Data().(string); filePath != remoteCredentialsPath+"/"+key {
+		return "", false
+	}
+	secretData, err := k.getSecretByName(remoteCredentialsSecretName())
+	if err != nil {
+		return "", false
+	}
+	value, ok := secretData[key]
+	return string(value), ok && len(value) > 0
+}
+
+func remoteCredentialKey(section string, name string, key string) string {
+	return section + "-" + name + "-" + key
+}
+
+func remoteCredentialsSecretName() string {
+	return "vmi-" + vmiName + remoteCredentialsSecretSuffix
+}
+
+// checkRemoteCredentialsMounted returns the problem if a Prometheus pod does not mount the remote credentials Secret at
+// -remoteCredentialsPath, as Prometheus would then fail to read the credential files of the endpoints.  Nothing can be
+// checked while there is no Prometheus pod.
+func (k *K8s) checkRemoteCredentialsMounted() *Problem {
+	pods, err := k.getPodsByLabel(getPrometheusPodSelector())
+	if err != nil {
+		return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: "Unable to list the Prometheus pods: " + err.Error()}
+	}
+	for i := range pods.Items {
+		if !podMountsSecret(&pods.Items[i], remoteCredentialsSecretName(), remoteCredentialsPath) {
+			return &Problem{Status: http.StatusConflict, Code: CodeSecretNotMounted,
+				Detail: "No action taken. The Prometheus pod " + pods.Items[i].Name + " does not mount the " + remoteCredentialsSecretName() +
+					" Secret at " + remoteCredentialsPath + ", so Prometheus would be unable to read the credentials."}
+		}
+	}
+	return nil
+}
+
+// podMountsSecret returns whether a container of the pod mounts the named Secret at the given path, on its own or as a
+// source of a projected volume.
+func podMountsSecret(pod *corev1.Pod, secretName string, mountPath string) bool {
+	mountPaths := podVolumeMountPaths(pod, func(volume corev1.Volume) bool {
+		if volume.Secret != nil && volume.Secret.SecretName == secretName {
+			return true
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil && source.Secret.Name == secretName {
+					return true
+				}
+			}
+		}
+		return false
+	})
+	for _, p := range mountPaths {
+		if p == path.Clean(mountPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// getOrCreateRemoteCredentialsSecret returns the name and data of the remote credentials Secret, creating it if it does
+// not exist yet.  The Secret is owned by the owner of the Prometheus configuration, so it goes away with the VMI.
+func (k *K8s) getOrCreateRemoteCredentialsSecret() (string, map[string][]byte, error) {
+	name := remoteCredentialsSecretName()
+	data, err := k.getSecretByName(name)
+	if err == nil {
+		if data == nil {
+			data = make(map[string][]byte)
+		}
+		return name, data, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return "", nil, err
+	}
+
+	vmi, err := k.getVMIJson()
+	if err != nil {
+		return "", nil, err
+	}
+	configMapName, _ := vmi.Path(PrometheusConfigMapPath).Data().(string)
+	configMap, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
+	if err != nil {
+		return "", nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       namespace,
+			Labels:          configMap.Labels,
+			OwnerReferences: configMap.OwnerReferences,
+		},
+		Type: corev1.SecretTypeOpaque,
+	}
+	if _, err := k.ClientSet.CoreV1().Secrets(namespace).Create(context.TODO(), secret, metav1.CreateOptions{}); err != nil {
+		return "", nil, err
+	}
+	return name, make(map[string][]byte), nil
+}
+
+// deleteRemoteCredentials removes the credentials of the given endpoint from the remote credentials Secret, except the
+// ones to keep.
+func (k *K8s) deleteRemoteCredentials(r *http.Request, secretName string, section string, name string, keep map[string][]byte) {
+	secretData, err := k.getSecretByName(secretName)
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			requestLogger(r).Errorf("Unable to read the remote credentials Secret: %v", err)
+		}
+		return
+	}
+	changed := false
+	for _, field := range remoteCredentialFields {
+		key := remoteCredentialKey(section, name, field.key)
+		if _, ok := secretData[key]; !ok {
+			continue
+		}
+		if _, ok := keep[key]; !ok {
+			delete(secretData, key)
+			changed = true
+		}
+	}
+	if !changed {
+		return
+	}
+	if err := k.updateSecretByName(secretData, secretName); err != nil {
+		requestLogger(r).Errorf("Unable to remove unused credentials from the remote credentials Secret: %v", err)
+	}
+}
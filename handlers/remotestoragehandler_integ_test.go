@@ -0,0 +1,282 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRemoteStorageHandler(t *testing.T) {
+	vmiName = "vmi-remote-test"
+	namespace = "vmi-remote-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+	secretName := "vmi-vmi-remote-test-prometheus-remote-credentials"
+
+	/* *** Add a remote write endpoint with a password *** */
+	body := `url: https://metrics.example.com/api/v1/write
+basic_auth:
+  username: shipper
+  password: s3cr3t`
+	req, err := http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	// The password is in the Secret, and only referenced from prometheus.yml
+	secret, err := testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret["remote_write-longterm-password"]) != "s3cr3t" {
+		t.Errorf("unexpected Secret data: %v", secret)
+	}
+	_, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := configMap[PrometheusConfigFileName]
+	if strings.Contains(config, "s3cr3t") ||
+		!strings.Contains(config, "password_file: /etc/prometheus/remote-credentials/remote_write-longterm-password") {
+		t.Errorf("unexpected prometheus.yml: %s", config)
+	}
+
+	req, err = http.NewRequest("GET", "/prometheus/remote_write/longterm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "username: shipper")
+	if strings.Contains(rr.Body.String(), "s3cr3t") {
+		t.Errorf("credentials returned: %s", rr.Body.String())
+	}
+
+	req, err = http.NewRequest("GET", "/prometheus/remote_write", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"longterm"`)
+
+	/* *** Switch to a bearer token *** */
+	body = `url: https://metrics.example.com/api/v1/write
+bearer_token: t0k3n`
+	req, err = http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	secret, err = testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := secret["remote_write-longterm-password"]; ok || string(secret["remote_write-longterm-bearer-token"]) != "t0k3n" {
+		t.Errorf("unexpected Secret data: %v", secret)
+	}
+
+	/* *** A rejected endpoint leaves the credentials alone *** */
+	body = `url: https://metrics.example.com/api/v1/write
+remote_timeout: soon
+bearer_token: n3w`
+	req, err = http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusBadRequest)
+	secret, err = testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret["remote_write-longterm-bearer-token"]) != "t0k3n" {
+		t.Errorf("expected the Secret to keep the current bearer token, got %v", secret)
+	}
+
+	/* *** Delete it *** */
+	req, err = http.NewRequest("DELETE", "/prometheus/remote_write/longterm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+
+	secret, err = testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(secret) != 0 {
+		t.Errorf("unexpected Secret data: %v", secret)
+	}
+	_, configMap, err = testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(configMap[PrometheusConfigFileName], "remote_write") {
+		t.Errorf("unexpected prometheus.yml: %s", configMap[PrometheusConfigFileName])
+	}
+
+	// None of the saved versions has the credentials either
+	_, versions, err := testclient.getShardedConfigMapByPath(zap.S(), PrometheusVersionsConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, version := range versions {
+		if strings.Contains(version, "s3cr3t") || strings.Contains(version, "t0k3n") {
+			t.Errorf("credentials saved in version %s", key)
+		}
+	}
+
+	/* *** Credentials are rejected while Prometheus does not mount their Secret *** */
+	body = "url: https://metrics.example.com/api/v1/write\nbearer_token: t0k3n\n"
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "vmi-" + vmiName + "-prometheus-0", Namespace: namespace,
+			Labels: map[string]string{"app": "vmi-" + vmiName + "-prometheus"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "prometheus"}}},
+	}
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusConflict, "does not mount the "+secretName+" Secret at /etc/prometheus/remote-credentials")
+	if secret, err = testclient.getSecretByName(secretName); err != nil || len(secret) != 0 {
+		t.Errorf("expected the Secret to be left alone, got %v, %v", secret, err)
+	}
+
+	// Endpoints without credentials do not need it
+	req, err = http.NewRequest("PUT", "/prometheus/remote_read/archive", strings.NewReader("url: https://metrics.example.com/api/v1/read"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusAccepted)
+
+	pod.Spec.Volumes = []corev1.Volume{{Name: "remote-credentials", VolumeSource: corev1.VolumeSource{
+		Secret: &corev1.SecretVolumeSource{SecretName: secretName}}}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "remote-credentials", MountPath: "/etc/prometheus/remote-credentials"}}
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Update(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	req, err = http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusAccepted)
+}
+
+func TestRemoteStorageRoundTripKeepsCredentials(t *testing.T) {
+	vmiName = "vmi-remote-test"
+	namespace = "vmi-remote-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+	secretName := "vmi-vmi-remote-test-prometheus-remote-credentials"
+
+	// An endpoint written with PUT /prometheus/config, with its password inline
+	configMapName, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap[PrometheusConfigFileName] += `
+remote_write:
+- name: longterm
+  url: https://metrics.example.com/api/v1/write
+  basic_auth:
+    username: shipper
+    password: s3cr3t
+`
+	if err := testclient.updateConfigMapByName(zap.S(), configMap, configMapName); err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, "/prometheus/remote_write/longterm", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	/* *** A placeholder cannot send the password to another host *** */
+	rr := send("GET", "")
+	verify(t, rr, http.StatusOK, "password: "+SecretPlaceholder)
+	redacted := rr.Body.String()
+	rr = send("PUT", strings.Replace(redacted, "metrics.example.com", "attacker.example.com", 1))
+	verify(t, rr, http.StatusBadRequest, "placeholder does not match any current secret: basic_auth.password")
+	if _, err := testclient.getSecretByName(secretName); err == nil {
+		t.Error("expected no remote credentials Secret to be created")
+	}
+
+	/* *** The endpoint read can be written back, keeping its password *** */
+	rr = send("PUT", redacted)
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+	secret, err := testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret["remote_write-longterm-password"]) != "s3cr3t" {
+		t.Errorf("unexpected Secret data: %v", secret)
+	}
+
+	// And again, now that the password is in the Secret
+	rr = send("PUT", redacted)
+	verifyStatus(t, rr, http.StatusOK)
+	secret, err = testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret["remote_write-longterm-password"]) != "s3cr3t" {
+		t.Errorf("unexpected Secret data: %v", secret)
+	}
+
+	/* *** The endpoint read back, referencing its password file, can be edited and written back too *** */
+	rr = send("GET", "")
+	verify(t, rr, http.StatusOK, "password_file: /etc/prometheus/remote-credentials/remote_write-longterm-password")
+	rr = send("PUT", strings.Replace(rr.Body.String(), "username: shipper", "username: archiver", 1))
+	verify(t, rr, http.StatusAccepted, "The Prometheus configuration is being updated.")
+	secret, err = testclient.getSecretByName(secretName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(secret["remote_write-longterm-password"]) != "s3cr3t" {
+		t.Errorf("expected the Secret to keep the password still referenced, got %v", secret)
+	}
+	_, configMap, err = testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config := configMap[PrometheusConfigFileName]; !strings.Contains(config, "username: archiver") ||
+		!strings.Contains(config, "password_file: /etc/prometheus/remote-credentials/remote_write-longterm-password") {
+		t.Errorf("unexpected prometheus.yml: %s", config)
+	}
+}
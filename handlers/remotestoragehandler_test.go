@@ -0,0 +1,118 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRemoteStorageHandlerErrors(t *testing.T) {
+	vmiName = "vmi-remote-test"
+	namespace = "vmi-remote-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	// No endpoints yet
+	req, err := http.NewRequest("GET", "/prometheus/remote_write", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"remote_write": []`)
+
+	req, err = http.NewRequest("GET", "/prometheus/remote_read/longterm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusNotFound, "Unable to find the remote_read endpoint: longterm")
+
+	req, err = http.NewRequest("DELETE", "/prometheus/remote_write/longterm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusNotFound, "No action taken. Unable to find the remote_write endpoint: longterm")
+
+	// An endpoint needs a url
+	req, err = http.NewRequest("PUT", "/prometheus/remote_write/longterm", strings.NewReader("remote_timeout: 30s"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "ERROR: The remote_write endpoint must have a url.")
+}
+
+func TestGetRemoteStorageRedactsInlineCredentials(t *testing.T) {
+	vmiName = "vmi-remote-test"
+	namespace = "vmi-remote-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	// An endpoint written with PUT /prometheus/config, with its password inline
+	configMapName, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap[PrometheusConfigFileName] += `
+remote_write:
+- name: longterm
+  url: https://metrics.example.com/api/v1/write
+  basic_auth:
+    username: shipper
+    password: s3cr3t
+`
+	if err := testclient.updateConfigMapByName(zap.S(), configMap, configMapName); err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "/prometheus/remote_write/longterm", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "password: "+SecretPlaceholder)
+	if strings.Contains(rr.Body.String(), "s3cr3t") {
+		t.Errorf("credentials returned: %s", rr.Body.String())
+	}
+}
+
+func TestPodMountsSecret(t *testing.T) {
+	pod := corev1.Pod{Spec: corev1.PodSpec{
+		Volumes: []corev1.Volume{
+			{Name: "credentials", VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: "vmi-test-prometheus-remote-credentials"}}},
+			{Name: "projected", VolumeSource: corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+				Sources: []corev1.VolumeProjection{{Secret: &corev1.SecretProjection{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "other"}}}}}}},
+		},
+		Containers: []corev1.Container{{Name: "prometheus", VolumeMounts: []corev1.VolumeMount{
+			{Name: "credentials", MountPath: "/etc/prometheus/remote-credentials/"},
+			{Name: "projected", MountPath: "/etc/prometheus/other"},
+		}}},
+	}}
+	if !podMountsSecret(&pod, "vmi-test-prometheus-remote-credentials", "/etc/prometheus/remote-credentials") {
+		t.Error("expected the Secret to be mounted")
+	}
+	if podMountsSecret(&pod, "vmi-test-prometheus-remote-credentials", "/etc/prometheus/other") {
+		t.Error("expected the Secret not to be mounted at another path")
+	}
+	if !podMountsSecret(&pod, "other", "/etc/prometheus/other") {
+		t.Error("expected the projected Secret to be mounted")
+	}
+	if podMountsConfigMap(&pod, "vmi-test-prometheus-remote-credentials", "/etc/prometheus/remote-credentials") {
+		t.Error("expected a Secret not to be taken for a ConfigMap")
+	}
+}
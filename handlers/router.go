@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	restgo "k8s.io/client-go/rest"
 )
 
@@ -19,6 +20,8 @@ var permanentRedirects = map[string]string{
 func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 
 	router := mux.NewRouter().StrictSlash(true)
+	router.Use(requestIDMiddleware, metricsMiddleware)
+	configMapMetrics.setClient(k)
 
 	// Set root content to Swagger docs
 	router.Handle("/", http.FileServer(http.Dir(staticPath)))
@@ -29,12 +32,28 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 
 	router.HandleFunc("/healthcheck", GetHealthCheck).Methods("GET")
 
+	// swagger:operation GET /metrics getMetrics
+	// ---
+	// tags:
+	// - "Metrics"
+	// summary: Prometheus metrics of the API server.
+	// description: Request counts and latencies, promtool validation results, Kubernetes API call latencies, propagation timeouts, and ConfigMap sizes, in the Prometheus text format.
+	// produces:
+	// - text/plain
+	// responses:
+	//   "200":
+	//     description: Prometheus metrics of the API server.
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
 	// swagger:operation GET /prometheus/config getPrometheusConfig
 	// ---
 	// tags:
 	// - "Prometheus Config"
 	// summary: Display the contents of a Prometheus configuration file.
-	// description: Display the contents of the current Prometheus configuration file.  If a version parmaeter is provided, display the contents of that older version.
+	// description: Display the contents of the current Prometheus configuration file.  If a version parmaeter is provided, display the contents of that older version.  Secrets are replaced by <secret> placeholders, unless revealed.
+	// produces:
+	// - application/yaml
+	// - application/json
 	// parameters:
 	// - in: query
 	//   name: version
@@ -42,6 +61,12 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	//   required: false
 	//   schema:
 	//     type: string
+	// - in: query
+	//   name: reveal
+	//   description: Display the secrets, only allowed for the users given by -revealUsers
+	//   required: false
+	//   schema:
+	//     type: boolean
 	// responses:
 	//   "200":
 	//     description: Display the contents of a Prometheus config file
@@ -52,9 +77,11 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	// tags:
 	// - "Prometheus Config"
 	// summary: Replace contents of the Prometheus configuration file.
-	// description:  The user-provided content will replace the current Prometheus configuration.  The older configuration is saved to a file.
+	// description:  The user-provided content will replace the current Prometheus configuration.  The older configuration is saved to a file.  A <secret> placeholder keeps the secret currently at the same place.
 	// consumes:
+	// - application/yaml
 	// - application/x-yaml
+	// - application/json
 	// parameters:
 	// - in: body
 	//   name: body
@@ -62,22 +89,298 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	//   required: true
 	//   schema:
 	//     type: string
+	// - in: header
+	//   name: X-Change-Author
+	//   description: Author of the change, defaults to the authenticated user.  May also be passed as the author query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Comment
+	//   description: Reason for the change.  May also be passed as the comment query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Ticket
+	//   description: Ticket tracking the change.  May also be passed as the ticket query parameter.
+	//   required: false
+	//   type: string
 	// responses:
 	//   "200":
 	//     description: Replace contents of Prometheus config file (as specified by -promConfigFile)
-	router.HandleFunc("/prometheus/config", k.PutPrometheusConfig).Methods("PUT")
+	//   "415":
+	//     description: The Content-Type is neither JSON nor YAML.
+	router.HandleFunc("/prometheus/config", k.audited(k.PutPrometheusConfig)).Methods("PUT")
+
+	// swagger:operation PATCH /prometheus/config patchPrometheusConfig
+	// ---
+	// tags:
+	// - "Prometheus Config"
+	// summary: Patch the Prometheus configuration file.
+	// description:  Apply a JSON Patch (RFC 6902) or a JSON merge patch (RFC 7396) to the current Prometheus configuration.  The patched configuration is validated and saved as with PUT, and the older configuration is saved to a file.  Comments in the configuration are not preserved.
+	// consumes:
+	// - application/json-patch+json
+	// - application/merge-patch+json
+	// parameters:
+	// - in: body
+	//   name: body
+	//   description: Patch to apply to the Prometheus config file, against its JSON representation
+	//   required: true
+	//   schema:
+	//     type: string
+	// - in: header
+	//   name: X-Change-Author
+	//   description: Author of the change, defaults to the authenticated user.  May also be passed as the author query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Comment
+	//   description: Reason for the change.  May also be passed as the comment query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Ticket
+	//   description: Ticket tracking the change.  May also be passed as the ticket query parameter.
+	//   required: false
+	//   type: string
+	// responses:
+	//   "202":
+	//     description: The patched Prometheus configuration is being updated.
+	//   "400":
+	//     description: The patch could not be applied, or the patched configuration is invalid.
+	//   "415":
+	//     description: The Content-Type is not a supported patch format.
+	router.HandleFunc("/prometheus/config", k.audited(k.PatchPrometheusConfig)).Methods("PATCH")
 
 	// swagger:operation GET /prometheus/config/versions getPrometheusVersions
 	// ---
 	// tags:
 	// - "Prometheus Config"
 	// summary: Display a list of all older saved versions.
-	// description: Display a list of all older saved versions of the Prometheus configuration.
+	// description: Display a list of all older saved versions of the Prometheus configuration, with the author, comment and ticket of the change that created each version.
+	// produces:
+	// - application/json
+	// - application/yaml
 	// responses:
 	//   "200":
 	//     description: Display a list of all older saved versions of the Prometheus configuration.
 	router.HandleFunc("/prometheus/config/versions", k.GetPrometheusVersions).Methods("GET")
 
+	// swagger:operation GET /prometheus/remote_write getRemoteWriteNames
+	// ---
+	// tags:
+	// - "Prometheus Remote Write"
+	// summary: Display a list of all remote_write endpoints.
+	// description: Display the names of all remote_write endpoints in the Prometheus configuration.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all remote_write endpoints.
+	router.HandleFunc("/prometheus/"+remoteWriteSection, k.GetRemoteStorageNames).Methods("GET")
+
+	// swagger:operation GET /prometheus/remote_write/{name} getRemoteWrite
+	// ---
+	// tags:
+	// - "Prometheus Remote Write"
+	// summary: Display a remote_write endpoint.
+	// description: Display the remote_write endpoint with the given name.  Credentials are not displayed, only the files they are read from.
+	// produces:
+	// - application/yaml
+	// - application/json
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// responses:
+	//   "200":
+	//     description: Display a remote_write endpoint.
+	//   "404":
+	//     description: No such endpoint.
+	router.HandleFunc("/prometheus/"+remoteWriteSection+"/{name}", k.GetRemoteStorage).Methods("GET")
+
+	// swagger:operation PUT /prometheus/remote_write/{name} putRemoteWrite
+	// ---
+	// tags:
+	// - "Prometheus Remote Write"
+	// summary: Create or replace a remote_write endpoint.
+	// description: Create or replace the remote_write endpoint with the given name in the Prometheus configuration.  Any basic_auth.password, bearer_token or authorization.credentials provided are stored in a Secret, and replaced by the password_file, bearer_token_file or credentials_file the Secret is mounted as.  The older configuration is saved to a file.
+	// consumes:
+	// - application/yaml
+	// - application/json
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// - in: body
+	//   name: body
+	//   description: The remote_write endpoint, as in prometheus.yml
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "202":
+	//     description: The Prometheus configuration is being updated.
+	//   "409":
+	//     description: Credentials were provided, and a Prometheus pod does not mount the remote credentials Secret.
+	router.HandleFunc("/prometheus/"+remoteWriteSection+"/{name}", k.audited(k.PutRemoteStorage)).Methods("PUT")
+
+	// swagger:operation DELETE /prometheus/remote_write/{name} deleteRemoteWrite
+	// ---
+	// tags:
+	// - "Prometheus Remote Write"
+	// summary: Delete a remote_write endpoint.
+	// description: Delete the remote_write endpoint with the given name from the Prometheus configuration, along with its credentials.  The older configuration is saved to a file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// responses:
+	//   "202":
+	//     description: The Prometheus configuration is being updated.
+	//   "404":
+	//     description: No such endpoint.
+	router.HandleFunc("/prometheus/"+remoteWriteSection+"/{name}", k.audited(k.DeleteRemoteStorage)).Methods("DELETE")
+
+	// swagger:operation GET /prometheus/remote_read getRemoteReadNames
+	// ---
+	// tags:
+	// - "Prometheus Remote Read"
+	// summary: Display a list of all remote_read endpoints.
+	// description: Display the names of all remote_read endpoints in the Prometheus configuration.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all remote_read endpoints.
+	router.HandleFunc("/prometheus/"+remoteReadSection, k.GetRemoteStorageNames).Methods("GET")
+
+	// swagger:operation GET /prometheus/remote_read/{name} getRemoteRead
+	// ---
+	// tags:
+	// - "Prometheus Remote Read"
+	// summary: Display a remote_read endpoint.
+	// description: Display the remote_read endpoint with the given name.  Credentials are not displayed, only the files they are read from.
+	// produces:
+	// - application/yaml
+	// - application/json
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// responses:
+	//   "200":
+	//     description: Display a remote_read endpoint.
+	//   "404":
+	//     description: No such endpoint.
+	router.HandleFunc("/prometheus/"+remoteReadSection+"/{name}", k.GetRemoteStorage).Methods("GET")
+
+	// swagger:operation PUT /prometheus/remote_read/{name} putRemoteRead
+	// ---
+	// tags:
+	// - "Prometheus Remote Read"
+	// summary: Create or replace a remote_read endpoint.
+	// description: Create or replace the remote_read endpoint with the given name in the Prometheus configuration.  Any basic_auth.password, bearer_token or authorization.credentials provided are stored in a Secret, and replaced by the password_file, bearer_token_file or credentials_file the Secret is mounted as.  The older configuration is saved to a file.
+	// consumes:
+	// - application/yaml
+	// - application/json
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// - in: body
+	//   name: body
+	//   description: The remote_read endpoint, as in prometheus.yml
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "202":
+	//     description: The Prometheus configuration is being updated.
+	//   "409":
+	//     description: Credentials were provided, and a Prometheus pod does not mount the remote credentials Secret.
+	router.HandleFunc("/prometheus/"+remoteReadSection+"/{name}", k.audited(k.PutRemoteStorage)).Methods("PUT")
+
+	// swagger:operation DELETE /prometheus/remote_read/{name} deleteRemoteRead
+	// ---
+	// tags:
+	// - "Prometheus Remote Read"
+	// summary: Delete a remote_read endpoint.
+	// description: Delete the remote_read endpoint with the given name from the Prometheus configuration, along with its credentials.  The older configuration is saved to a file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: name of the endpoint
+	// responses:
+	//   "202":
+	//     description: The Prometheus configuration is being updated.
+	//   "404":
+	//     description: No such endpoint.
+	router.HandleFunc("/prometheus/"+remoteReadSection+"/{name}", k.audited(k.DeleteRemoteStorage)).Methods("DELETE")
+
+	// swagger:operation POST /prometheus/relabel/test testRelabelConfigs
+	// ---
+	// tags:
+	// - "Prometheus Config"
+	// summary: Test relabel configs against label sets.
+	// description: Apply the given relabel_configs, or the relabel_configs or metric_relabel_configs of a job of the current Prometheus configuration, to each of the given label sets.  Display the labels after each relabel config, and whether the label set was dropped.
+	// consumes:
+	// - application/yaml
+	// - application/json
+	// produces:
+	// - application/json
+	// - application/yaml
+	// parameters:
+	// - in: body
+	//   name: body
+	//   description: 'The labels to relabel, and either relabel_configs, or the job and the section ("relabel_configs" by default, or "metric_relabel_configs") to take them from'
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "200":
+	//     description: The labels after each relabel config, for each label set.
+	//   "404":
+	//     description: No such job.
+	router.HandleFunc("/prometheus/relabel/test", k.TestRelabelConfigs).Methods("POST")
+
+	// swagger:operation GET /prometheus/scrape_configs/{job}/targets getScrapeJobTargets
+	// ---
+	// tags:
+	// - "Prometheus Config"
+	// summary: Display the health of the targets of a scrape job
+	// description: Display the targets Prometheus discovered for a scrape job of the current Prometheus configuration, with the health, last error, last scrape duration and labels of each, and list the jobs that have no targets.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// parameters:
+	// - in: path
+	//   name: job
+	//   type: string
+	//   required: true
+	//   description: name of the scrape job
+	// responses:
+	//   "200":
+	//     description: The targets of the job, and the jobs without targets.
+	//   "404":
+	//     description: No such job.
+	//   "503":
+	//     description: Prometheus could not be called.
+	router.HandleFunc("/prometheus/scrape_configs/{job}/targets", k.GetScrapeJobTargets).Methods("GET")
+
 	//Prometheus Rules Routes
 	// swagger:operation GET /prometheus/rules Prometheus Rules getPrometheusRuleNames
 	// ---
@@ -85,17 +388,84 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	// - "Prometheus Alert Rules"
 	// summary: Display a list of all current Prometheus Alert Rule files.
 	// description: Display a list of all current Prometheus Alert Rule files.
+	// produces:
+	// - application/json
+	// - application/yaml
 	// responses:
 	//   "200":
 	//     description: Display a list of all current Prometheus Alert Rules files.
 	router.HandleFunc("/prometheus/rules", k.GetPrometheusRuleNames).Methods("GET")
 
+	// swagger:operation POST /prometheus/rules/evaluate evaluatePrometheusRules
+	// ---
+	// tags:
+	// - "Prometheus Alert Rules"
+	// summary: Dry-run rule expressions against Prometheus.
+	// description: Run the expression of each rule of the given rules file, or the given expr, as an instant query at the given time (now by default), or as a range query from start to end by step, against the Prometheus of the VMI or the one set by -prometheusURL.  Display the series matched by each rule, how many alerts each alerting rule would raise, and their rendered annotations.  Nothing is saved.
+	// consumes:
+	// - application/yaml
+	// - application/json
+	// produces:
+	// - application/json
+	// - application/yaml
+	// parameters:
+	// - in: body
+	//   name: body
+	//   description: 'A rules file ("groups"), or an "expr", with an optional "time", or "start", "end" and "step"'
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "200":
+	//     description: The series matched and the alerts raised by each rule.
+	//   "400":
+	//     description: Invalid request.
+	router.HandleFunc("/prometheus/rules/evaluate", k.EvaluatePrometheusRules).Methods("POST")
+
+	// swagger:operation GET /prometheus/rules/lint lintPrometheusRules
+	// ---
+	// tags:
+	// - "Prometheus Alert Rules"
+	// summary: Check all current Prometheus Alert Rules files against the rule lint policy.
+	// description: Run the checks of the rule lint policy, read from the rule lint ConfigMap, on every current Prometheus Alert Rules file.  Display the findings, at the error or warn level.  The same checks run when a rules file is saved, errors rejecting it.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The lint findings of every rules file.
+	router.HandleFunc("/prometheus/rules/lint", k.LintPrometheusRules).Methods("GET")
+
+	// swagger:operation GET /prometheus/rules/graph getPrometheusRuleGraph
+	// ---
+	// tags:
+	// - "Prometheus Alert Rules"
+	// summary: Display the dependency graph of the current Prometheus rules.
+	// description: Parse the expression of every current rule, and display which rules query the series recorded by which recording rules, as JSON, or in the Graphviz DOT language with ?format=dot or Accept text/vnd.graphviz.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// - text/vnd.graphviz
+	// parameters:
+	// - in: query
+	//   name: format
+	//   type: string
+	//   required: false
+	//   description: dot for the Graphviz DOT language
+	// responses:
+	//   "200":
+	//     description: The rules, and the recording rules each one depends on.
+	router.HandleFunc("/prometheus/rules/graph", k.GetPrometheusRuleGraph).Methods("GET")
+
 	// swagger:operation GET /prometheus/rules/{name}/versions getPrometheusRuleVersions
 	// ---
 	// tags:
 	// - "Prometheus Alert Rules"
 	// summary: Display a list of older versions available for a Prometheus Alert Rules file
-	// description: Display a list of all older versions available for a provided Prometheus Alert Rules file
+	// description: Display a list of all older versions available for a provided Prometheus Alert Rules file, with the author, comment and ticket of the change that created each version.
+	// produces:
+	// - application/json
+	// - application/yaml
 	// parameters:
 	// - in: path
 	//   name: name
@@ -107,10 +477,34 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	//     description: Display a list of older versions available.
 	router.HandleFunc("/prometheus/rules/{name}/versions", k.GetPrometheusRuleVersions).Methods("GET")
 
+	// swagger:operation GET /prometheus/rules/{name}/status getPrometheusRuleStatus
+	// ---
+	// tags:
+	// - "Prometheus Alert Rules"
+	// summary: Display the state in Prometheus of the rules of a Prometheus Alert Rules file
+	// description: Join the rules of a Prometheus Alert Rules file with the rules and alerts of Prometheus, displaying the health, last error, evaluation time and pending or firing alerts of each rule, and flagging the rules Prometheus has not loaded.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: file name to search for
+	// responses:
+	//   "200":
+	//     description: The state of each rule.
+	//   "404":
+	//     description: No such rules file.
+	//   "503":
+	//     description: Prometheus could not be called.
+	router.HandleFunc("/prometheus/rules/{name}/status", k.GetPrometheusRuleStatus).Methods("GET")
+
 	// PUT /prometheus/rules has been deprecated in favor of PUT /prometheus/rules/{name}
 	// It has been removed from Swagger, but the endpoint will return a friendly error message
 	// for the time being.
-	router.HandleFunc("/prometheus/rules", k.PutPrometheusUnnamedRules).Methods("PUT")
+	router.HandleFunc("/prometheus/rules", k.audited(k.PutPrometheusUnnamedRules)).Methods("PUT")
 
 	// swagger:operation GET /prometheus/rules/{name} getPrometheusAlertRules
 	// ---
@@ -118,6 +512,9 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	// - "Prometheus Alert Rules"
 	// summary: Display the contents of a Prometheus Alert Rules file.
 	// description: Display the contents of a specific Prometheus Alert Rules file. If a version parameter is provided (optional), return the older version of that Alert Rules file.
+	// produces:
+	// - application/yaml
+	// - application/json
 	// parameters:
 	// - in: path
 	//   name: name
@@ -139,9 +536,11 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	// tags:
 	// - "Prometheus Alert Rules"
 	// summary: Replace contents of a current Prometheus Alert Rules file.
-	// description: Update the contents of a current Prometheus Alert Rules file.  If the file already exists, a copy will be saved prior to replacement.  If the file does not currently exist, a new rules file will be created.
+	// description: Update the contents of a current Prometheus Alert Rules file.  If the file already exists, a copy will be saved prior to replacement.  If the file does not currently exist, a new rules file will be created.  The file is checked against the rule lint policy; lint errors reject it, lint warnings are listed in the response.
 	// consumes:
+	// - application/yaml
 	// - application/x-yaml
+	// - application/json
 	// parameters:
 	// - in: path
 	//   name: name
@@ -154,10 +553,38 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	//   required: true
 	//   schema:
 	//     type: string
+	// - in: header
+	//   name: X-Change-Author
+	//   description: Author of the change, defaults to the authenticated user.  May also be passed as the author query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Comment
+	//   description: Reason for the change.  May also be passed as the comment query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Ticket
+	//   description: Ticket tracking the change.  May also be passed as the ticket query parameter.
+	//   required: false
+	//   type: string
+	// - in: query
+	//   name: force
+	//   type: boolean
+	//   required: false
+	//   description: Proceed even if rules of other files would no longer get the series they query
 	// responses:
 	//   "200":
 	//     description: Replace contents of a current Prometheus Alert Rules file.
-	router.HandleFunc("/prometheus/rules/{name}", k.PutPrometheusRules).Methods("PUT")
+	//   "400":
+	//     description: Invalid rules file, or lint errors.
+	//   "409":
+	//     description: Rules of other files query series the file would no longer record, and force was not set.
+	//   "415":
+	//     description: The Content-Type is neither JSON nor YAML.
+	//   "507":
+	//     description: The rules files would not fit in the rules ConfigMap and the shards mounted in Prometheus.
+	router.HandleFunc("/prometheus/rules/{name}", k.audited(k.PutPrometheusRules)).Methods("PUT")
 
 	// swagger:operation DELETE /prometheus/rules/{name} deletePrometheusAlertRules
 	// ---
@@ -171,10 +598,669 @@ func (k *K8s) NewRouter(config *restgo.Config) *mux.Router {
 	//   type: string
 	//   required: true
 	//   description: Name of file to delete
+	// - in: header
+	//   name: X-Change-Author
+	//   description: Author of the change, defaults to the authenticated user.  May also be passed as the author query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Comment
+	//   description: Reason for the change.  May also be passed as the comment query parameter.
+	//   required: false
+	//   type: string
+	// - in: header
+	//   name: X-Change-Ticket
+	//   description: Ticket tracking the change.  May also be passed as the ticket query parameter.
+	//   required: false
+	//   type: string
+	// - in: query
+	//   name: force
+	//   type: boolean
+	//   required: false
+	//   description: Proceed even if rules of other files would no longer get the series they query
 	// responses:
 	//   "200":
 	//     description: Delete a Prometheus Alert Rules file and all its older saved versions.
-	router.HandleFunc("/prometheus/rules/{name}", k.DeletePrometheusRules).Methods("DELETE")
+	//   "409":
+	//     description: Rules of other files query series recorded by the file, and force was not set.
+	router.HandleFunc("/prometheus/rules/{name}", k.audited(k.DeletePrometheusRules)).Methods("DELETE")
+
+	// swagger:operation POST /prometheus/rules/{name}/render renderPrometheusRules
+	// ---
+	// tags:
+	// - "Prometheus Alert Rules"
+	// summary: Render a rule template into a Prometheus Alert Rules file.
+	// description: Render a rule template with the given parameters, and save the result as the given Prometheus Alert Rules file, validated and versioned as with PUT.  The file keeps a link to the template, so it is rendered again when the template is updated.
+	// consumes:
+	// - application/yaml
+	// - application/json
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of file to create or update
+	// - in: body
+	//   name: body
+	//   description: 'The "template" to render, and its "parameters"'
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "202":
+	//     description: The rules file is being created or updated.
+	//   "400":
+	//     description: Missing parameters, or invalid rules.
+	//   "404":
+	//     description: No such rule template.
+	router.HandleFunc("/prometheus/rules/{name}/render", k.audited(k.RenderPrometheusRules)).Methods("POST")
+
+	//Rule Templates Routes
+	// swagger:operation GET /prometheus/rule-templates getRuleTemplateNames
+	// ---
+	// tags:
+	// - "Prometheus Rule Templates"
+	// summary: Display a list of all rule templates.
+	// description: Display a list of all rule templates.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all rule templates.
+	router.HandleFunc("/prometheus/rule-templates", k.GetRuleTemplateNames).Methods("GET")
+
+	// swagger:operation GET /prometheus/rule-templates/{name} getRuleTemplate
+	// ---
+	// tags:
+	// - "Prometheus Rule Templates"
+	// summary: Display a rule template.
+	// description: Display a rule template, rules YAML with <% .parameter %> placeholders.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the rule template
+	// responses:
+	//   "200":
+	//     description: The rule template.
+	//   "404":
+	//     description: No such rule template.
+	router.HandleFunc("/prometheus/rule-templates/{name}", k.GetRuleTemplate).Methods("GET")
+
+	// swagger:operation PUT /prometheus/rule-templates/{name} putRuleTemplate
+	// ---
+	// tags:
+	// - "Prometheus Rule Templates"
+	// summary: Create or update a rule template.
+	// description: Create or update a rule template, rules YAML with <% .parameter %> placeholders, and render again the rules files rendered from it.  If any of them no longer validates, nothing is changed.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the rule template
+	// - in: body
+	//   name: body
+	//   description: The rule template.
+	//   required: true
+	//   schema:
+	//     type: string
+	// - in: query
+	//   name: force
+	//   type: boolean
+	//   required: false
+	//   description: Proceed even if rules of other files would no longer get the series they query
+	// responses:
+	//   "200":
+	//     description: The rule template is saved, no rules file needed rendering again.
+	//   "202":
+	//     description: The rule template is saved, and its rules files are being updated.
+	//   "400":
+	//     description: Invalid template, or invalid rendered rules.
+	router.HandleFunc("/prometheus/rule-templates/{name}", k.audited(k.PutRuleTemplate)).Methods("PUT")
+
+	// swagger:operation DELETE /prometheus/rule-templates/{name} deleteRuleTemplate
+	// ---
+	// tags:
+	// - "Prometheus Rule Templates"
+	// summary: Delete a rule template.
+	// description: Delete a rule template no current rules file was rendered from.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the rule template
+	// responses:
+	//   "200":
+	//     description: The rule template is deleted.
+	//   "404":
+	//     description: No such rule template.
+	//   "409":
+	//     description: Rules files were rendered from the rule template.
+	router.HandleFunc("/prometheus/rule-templates/{name}", k.audited(k.DeleteRuleTemplate)).Methods("DELETE")
+
+	//Prometheus Target Groups Routes
+	// swagger:operation GET /prometheus/targets getTargetGroupNames
+	// ---
+	// tags:
+	// - "Prometheus Target Groups"
+	// summary: Display a list of all target groups.
+	// description: Display a list of all groups of static targets scraped by the managed-targets job.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all target groups.
+	router.HandleFunc("/prometheus/targets", k.GetTargetGroupNames).Methods("GET")
+
+	// swagger:operation GET /prometheus/targets/{group} getTargetGroup
+	// ---
+	// tags:
+	// - "Prometheus Target Groups"
+	// summary: Display a target group.
+	// description: Display the targets and labels of a target group.
+	// parameters:
+	// - in: path
+	//   name: group
+	//   type: string
+	//   required: true
+	//   description: Name of the target group
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The target group.
+	//   "404":
+	//     description: No such target group.
+	router.HandleFunc("/prometheus/targets/{group}", k.GetTargetGroup).Methods("GET")
+
+	// swagger:operation PUT /prometheus/targets/{group} putTargetGroup
+	// ---
+	// tags:
+	// - "Prometheus Target Groups"
+	// summary: Create or update a target group.
+	// description: Create or update a group of static targets, saved as a file_sd_configs target file.  The first group adds the managed-targets scrape job to prometheus.yml, later changes only update the target files.
+	// parameters:
+	// - in: path
+	//   name: group
+	//   type: string
+	//   required: true
+	//   description: Name of the target group
+	// - in: body
+	//   name: body
+	//   description: 'The targets, host:port, and labels, e.g. {"targets": ["db-1:9100"], "labels": {"env": "prod"}}.'
+	//   required: true
+	//   schema:
+	//     type: object
+	// responses:
+	//   "202":
+	//     description: The target group is being saved.
+	//   "400":
+	//     description: Invalid target group.
+	//   "409":
+	//     description: The targets ConfigMap is not mounted in the Prometheus pods.
+	//   "507":
+	//     description: The target groups would not fit in the targets ConfigMap and the shards mounted in Prometheus.
+	router.HandleFunc("/prometheus/targets/{group}", k.audited(k.PutTargetGroup)).Methods("PUT")
+
+	// swagger:operation DELETE /prometheus/targets/{group} deleteTargetGroup
+	// ---
+	// tags:
+	// - "Prometheus Target Groups"
+	// summary: Delete a target group.
+	// description: Delete a target group.  The managed-targets scrape job stays in prometheus.yml.
+	// parameters:
+	// - in: path
+	//   name: group
+	//   type: string
+	//   required: true
+	//   description: Name of the target group
+	// responses:
+	//   "202":
+	//     description: The target group is being deleted.
+	//   "404":
+	//     description: No such target group.
+	//   "409":
+	//     description: The targets ConfigMap is not mounted in the Prometheus pods.
+	//   "507":
+	//     description: The target groups would not fit in the targets ConfigMap and the shards mounted in Prometheus.
+	router.HandleFunc("/prometheus/targets/{group}", k.audited(k.DeleteTargetGroup)).Methods("DELETE")
+
+	//Alertmanager Templates Routes
+	// swagger:operation GET /alertmanager/templates getAlertmanagerTemplateNames
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Display a list of all Alertmanager template files.
+	// description: Display a list of all Alertmanager template files.
+	// responses:
+	//   "200":
+	//     description: Display a list of all Alertmanager template files.
+	router.HandleFunc("/alertmanager/templates", k.GetAllAlertmanagerTemplatesFileNames).Methods("GET")
+
+	// swagger:operation GET /alertmanager/templates/{name} getAlertmanagerTemplate
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Display an Alertmanager template file.
+	// description: Display an Alertmanager template file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the template file
+	// responses:
+	//   "200":
+	//     description: The template file.
+	//   "400":
+	//     description: No such template file.
+	router.HandleFunc("/alertmanager/templates/{name}", k.GetAlertmanagerTemplate).Methods("GET")
+
+	// swagger:operation PUT /alertmanager/templates/{name} putAlertmanagerTemplate
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Create or update an Alertmanager template file.
+	// description: Create or update an Alertmanager template file, named *.tmpl.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the template file
+	// - in: body
+	//   name: body
+	//   description: The template file.
+	//   required: true
+	//   schema:
+	//     type: string
+	// responses:
+	//   "202":
+	//     description: The template file is being saved.
+	//   "400":
+	//     description: Invalid file name.
+	router.HandleFunc("/alertmanager/templates/{name}", k.audited(k.PutAlertmanagerTemplate)).Methods("PUT")
+
+	// swagger:operation DELETE /alertmanager/templates/{name} deleteAlertmanagerTemplate
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Delete an Alertmanager template file.
+	// description: Delete an Alertmanager template file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the template file
+	// responses:
+	//   "202":
+	//     description: The template file is being deleted.
+	//   "400":
+	//     description: No such template file.
+	router.HandleFunc("/alertmanager/templates/{name}", k.audited(k.DeleteAlertmanagerTemplate)).Methods("DELETE")
+
+	// swagger:operation POST /alertmanager/templates/{name}/preview previewAlertmanagerTemplate
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Preview an Alertmanager template definition.
+	// description: Render a template definition, such as slack.default.text, with the default and saved templates, against the given alerts or sample ones.  Definitions named *.html, or ?format=html, are rendered as HTML.  Nothing is saved.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the template definition
+	// - in: query
+	//   name: format
+	//   type: string
+	//   required: false
+	//   description: html to render as HTML
+	// - in: body
+	//   name: body
+	//   description: 'Optional: data, the alerts, as the template.Data of Alertmanager, and template, the content of a template file not saved yet, replacing the saved file if given.'
+	//   required: false
+	//   schema:
+	//     type: object
+	// produces:
+	// - text/plain
+	// - text/html
+	// responses:
+	//   "200":
+	//     description: The rendered template definition.
+	//   "400":
+	//     description: Invalid templates.
+	//   "404":
+	//     description: No such template definition.
+	router.HandleFunc("/alertmanager/templates/{name}/preview", k.PreviewAlertmanagerTemplate).Methods("POST")
+
+	//Alertmanager Silences Routes
+	// swagger:operation GET /alertmanager/silences getSilences
+	// ---
+	// tags:
+	// - "Alertmanager Silences"
+	// summary: Display the silences of Alertmanager.
+	// description: Display the silences of Alertmanager, called on a ready Alertmanager pod.
+	// parameters:
+	// - in: query
+	//   name: state
+	//   type: string
+	//   enum: [active, pending, expired]
+	//   required: false
+	//   description: Only display the silences in this state
+	// - in: query
+	//   name: filter
+	//   type: array
+	//   items:
+	//     type: string
+	//   collectionFormat: multi
+	//   required: false
+	//   description: Only display the silences with these matchers, e.g. job="api"
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The silences.
+	//   "503":
+	//     description: Alertmanager could not be called.
+	router.HandleFunc("/alertmanager/silences", k.GetSilences).Methods("GET")
+
+	// swagger:operation POST /alertmanager/silences createSilence
+	// ---
+	// tags:
+	// - "Alertmanager Silences"
+	// summary: Create a silence.
+	// description: Create a silence, starting now or scheduled for later.  The alerts silenced are given as matchers, or as a selector such as {job="api",severity=~"warning|critical"}.
+	// parameters:
+	// - in: body
+	//   name: body
+	//   description: 'The silence: matchers or selector, startsAt, now by default, endsAt or duration, createdBy and comment, by default the change author and comment.'
+	//   required: true
+	//   schema:
+	//     type: object
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The silence created, with its ID.
+	//   "400":
+	//     description: Invalid silence.
+	//   "503":
+	//     description: Alertmanager could not be called.
+	router.HandleFunc("/alertmanager/silences", k.audited(k.CreateSilence)).Methods("POST")
+
+	// swagger:operation DELETE /alertmanager/silences/{id} expireSilence
+	// ---
+	// tags:
+	// - "Alertmanager Silences"
+	// summary: Expire a silence.
+	// description: Expire a silence, ending it now.
+	// parameters:
+	// - in: path
+	//   name: id
+	//   type: string
+	//   required: true
+	//   description: ID of the silence
+	// responses:
+	//   "200":
+	//     description: The silence is expired.
+	//   "404":
+	//     description: No such silence.
+	//   "503":
+	//     description: Alertmanager could not be called.
+	router.HandleFunc("/alertmanager/silences/{id}", k.audited(k.ExpireSilence)).Methods("DELETE")
+
+	// swagger:operation POST /alertmanager/test-notification sendTestNotification
+	// ---
+	// tags:
+	// - "Alertmanager Templates"
+	// summary: Fire a test notification.
+	// description: Post a synthetic alert to Alertmanager, with a unique test_notification label and ending after 5 minutes, and report whether Alertmanager routed it to the given receiver.
+	// parameters:
+	// - in: body
+	//   name: body
+	//   description: 'The receiver, and the labels and annotations of the alert, e.g. {"receiver": "slack", "alert": {"labels": {"severity": "critical"}}}.'
+	//   required: true
+	//   schema:
+	//     type: object
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The receivers the alert was routed to, and whether they include the given one.
+	//   "404":
+	//     description: No such receiver.
+	//   "503":
+	//     description: Alertmanager could not be called.
+	router.HandleFunc("/alertmanager/test-notification", k.audited(k.SendTestNotification)).Methods("POST")
+
+	//SLO Routes
+	// swagger:operation GET /slos getSLONames
+	// ---
+	// tags:
+	// - "Service Level Objectives"
+	// summary: Display a list of all SLOs.
+	// description: Display a list of all service level objectives.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all SLOs.
+	router.HandleFunc("/slos", k.GetSLONames).Methods("GET")
+
+	// swagger:operation GET /slos/{name} getSLO
+	// ---
+	// tags:
+	// - "Service Level Objectives"
+	// summary: Display an SLO.
+	// description: Display the definition of a service level objective.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the SLO
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The SLO.
+	//   "404":
+	//     description: No such SLO.
+	router.HandleFunc("/slos/{name}", k.GetSLO).Methods("GET")
+
+	// swagger:operation PUT /slos/{name} putSLO
+	// ---
+	// tags:
+	// - "Service Level Objectives"
+	// summary: Create or update an SLO.
+	// description: Create or update a service level objective, generating its error ratio recording rules and multi-window burn rate alerts into the rules file slo-{name}.rules.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the SLO
+	// - in: body
+	//   name: body
+	//   description: 'The SLO: sli.good and sli.total, the PromQL of the good and of all events, target, e.g. 0.999, window, 30d by default, and labels added to its alerts.'
+	//   required: true
+	//   schema:
+	//     type: object
+	// - in: query
+	//   name: force
+	//   type: boolean
+	//   required: false
+	//   description: Proceed even if rules of other files would no longer get the series they query
+	// responses:
+	//   "202":
+	//     description: The rules of the SLO are being saved.
+	//   "400":
+	//     description: Invalid SLO, or invalid generated rules.
+	router.HandleFunc("/slos/{name}", k.audited(k.PutSLO)).Methods("PUT")
+
+	// swagger:operation DELETE /slos/{name} deleteSLO
+	// ---
+	// tags:
+	// - "Service Level Objectives"
+	// summary: Delete an SLO.
+	// description: Delete a service level objective and its rules file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the SLO
+	// - in: query
+	//   name: force
+	//   type: boolean
+	//   required: false
+	//   description: Proceed even if other rules query series of the SLO
+	// responses:
+	//   "202":
+	//     description: The SLO is being deleted.
+	//   "404":
+	//     description: No such SLO.
+	//   "409":
+	//     description: Other rules query series of the SLO.
+	router.HandleFunc("/slos/{name}", k.audited(k.DeleteSLO)).Methods("DELETE")
+
+	//Canary Routes
+	// swagger:operation GET /canaries getCanaryNames
+	// ---
+	// tags:
+	// - "Canaries"
+	// summary: Display a list of all canaries.
+	// description: Display a list of all synthetic HTTP checks.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: Display a list of all canaries.
+	router.HandleFunc("/canaries", k.GetCanaryNames).Methods("GET")
+
+	// swagger:operation GET /canaries/{name} getCanary
+	// ---
+	// tags:
+	// - "Canaries"
+	// summary: Display a canary.
+	// description: Display the definition of a synthetic HTTP check.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the canary
+	// produces:
+	// - application/json
+	// - application/yaml
+	// responses:
+	//   "200":
+	//     description: The canary.
+	//   "404":
+	//     description: No such canary.
+	router.HandleFunc("/canaries/{name}", k.GetCanary).Methods("GET")
+
+	// swagger:operation PUT /canaries/{name} putCanary
+	// ---
+	// tags:
+	// - "Canaries"
+	// summary: Create or update a canary.
+	// description: Create or update a synthetic HTTP check, generating its blackbox exporter scrape job canary-{name} in prometheus.yml, and its CanaryDown_{name} alert into the rules file canary-{name}.rules.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the canary
+	// - in: body
+	//   name: body
+	//   description: 'The canary: url, method, GET by default, expectedStatus, 200 by default, interval, 1m by default, and labels added to its alert.'
+	//   required: true
+	//   schema:
+	//     type: object
+	// responses:
+	//   "202":
+	//     description: The scrape job and the rules of the canary are being saved.
+	//   "400":
+	//     description: Invalid canary, or invalid generated scrape job or rules.
+	router.HandleFunc("/canaries/{name}", k.audited(k.PutCanary)).Methods("PUT")
+
+	// swagger:operation DELETE /canaries/{name} deleteCanary
+	// ---
+	// tags:
+	// - "Canaries"
+	// summary: Delete a canary.
+	// description: Delete a synthetic HTTP check, its scrape job and its rules file.
+	// parameters:
+	// - in: path
+	//   name: name
+	//   type: string
+	//   required: true
+	//   description: Name of the canary
+	// responses:
+	//   "202":
+	//     description: The canary is being deleted.
+	//   "404":
+	//     description: No such canary.
+	router.HandleFunc("/canaries/{name}", k.audited(k.DeleteCanary)).Methods("DELETE")
+
+	//PushGateway Routes
+	// swagger:operation GET /pushgateway/groups getPushGatewayGroups
+	// ---
+	// tags:
+	// - "PushGateway"
+	// summary: Display the groups of the PushGateway.
+	// description: Display the groups of metrics pushed to the PushGateway, with their grouping labels, metric names, and the time of their last successful and failed push.
+	// produces:
+	// - application/json
+	// - application/yaml
+	// parameters:
+	// - in: query
+	//   name: job
+	//   type: string
+	//   required: false
+	//   description: Only display the groups of this job
+	// responses:
+	//   "200":
+	//     description: The groups of the PushGateway.
+	//   "503":
+	//     description: The PushGateway could not be called.
+	router.HandleFunc("/pushgateway/groups", k.GetPushGatewayGroups).Methods("GET")
+
+	// swagger:operation DELETE /pushgateway/groups/{job} deletePushGatewayGroup
+	// ---
+	// tags:
+	// - "PushGateway"
+	// summary: Delete a group of the PushGateway.
+	// description: Delete all the metrics of the group of the given job and grouping labels, given as query parameters, e.g. ?instance=batch-1.
+	// parameters:
+	// - in: path
+	//   name: job
+	//   type: string
+	//   required: true
+	//   description: Job of the group
+	// responses:
+	//   "200":
+	//     description: The group was deleted.
+	//   "404":
+	//     description: No such group.
+	//   "503":
+	//     description: The PushGateway could not be called.
+	router.HandleFunc("/pushgateway/groups/{job}", k.audited(k.DeletePushGatewayGroup)).Methods("DELETE")
 
 	router.Handle("/{rest}", http.FileServer(http.Dir(staticPath)))
 
@@ -0,0 +1,156 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/template"
+	"sigs.k8s.io/yaml"
+)
+
+// Variables available to alert annotations, as in Prometheus
+const alertTemplateDefs = "{{$labels := .Labels}}{{$externalLabels := .ExternalLabels}}{{$value := .Value}}"
+
+// RuleEvaluationRequest is the body of POST /prometheus/rules/evaluate: a rules file, or a single expression.  The
+// expressions are evaluated at the given time, now by default, or over the given range if a start is given.
+type RuleEvaluationRequest struct {
+	RuleFile
+	Expr  string `json:"expr,omitempty"`
+	Time  string `json:"time,omitempty"`
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+	Step  string `json:"step,omitempty"`
+}
+
+// RuleEvaluation is the result of evaluating one rule.  Alerts is the number of alerts the rule would raise, not
+// taking its "for" duration into account, and Annotations are the annotations of each of them.
+type RuleEvaluation struct {
+	Group       string              `json:"group,omitempty"`
+	Alert       string              `json:"alert,omitempty"`
+	Record      string              `json:"record,omitempty"`
+	Expr        string              `json:"expr"`
+	Series      []PrometheusSeries  `json:"series"`
+	Alerts      int                 `json:"alerts"`
+	Annotations []map[string]string `json:"annotations,omitempty"`
+	Error       string              `json:"error,omitempty"`
+}
+
+// EvaluatePrometheusRules runs the expressions of the given rules against Prometheus, and returns the series each one
+// matches, and the alerts it would raise.
+func (k *K8s) EvaluatePrometheusRules(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request RuleEvaluationRequest
+	if err := yaml.Unmarshal(b, &request); err != nil {
+		validationFailed(w, r, CodeInvalidYAML, "ERROR: Unable to parse the rules to evaluate: "+err.Error(), err.Error())
+		return
+	}
+	if request.Expr != "" {
+		request.Groups = append(request.Groups, RuleGroup{Rules: []Rule{{Expr: request.Expr}}})
+	}
+	if len(request.Groups) == 0 {
+		badRequest(w, r, "ERROR: Either an expr or rule groups must be provided.")
+		return
+	}
+	if request.Start != "" && (request.End == "" || request.Step == "") {
+		badRequest(w, r, "ERROR: A range evaluation needs a start, an end and a step.")
+		return
+	}
+
+	evaluationTime := time.Now()
+	params := url.Values{}
+	if request.Start != "" {
+		params.Set("start", request.Start)
+		params.Set("end", request.End)
+		params.Set("step", request.Step)
+	} else if request.Time != "" {
+		params.Set("time", request.Time)
+		if t, err := time.Parse(time.RFC3339, request.Time); err == nil {
+			evaluationTime = t
+		}
+	}
+
+	results := make([]RuleEvaluation, 0)
+	alerts := 0
+	for _, group := range request.Groups {
+		for _, rule := range group.Rules {
+			result := evaluateRule(r.Context(), group.Name, rule, params, evaluationTime)
+			alerts += result.Alerts
+			results = append(results, result)
+		}
+	}
+	successJSON(w, r, map[string]interface{}{"prometheusURL": getPrometheusURL(), "alerts": alerts, "results": results})
+}
+
+// evaluateRule runs the expression of a rule, and renders the annotations of each alert it would raise.
+func evaluateRule(ctx context.Context, group string, rule Rule, params url.Values, evaluationTime time.Time) RuleEvaluation {
+	result := RuleEvaluation{Group: group, Alert: rule.Alert, Record: rule.Record, Expr: rule.Expr, Series: []PrometheusSeries{}}
+	if rule.Expr == "" {
+		result.Error = "the rule has no expr"
+		return result
+	}
+	query := url.Values{}
+	for key, values := range params {
+		query[key] = values
+	}
+	query.Set("query", rule.Expr)
+	series, err := queryPrometheus(query)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return toLabelSet(series[i].Metric).Before(toLabelSet(series[j].Metric))
+	})
+	result.Series = series
+	if rule.Alert == "" {
+		return result
+	}
+
+	result.Alerts = len(series)
+	externalURL, _ := url.Parse(getPrometheusURL())
+	for _, s := range series {
+		// As in Prometheus, the alert has the labels of the series, overridden by those of the rule, without a name
+		alertLabels := make(map[string]string)
+		for name, value := range s.Metric {
+			if name != model.MetricNameLabel {
+				alertLabels[name] = value
+			}
+		}
+		for name, value := range rule.Labels {
+			alertLabels[name] = value
+		}
+		data := template.AlertTemplateData(alertLabels, map[string]string{}, s.LastValue())
+		annotations := make(map[string]string)
+		for name, text := range rule.Annotations {
+			expander := template.NewTemplateExpander(ctx, alertTemplateDefs+text, "__alert_"+rule.Alert, data,
+				model.TimeFromUnixNano(evaluationTime.UnixNano()), prometheusQueryFunc, externalURL)
+			expanded, err := expander.Expand()
+			if err != nil {
+				expanded = "<error expanding template: " + err.Error() + ">"
+			}
+			annotations[name] = expanded
+		}
+		result.Annotations = append(result.Annotations, annotations)
+	}
+	return result
+}
+
+func toLabelSet(metric map[string]string) model.LabelSet {
+	labelSet := make(model.LabelSet, len(metric))
+	for name, value := range metric {
+		labelSet[model.LabelName(name)] = model.LabelValue(value)
+	}
+	return labelSet
+}
@@ -0,0 +1,136 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// newFakePrometheus returns a server answering queries of the Prometheus HTTP API: "up == 0" matches two series,
+// "vector(1)" one, and anything else none, except "bad(" which is an invalid expression.
+func newFakePrometheus(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		query := r.URL.Query().Get("query")
+		if query == "bad(" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"status":"error","errorType":"bad_data","error":"parse error: unexpected end of input"}`)
+			return
+		}
+		result := `[]`
+		switch query {
+		case "up == 0":
+			result = `[{"metric":{"__name__":"up","job":"node","instance":"a:9100"},"value":[1600000000,"0"]},
+				{"metric":{"__name__":"up","job":"node","instance":"b:9100"},"value":[1600000000,"0"]}]`
+		case "vector(1)":
+			result = `[{"metric":{},"value":[1600000000,"1"]}]`
+		}
+		switch r.URL.Path {
+		case "/api/v1/query":
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"vector","result":%s}}`, result)
+		case "/api/v1/query_range":
+			result = strings.Replace(result, `"value":[1600000000,"0"]`, `"values":[[1600000000,"0"],[1600000060,"0"]]`, -1)
+			fmt.Fprintf(w, `{"status":"success","data":{"resultType":"matrix","result":%s}}`, result)
+		default:
+			t.Errorf("unexpected request: %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestEvaluatePrometheusRules(t *testing.T) {
+	vmiName = "vmi-evaluate-test"
+	namespace = "vmi-evaluate-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	handler := http.HandlerFunc(testclient.EvaluatePrometheusRules)
+
+	server := newFakePrometheus(t)
+	defer server.Close()
+	prometheusURL = server.URL
+	defer func() { prometheusURL = "" }()
+
+	body := `groups:
+- name: node
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: 'Instance {{ $labels.instance }} of {{ $labels.job }} is down'
+      value: '{{ $value }} ({{ $labels.severity }})'
+  - record: job:up:sum
+    expr: vector(1)
+  - alert: Broken
+    expr: bad(
+`
+	req, err := http.NewRequest("POST", "/prometheus/rules/evaluate", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusOK)
+
+	var response struct {
+		Alerts  int              `json:"alerts"`
+		Results []RuleEvaluation `json:"results"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Alerts != 2 || len(response.Results) != 3 {
+		t.Fatalf("unexpected response: %s", rr.Body.String())
+	}
+	instanceDown := response.Results[0]
+	if instanceDown.Alerts != 2 || len(instanceDown.Series) != 2 || len(instanceDown.Annotations) != 2 {
+		t.Fatalf("unexpected InstanceDown result: %+v", instanceDown)
+	}
+	if summary := instanceDown.Annotations[0]["summary"]; summary != "Instance a:9100 of node is down" {
+		t.Errorf("unexpected summary: %s", summary)
+	}
+	if value := instanceDown.Annotations[1]["value"]; value != "0 (critical)" {
+		t.Errorf("unexpected value annotation: %s", value)
+	}
+	if record := response.Results[1]; record.Alerts != 0 || len(record.Series) != 1 || record.Error != "" {
+		t.Errorf("unexpected recording rule result: %+v", record)
+	}
+	if broken := response.Results[2]; !strings.Contains(broken.Error, "parse error") {
+		t.Errorf("expected the query error of the broken rule, got %+v", broken)
+	}
+
+	// A single expression, over a range
+	body = `{"expr": "up == 0", "start": "2020-09-13T12:26:40Z", "end": "2020-09-13T12:27:40Z", "step": "60s"}`
+	req, err = http.NewRequest("POST", "/prometheus/rules/evaluate", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, `"values"`)
+
+	// Nothing to evaluate
+	req, err = http.NewRequest("POST", "/prometheus/rules/evaluate", strings.NewReader(`time: "2020-09-13T12:26:40Z"`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verify(t, rr, http.StatusBadRequest, "Either an expr or rule groups must be provided")
+
+	// A range without a step
+	req, err = http.NewRequest("POST", "/prometheus/rules/evaluate", strings.NewReader(`{"expr": "up", "start": "1600000000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	verifyStatus(t, rr, http.StatusBadRequest)
+}
@@ -0,0 +1,47 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"sigs.k8s.io/yaml"
+)
+
+// RuleFile is a Prometheus rules file, as stored in the alertrules ConfigMap.
+type RuleFile struct {
+	Groups []RuleGroup `json:"groups"`
+}
+
+// RuleGroup is a group of rules evaluated together.
+type RuleGroup struct {
+	Name     string `json:"name"`
+	Interval string `json:"interval,omitempty"`
+	Rules    []Rule `json:"rules"`
+}
+
+// Rule is an alerting rule if Alert is set, or a recording rule if Record is set.
+type Rule struct {
+	Record      string            `json:"record,omitempty"`
+	Alert       string            `json:"alert,omitempty"`
+	Expr        string            `json:"expr"`
+	For         string            `json:"for,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Name returns the name of the alert, or of the series recorded.
+func (rule Rule) Name() string {
+	if rule.Alert != "" {
+		return rule.Alert
+	}
+	return rule.Record
+}
+
+// parseRuleFile parses the given YAML or JSON rules file.
+func parseRuleFile(b []byte) (*RuleFile, error) {
+	var ruleFile RuleFile
+	if err := yaml.Unmarshal(b, &ruleFile); err != nil {
+		return nil, err
+	}
+	return &ruleFile, nil
+}
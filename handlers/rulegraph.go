@@ -0,0 +1,235 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// ContentTypeDOT media type of the rule dependency graph in the Graphviz DOT language
+const ContentTypeDOT = "text/vnd.graphviz"
+
+// Types of rule graph nodes
+const (
+	ruleTypeRecord = "record"
+	ruleTypeAlert  = "alert"
+)
+
+// RuleGraph is the dependency graph of the current rules: which rules query the series recorded by which recording
+// rules.
+type RuleGraph struct {
+	Nodes []RuleGraphNode `json:"nodes"`
+	Edges []RuleGraphEdge `json:"edges"`
+}
+
+// RuleGraphNode is a rule.  Error is set if its expression cannot be parsed, in which case its dependencies are unknown.
+type RuleGraphNode struct {
+	ID    string `json:"id"`
+	File  string `json:"file"`
+	Group string `json:"group"`
+	Name  string `json:"name"`
+	Type  string `json:"type"`
+	Error string `json:"error,omitempty"`
+}
+
+// RuleGraphEdge is a rule, From, querying the Series recorded by a recording rule, To.
+type RuleGraphEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to,omitempty"`
+	Series string `json:"series"`
+}
+
+// ruleGraphRule is a node with the series its expression queries.
+type ruleGraphRule struct {
+	node   RuleGraphNode
+	record string
+	series []string
+}
+
+// queriedSeries returns the names of the series an expression selects.  Selectors without a name, or matching names
+// with a regular expression, cannot depend on a single recording rule and are left out.
+func queriedSeries(expr string) ([]string, error) {
+	parsed, err := parser.ParseExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var series []string
+	parser.Inspect(parsed, func(node parser.Node, _ []parser.Node) error {
+		selector, ok := node.(*parser.VectorSelector)
+		if !ok {
+			return nil
+		}
+		name := selector.Name
+		for _, matcher := range selector.LabelMatchers {
+			if matcher.Name == labels.MetricName && matcher.Type == labels.MatchEqual {
+				name = matcher.Value
+			}
+		}
+		if name != "" && !seen[name] {
+			seen[name] = true
+			series = append(series, name)
+		}
+		return nil
+	})
+	sort.Strings(series)
+	return series, nil
+}
+
+// ruleGraphRules returns the rules of the given files, in a stable order, with the series each one queries.
+func ruleGraphRules(files map[string]*RuleFile) []ruleGraphRule {
+	fileNames := make([]string, 0, len(files))
+	for fileName := range files {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	var rules []ruleGraphRule
+	ids := make(map[string]int)
+	for _, fileName := range fileNames {
+		for _, group := range files[fileName].Groups {
+			for _, rule := range group.Rules {
+				node := RuleGraphNode{File: fileName, Group: group.Name, Name: rule.Name(), Type: ruleTypeAlert}
+				if rule.Record != "" {
+					node.Type = ruleTypeRecord
+				}
+				// Rules of a group may share a name, so the ID of the later ones is numbered
+				node.ID = fileName + "/" + group.Name + "/" + node.Name
+				ids[node.ID]++
+				if ids[node.ID] > 1 {
+					node.ID += "#" + strconv.Itoa(ids[node.ID])
+				}
+				series, err := queriedSeries(rule.Expr)
+				if err != nil {
+					node.Error = err.Error()
+				}
+				rules = append(rules, ruleGraphRule{node: node, record: rule.Record, series: series})
+			}
+		}
+	}
+	return rules
+}
+
+// buildRuleGraph returns the dependency graph of the rules of the given files.
+func buildRuleGraph(files map[string]*RuleFile) *RuleGraph {
+	rules := ruleGraphRules(files)
+	recorders := make(map[string][]string)
+	for _, rule := range rules {
+		if rule.record != "" {
+			recorders[rule.record] = append(recorders[rule.record], rule.node.ID)
+		}
+	}
+	graph := &RuleGraph{Nodes: make([]RuleGraphNode, 0, len(rules)), Edges: make([]RuleGraphEdge, 0)}
+	for _, rule := range rules {
+		graph.Nodes = append(graph.Nodes, rule.node)
+		for _, series := range rule.series {
+			for _, recorder := range recorders[series] {
+				graph.Edges = append(graph.Edges, RuleGraphEdge{From: rule.node.ID, To: recorder, Series: series})
+			}
+		}
+	}
+	return graph
+}
+
+// DOT returns the graph in the Graphviz DOT language, recording rules as boxes and alerting rules as ellipses.
+func (graph *RuleGraph) DOT() string {
+	var b strings.Builder
+	b.WriteString("digraph rules {\n")
+	for _, node := range graph.Nodes {
+		shape := "ellipse"
+		if node.Type == ruleTypeRecord {
+			shape = "box"
+		}
+		fmt.Fprintf(&b, "  %s [label=%s, shape=%s];\n", strconv.Quote(node.ID), strconv.Quote(node.Name), shape)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(edge.From), strconv.Quote(edge.To))
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// orphanedRules returns the rules of the after files querying series recorded in the before files, but no longer
+// recorded in the after files.  To is left empty in the returned edges.
+func orphanedRules(before map[string]*RuleFile, after map[string]*RuleFile) []RuleGraphEdge {
+	recordedBefore := make(map[string]bool)
+	for _, rule := range ruleGraphRules(before) {
+		if rule.record != "" {
+			recordedBefore[rule.record] = true
+		}
+	}
+	afterRules := ruleGraphRules(after)
+	recordedAfter := make(map[string]bool)
+	for _, rule := range afterRules {
+		if rule.record != "" {
+			recordedAfter[rule.record] = true
+		}
+	}
+	var orphans []RuleGraphEdge
+	for _, rule := range afterRules {
+		for _, series := range rule.series {
+			if recordedBefore[series] && !recordedAfter[series] {
+				orphans = append(orphans, RuleGraphEdge{From: rule.node.ID, Series: series})
+			}
+		}
+	}
+	return orphans
+}
+
+// parseRuleFiles parses the given rules files.  Files that cannot be parsed are skipped, they were checked when saved.
+func parseRuleFiles(current map[string]string) map[string]*RuleFile {
+	return parseOtherRuleFiles(current, "")
+}
+
+// checkOrphanedRules refuses a change of the given rules file that would leave rules querying series no longer
+// recorded, unless forced with ?force=true.  Content is the new content of the file, empty when deleting it.  A forced
+// change returns the rules orphaned, formatted to be appended to the response.
+func checkOrphanedRules(r *http.Request, fileName string, content string, current map[string]string) (string, *Problem) {
+	before := parseRuleFiles(current)
+	after := parseOtherRuleFiles(current, fileName)
+	if content != "" {
+		if ruleFile, err := parseRuleFile([]byte(content)); err == nil {
+			after[fileName] = ruleFile
+		}
+	}
+	orphans := orphanedRules(before, after)
+	if len(orphans) == 0 {
+		return "", nil
+	}
+	lines := make([]string, 0, len(orphans))
+	for _, orphan := range orphans {
+		lines = append(lines, orphan.From+" queries "+orphan.Series)
+	}
+	message := strings.Join(lines, "\n")
+	if r.URL.Query().Get("force") != "true" {
+		return "", &Problem{Status: http.StatusConflict, Code: CodeRuleHasDependents, Detail: "No action taken.  Rules query " +
+			"series this change would no longer record, use ?force=true to proceed anyway:\n" + message}
+	}
+	requestLogger(r).Warnw("Forced a change orphaning dependent rules", "orphans", len(orphans))
+	return "\nDependent rules no longer getting their series:\n" + message, nil
+}
+
+// GetPrometheusRuleGraph returns the dependency graph of the current rules, as JSON, or as DOT if asked for with
+// ?format=dot or Accept: text/vnd.graphviz.
+func (k *K8s) GetPrometheusRuleGraph(w http.ResponseWriter, r *http.Request) {
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	graph := buildRuleGraph(parseRuleFiles(currentConfigMap))
+	if r.URL.Query().Get("format") == "dot" || strings.Contains(r.Header.Get("Accept"), ContentTypeDOT) {
+		w.Header().Set("Content-Type", ContentTypeDOT)
+		successBytes(w, r, []byte(graph.DOT()))
+		return
+	}
+	successJSON(w, r, graph)
+}
@@ -0,0 +1,105 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQueriedSeries(t *testing.T) {
+	series, err := queriedSeries(`sum(rate(http_requests_total{code=~"5.."}[5m])) / job:http_requests:rate5m ` +
+		`+ on() {__name__="job:http_errors:rate5m"} + count({job="node"}) + count({__name__=~"node_.*"})`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"http_requests_total", "job:http_errors:rate5m", "job:http_requests:rate5m"}
+	if !reflect.DeepEqual(series, expected) {
+		t.Errorf("got %v want %v", series, expected)
+	}
+	if _, err := queriedSeries("sum(up"); err == nil {
+		t.Error("expected a parse error")
+	}
+}
+
+func testRuleGraphFiles(t *testing.T) map[string]*RuleFile {
+	files := make(map[string]*RuleFile)
+	for fileName, content := range map[string]string{
+		"recording.rules": `groups:
+- name: http
+  rules:
+  - record: job:http_requests:rate5m
+    expr: sum by (job) (rate(http_requests_total[5m]))
+  - record: job:http_errors:rate5m
+    expr: sum by (job) (rate(http_requests_total{code=~"5.."}[5m]))
+`,
+		"alerts.rules": `groups:
+- name: http
+  rules:
+  - alert: HighErrorRate
+    expr: job:http_errors:rate5m / job:http_requests:rate5m > 0.05
+  - alert: Broken
+    expr: sum(up
+`,
+	} {
+		ruleFile, err := parseRuleFile([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[fileName] = ruleFile
+	}
+	return files
+}
+
+func TestBuildRuleGraph(t *testing.T) {
+	graph := buildRuleGraph(testRuleGraphFiles(t))
+	if len(graph.Nodes) != 4 {
+		t.Fatalf("unexpected nodes: %+v", graph.Nodes)
+	}
+	if graph.Nodes[0].ID != "alerts.rules/http/HighErrorRate" || graph.Nodes[0].Type != ruleTypeAlert {
+		t.Errorf("unexpected node: %+v", graph.Nodes[0])
+	}
+	if graph.Nodes[1].Error == "" {
+		t.Errorf("expected a parse error for %+v", graph.Nodes[1])
+	}
+	expected := []RuleGraphEdge{
+		{From: "alerts.rules/http/HighErrorRate", To: "recording.rules/http/job:http_errors:rate5m", Series: "job:http_errors:rate5m"},
+		{From: "alerts.rules/http/HighErrorRate", To: "recording.rules/http/job:http_requests:rate5m", Series: "job:http_requests:rate5m"},
+	}
+	if !reflect.DeepEqual(graph.Edges, expected) {
+		t.Errorf("got %+v want %+v", graph.Edges, expected)
+	}
+
+	dot := graph.DOT()
+	for _, line := range []string{
+		`"recording.rules/http/job:http_errors:rate5m" [label="job:http_errors:rate5m", shape=box];`,
+		`"alerts.rules/http/HighErrorRate" -> "recording.rules/http/job:http_requests:rate5m";`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("cannot find '%s' in:\n%s", line, dot)
+		}
+	}
+}
+
+func TestOrphanedRules(t *testing.T) {
+	before := testRuleGraphFiles(t)
+	after := testRuleGraphFiles(t)
+	delete(after, "recording.rules")
+
+	orphans := orphanedRules(before, after)
+	expected := []RuleGraphEdge{
+		{From: "alerts.rules/http/HighErrorRate", Series: "job:http_errors:rate5m"},
+		{From: "alerts.rules/http/HighErrorRate", Series: "job:http_requests:rate5m"},
+	}
+	if !reflect.DeepEqual(orphans, expected) {
+		t.Errorf("got %+v want %+v", orphans, expected)
+	}
+
+	// Still recorded elsewhere
+	after["moved.rules"] = before["recording.rules"]
+	if orphans := orphanedRules(before, after); len(orphans) != 0 {
+		t.Errorf("unexpected orphans: %+v", orphans)
+	}
+}
@@ -0,0 +1,401 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Levels of rule lint findings.  Errors reject the rules file, warnings are only reported.
+const (
+	LintLevelError = "error"
+	LintLevelWarn  = "warn"
+)
+
+// Checks a rule lint policy can configure
+const (
+	lintCheckRequiredLabel      = "required_label"
+	lintCheckRequiredAnnotation = "required_annotation"
+	lintCheckMinFor             = "min_for"
+	lintCheckRecordName         = "record_name"
+	lintCheckUniqueAlertName    = "unique_alert_name"
+	lintCheckUniqueGroupName    = "unique_group_name"
+	lintCheckUniqueAlert        = "unique_alert"
+	lintCheckUniqueRecord       = "unique_record"
+)
+
+// Key of the rule lint policy in the rule lint ConfigMap
+const ruleLintPolicyKey = "lint.yml"
+
+// Recording rule names following the level:metric:operations convention
+const defaultRecordNamePattern = `^[a-zA-Z_][a-zA-Z0-9_]*:[a-zA-Z_][a-zA-Z0-9_]*:[a-zA-Z0-9_]+$`
+
+// This can be set from the command line via -ruleLintConfigMap.  It defaults to vmi-<vmi>-prometheus-rule-lint.
+var ruleLintConfigMap string
+
+// RuleLintPolicy is the set of checks run on rules files, read from the rule lint ConfigMap.
+type RuleLintPolicy struct {
+	Rules []*RuleLintRule `json:"rules"`
+}
+
+// RuleLintRule is one configured check.  Label and Values apply to required_label, an empty Values allowing any
+// value, Annotation to required_annotation, Duration to min_for, and Pattern to record_name.
+type RuleLintRule struct {
+	Name       string   `json:"name"`
+	Check      string   `json:"check"`
+	Level      string   `json:"level,omitempty"`
+	Label      string   `json:"label,omitempty"`
+	Values     []string `json:"values,omitempty"`
+	Annotation string   `json:"annotation,omitempty"`
+	Duration   string   `json:"duration,omitempty"`
+	Pattern    string   `json:"pattern,omitempty"`
+
+	duration model.Duration
+	pattern  *regexp.Regexp
+}
+
+// RuleLintFinding is a rule breaking a check of the policy.
+type RuleLintFinding struct {
+	File    string `json:"file"`
+	Group   string `json:"group,omitempty"`
+	Rule    string `json:"rule,omitempty"`
+	Check   string `json:"check"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+func (finding RuleLintFinding) String() string {
+	return fmt.Sprintf("%s: %s/%s/%s: %s (%s)", finding.Level, finding.File, finding.Group, finding.Rule, finding.Message, finding.Check)
+}
+
+// getRuleLintConfigMapName returns the name of the ConfigMap holding the rule lint policy.
+func getRuleLintConfigMapName() string {
+	if ruleLintConfigMap != "" {
+		return ruleLintConfigMap
+	}
+	return "vmi-" + vmiName + "-prometheus-rule-lint"
+}
+
+// Policy used without a rule lint ConfigMap: conflicts between rules files are reported as warnings.
+const defaultRuleLintPolicy = `rules:
+- name: unique-group-name
+  check: unique_group_name
+  level: warn
+- name: unique-alert
+  check: unique_alert
+  level: warn
+- name: unique-record
+  check: unique_record
+  level: warn
+`
+
+// getRuleLintPolicy reads the rule lint policy, or returns the default policy if there is no rule lint ConfigMap.
+func (k *K8s) getRuleLintPolicy() (*RuleLintPolicy, error) {
+	defer observeKubernetesAPICall("getRuleLintPolicy", time.Now())
+	cm, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), getRuleLintConfigMapName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return parseRuleLintPolicy([]byte(defaultRuleLintPolicy))
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseRuleLintPolicy([]byte(cm.Data[ruleLintPolicyKey]))
+}
+
+// parseRuleLintPolicy parses and validates a rule lint policy.  The level of a check defaults to error.
+func parseRuleLintPolicy(b []byte) (*RuleLintPolicy, error) {
+	var policy RuleLintPolicy
+	if err := yaml.UnmarshalStrict(b, &policy); err != nil {
+		return nil, err
+	}
+	for i, rule := range policy.Rules {
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("%s-%d", rule.Check, i)
+		}
+		switch rule.Level {
+		case "":
+			rule.Level = LintLevelError
+		case LintLevelError, LintLevelWarn:
+		default:
+			return nil, fmt.Errorf("lint rule %s: level must be %s or %s", rule.Name, LintLevelError, LintLevelWarn)
+		}
+		switch rule.Check {
+		case lintCheckRequiredLabel:
+			if rule.Label == "" {
+				return nil, fmt.Errorf("lint rule %s: no label given", rule.Name)
+			}
+		case lintCheckRequiredAnnotation:
+			if rule.Annotation == "" {
+				return nil, fmt.Errorf("lint rule %s: no annotation given", rule.Name)
+			}
+		case lintCheckMinFor:
+			duration, err := model.ParseDuration(rule.Duration)
+			if err != nil {
+				return nil, fmt.Errorf("lint rule %s: invalid duration: %v", rule.Name, err)
+			}
+			rule.duration = duration
+		case lintCheckRecordName:
+			if rule.Pattern == "" {
+				rule.Pattern = defaultRecordNamePattern
+			}
+			pattern, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("lint rule %s: invalid pattern: %v", rule.Name, err)
+			}
+			rule.pattern = pattern
+		case lintCheckUniqueAlertName, lintCheckUniqueGroupName, lintCheckUniqueAlert, lintCheckUniqueRecord:
+		default:
+			return nil, fmt.Errorf("lint rule %s: unknown check %q", rule.Name, rule.Check)
+		}
+	}
+	return &policy, nil
+}
+
+// lintRuleFile checks a rules file against the policy.  Checks across files compare it with the other given files.
+func lintRuleFile(policy *RuleLintPolicy, fileName string, ruleFile *RuleFile, others map[string]*RuleFile) []RuleLintFinding {
+	findings := make([]RuleLintFinding, 0)
+	for _, lintRule := range policy.Rules {
+		report := func(group string, rule string, format string, args ...interface{}) {
+			findings = append(findings, RuleLintFinding{File: fileName, Group: group, Rule: rule, Check: lintRule.Name,
+				Level: lintRule.Level, Message: fmt.Sprintf(format, args...)})
+		}
+		switch lintRule.Check {
+		case lintCheckUniqueGroupName, lintCheckUniqueAlertName, lintCheckUniqueAlert, lintCheckUniqueRecord:
+			lintUnique(lintRule.Check, ruleFile, others, report)
+			continue
+		}
+		for _, group := range ruleFile.Groups {
+			for _, rule := range group.Rules {
+				lintRule.lint(group.Name, rule, report)
+			}
+		}
+	}
+	return findings
+}
+
+// lint runs the check on a single rule.
+func (lintRule *RuleLintRule) lint(group string, rule Rule, report func(string, string, string, ...interface{})) {
+	switch lintRule.Check {
+	case lintCheckRequiredLabel:
+		if rule.Alert == "" {
+			return
+		}
+		value, ok := rule.Labels[lintRule.Label]
+		if !ok {
+			report(group, rule.Alert, "the alert has no %s label", lintRule.Label)
+		} else if len(lintRule.Values) > 0 && !containsString(lintRule.Values, value) {
+			report(group, rule.Alert, "the %s label is %q, expected one of: %s", lintRule.Label, value, strings.Join(lintRule.Values, ", "))
+		}
+	case lintCheckRequiredAnnotation:
+		if rule.Alert != "" && rule.Annotations[lintRule.Annotation] == "" {
+			report(group, rule.Alert, "the alert has no %s annotation", lintRule.Annotation)
+		}
+	case lintCheckMinFor:
+		if rule.Alert == "" {
+			return
+		}
+		var duration model.Duration
+		if rule.For != "" {
+			var err error
+			if duration, err = model.ParseDuration(rule.For); err != nil {
+				// promtool reports invalid durations
+				return
+			}
+		}
+		if duration < lintRule.duration {
+			report(group, rule.Alert, "the alert fires after %s, at least %s is expected", duration, lintRule.duration)
+		}
+	case lintCheckRecordName:
+		if rule.Record != "" && !lintRule.pattern.MatchString(rule.Record) {
+			report(group, rule.Record, "the recorded series name does not match %s", lintRule.Pattern)
+		}
+	}
+}
+
+// ruleDefinition is something a uniqueness check requires to be defined once: a group, or the alert or series of a
+// rule.  Key identifies it, so definitions with the same key conflict.
+type ruleDefinition struct {
+	group string
+	rule  string
+	key   string
+}
+
+// ruleDefinitions returns what the given uniqueness check compares in a rules file, and how to describe it.
+func ruleDefinitions(check string, ruleFile *RuleFile) ([]ruleDefinition, string) {
+	var definitions []ruleDefinition
+	description := ""
+	for _, group := range ruleFile.Groups {
+		if check == lintCheckUniqueGroupName {
+			description = "the group"
+			definitions = append(definitions, ruleDefinition{group: group.Name, key: group.Name})
+			continue
+		}
+		for _, rule := range group.Rules {
+			switch {
+			case check == lintCheckUniqueAlertName && rule.Alert != "":
+				description = "the alert"
+				definitions = append(definitions, ruleDefinition{group: group.Name, rule: rule.Alert, key: rule.Alert})
+			case check == lintCheckUniqueAlert && rule.Alert != "":
+				description = "the alert, with the same labels,"
+				definitions = append(definitions, ruleDefinition{group: group.Name, rule: rule.Alert,
+					key: rule.Alert + labels.FromMap(rule.Labels).String()})
+			case check == lintCheckUniqueRecord && rule.Record != "":
+				description = "the recorded series, with the same labels,"
+				definitions = append(definitions, ruleDefinition{group: group.Name, rule: rule.Record,
+					key: rule.Record + labels.FromMap(rule.Labels).String()})
+			}
+		}
+	}
+	return definitions, description
+}
+
+// lintUnique reports what the given uniqueness check compares when defined more than once in the file, or also
+// defined in another file.
+func lintUnique(check string, ruleFile *RuleFile, others map[string]*RuleFile, report func(string, string, string, ...interface{})) {
+	otherFiles := make(map[string][]string)
+	for otherName, other := range others {
+		otherDefinitions, _ := ruleDefinitions(check, other)
+		for _, definition := range otherDefinitions {
+			otherFiles[definition.key] = append(otherFiles[definition.key], otherName)
+		}
+	}
+	definitions, description := ruleDefinitions(check, ruleFile)
+	seen := make(map[string]bool)
+	for _, definition := range definitions {
+		if seen[definition.key] {
+			report(definition.group, definition.rule, "%s is defined more than once in this file", description)
+		}
+		seen[definition.key] = true
+		if files, ok := otherFiles[definition.key]; ok {
+			sort.Strings(files)
+			report(definition.group, definition.rule, "%s is also defined in %s", description, strings.Join(uniqueStrings(files), ", "))
+		}
+	}
+}
+
+// lintErrors returns the findings at the error level, and the warnings.
+func lintErrors(findings []RuleLintFinding) (errs []RuleLintFinding, warnings []RuleLintFinding) {
+	for _, finding := range findings {
+		if finding.Level == LintLevelError {
+			errs = append(errs, finding)
+		} else {
+			warnings = append(warnings, finding)
+		}
+	}
+	return errs, warnings
+}
+
+// parseOtherRuleFiles parses the current rules files other than the given one.  Files that cannot be parsed are
+// skipped, they were checked when saved.
+func parseOtherRuleFiles(current map[string]string, fileName string) map[string]*RuleFile {
+	others := make(map[string]*RuleFile)
+	for name, content := range current {
+		if name == fileName {
+			continue
+		}
+		if ruleFile, err := parseRuleFile([]byte(content)); err == nil {
+			others[name] = ruleFile
+		}
+	}
+	return others
+}
+
+// lintPutRules checks a rules file being saved against the rule lint policy and the other current rules files.  Any
+// error rejects the file.  Otherwise the warnings are returned, formatted to be appended to the response.
+func (k *K8s) lintPutRules(r *http.Request, fileName string, b []byte, current map[string]string) (string, *Problem) {
+	policy, err := k.getRuleLintPolicy()
+	if err != nil {
+		return "", &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: "Unable to read the rule lint policy: " + err.Error()}
+	}
+	if len(policy.Rules) == 0 {
+		return "", nil
+	}
+	ruleFile, err := parseRuleFile(b)
+	if err != nil {
+		return "", &Problem{Status: http.StatusBadRequest, Code: CodeInvalidYAML, Detail: "ERROR: Unable to parse the rules: " + err.Error(),
+			Output: err.Error(), Lines: problemLines(err.Error())}
+	}
+	errs, warnings := lintErrors(lintRuleFile(policy, fileName, ruleFile, parseOtherRuleFiles(current, fileName)))
+	if len(errs) > 0 {
+		output := formatLintFindings(append(errs, warnings...))
+		return "", &Problem{Status: http.StatusBadRequest, Code: CodeRuleLintFailed,
+			Detail: "No action taken.  The rules break the lint policy:\n" + output, Output: output}
+	}
+	if len(warnings) == 0 {
+		return "", nil
+	}
+	requestLogger(r).Infow("Rule lint warnings", "warnings", len(warnings))
+	return "\nLint warnings:\n" + formatLintFindings(warnings), nil
+}
+
+func formatLintFindings(findings []RuleLintFinding) string {
+	lines := make([]string, 0, len(findings))
+	for _, finding := range findings {
+		lines = append(lines, finding.String())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// LintPrometheusRules checks all current rules files against the rule lint policy.
+func (k *K8s) LintPrometheusRules(w http.ResponseWriter, r *http.Request) {
+	policy, err := k.getRuleLintPolicy()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule lint policy: "+err.Error())
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	fileNames := make([]string, 0, len(currentConfigMap))
+	for fileName := range currentConfigMap {
+		fileNames = append(fileNames, fileName)
+	}
+	sort.Strings(fileNames)
+
+	findings := make([]RuleLintFinding, 0)
+	for _, fileName := range fileNames {
+		ruleFile, err := parseRuleFile([]byte(currentConfigMap[fileName]))
+		if err != nil {
+			findings = append(findings, RuleLintFinding{File: fileName, Check: "parse", Level: LintLevelError, Message: err.Error()})
+			continue
+		}
+		findings = append(findings, lintRuleFile(policy, fileName, ruleFile, parseOtherRuleFiles(currentConfigMap, fileName))...)
+	}
+	errs, warnings := lintErrors(findings)
+	successJSON(w, r, map[string]interface{}{"errors": len(errs), "warnings": len(warnings), "findings": findings})
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueStrings removes the duplicates of a sorted list.
+func uniqueStrings(list []string) []string {
+	unique := make([]string, 0, len(list))
+	for i, item := range list {
+		if i == 0 || item != list[i-1] {
+			unique = append(unique, item)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,185 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+const testRuleLintPolicy = `rules:
+- name: severity
+  check: required_label
+  label: severity
+  values: [critical, warning, info]
+- name: summary
+  check: required_annotation
+  annotation: summary
+- name: runbook
+  check: required_annotation
+  annotation: runbook_url
+  level: warn
+- name: min-for
+  check: min_for
+  duration: 1m
+- name: record-name
+  check: record_name
+- name: unique-alert
+  check: unique_alert_name
+`
+
+func TestParseRuleLintPolicy(t *testing.T) {
+	policy, err := parseRuleLintPolicy([]byte(testRuleLintPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policy.Rules) != 6 || policy.Rules[0].Level != LintLevelError || policy.Rules[2].Level != LintLevelWarn {
+		t.Errorf("unexpected policy: %+v", policy.Rules)
+	}
+
+	for _, invalid := range []string{
+		"rules:\n- check: required_label\n",
+		"rules:\n- check: required_annotation\n",
+		"rules:\n- check: min_for\n  duration: soon\n",
+		"rules:\n- check: record_name\n  pattern: '('\n",
+		"rules:\n- check: spelling\n",
+		"rules:\n- check: unique_alert_name\n  level: fatal\n",
+		"rules:\n- check: unique_alert_name\n  severity: error\n",
+	} {
+		if _, err := parseRuleLintPolicy([]byte(invalid)); err == nil {
+			t.Errorf("expected an error parsing the policy: %s", invalid)
+		}
+	}
+}
+
+func TestLintRuleFile(t *testing.T) {
+	policy, err := parseRuleLintPolicy([]byte(testRuleLintPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleFile, err := parseRuleFile([]byte(`groups:
+- name: example
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    for: 5m
+    labels:
+      severity: critical
+    annotations:
+      summary: Instance down
+      runbook_url: https://example.com/runbooks/instance-down
+  - alert: HighLatency
+    expr: job:request_latency_seconds:mean5m > 0.5
+    for: 30s
+    labels:
+      severity: page
+    annotations:
+      summary: High latency
+  - alert: HighLatency
+    expr: job:request_latency_seconds:mean5m > 1
+    annotations:
+      summary: Very high latency
+  - record: job:request_latency_seconds:mean5m
+    expr: avg by (job) (request_latency_seconds)
+  - record: request_latency_mean
+    expr: avg(request_latency_seconds)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := map[string]*RuleFile{
+		"other.rules": {Groups: []RuleGroup{{Name: "other", Rules: []Rule{{Alert: "InstanceDown", Expr: "up < 1"}}}}},
+	}
+
+	findings := lintRuleFile(policy, "example.rules", ruleFile, others)
+	expected := []string{
+		`error: example.rules/example/HighLatency: the severity label is "page", expected one of: critical, warning, info (severity)`,
+		`error: example.rules/example/HighLatency: the alert has no severity label (severity)`,
+		`warn: example.rules/example/HighLatency: the alert has no runbook_url annotation (runbook)`,
+		`warn: example.rules/example/HighLatency: the alert has no runbook_url annotation (runbook)`,
+		`error: example.rules/example/HighLatency: the alert fires after 30s, at least 1m is expected (min-for)`,
+		`error: example.rules/example/HighLatency: the alert fires after 0s, at least 1m is expected (min-for)`,
+		`error: example.rules/example/request_latency_mean: the recorded series name does not match ` + defaultRecordNamePattern + ` (record-name)`,
+		`error: example.rules/example/InstanceDown: the alert is also defined in other.rules (unique-alert)`,
+		`error: example.rules/example/HighLatency: the alert is defined more than once in this file (unique-alert)`,
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got:\n%s", len(expected), formatLintFindings(findings))
+	}
+	for i, finding := range findings {
+		if finding.String() != expected[i] {
+			t.Errorf("unexpected finding %d: got '%s' want '%s'", i, finding, expected[i])
+		}
+	}
+
+	errs, warnings := lintErrors(findings)
+	if len(errs) != 7 || len(warnings) != 2 {
+		t.Errorf("unexpected errors %v and warnings %v", errs, warnings)
+	}
+
+	// Without a policy, nothing is checked
+	if findings := lintRuleFile(&RuleLintPolicy{}, "example.rules", ruleFile, others); len(findings) != 0 {
+		t.Errorf("unexpected findings: %s", formatLintFindings(findings))
+	}
+	if !strings.Contains(formatLintFindings(errs), "\n") {
+		t.Errorf("expected one finding per line")
+	}
+}
+
+func TestLintRuleFileConflicts(t *testing.T) {
+	policy, err := parseRuleLintPolicy([]byte(defaultRuleLintPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ruleFile, err := parseRuleFile([]byte(`groups:
+- name: latency
+  rules:
+  - record: job:request_latency_seconds:mean5m
+    expr: avg by (job) (rate(request_latency_seconds_sum[5m]))
+  - record: job:request_latency_seconds:mean5m
+    expr: avg by (job) (rate(request_latency_seconds_sum[5m]))
+    labels:
+      env: prod
+  - alert: HighLatency
+    expr: job:request_latency_seconds:mean5m > 0.5
+    labels:
+      severity: warning
+  - alert: HighLatency
+    expr: job:request_latency_seconds:mean5m > 1
+    labels:
+      severity: critical
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	others := map[string]*RuleFile{
+		"other.rules": {Groups: []RuleGroup{{Name: "latency", Rules: []Rule{
+			{Record: "job:request_latency_seconds:mean5m", Expr: "avg by (job) (request_latency_seconds)"},
+			{Alert: "HighLatency", Expr: "job:request_latency_seconds:mean5m > 2", Labels: map[string]string{"severity": "critical"}},
+		}}}},
+		"another.rules": {Groups: []RuleGroup{{Name: "latency"}}},
+	}
+
+	findings := lintRuleFile(policy, "latency.rules", ruleFile, others)
+	expected := []string{
+		`warn: latency.rules/latency/: the group is also defined in another.rules, other.rules (unique-group-name)`,
+		`warn: latency.rules/latency/HighLatency: the alert, with the same labels, is also defined in other.rules (unique-alert)`,
+		`warn: latency.rules/latency/job:request_latency_seconds:mean5m: the recorded series, with the same labels, is also defined in other.rules (unique-record)`,
+	}
+	if len(findings) != len(expected) {
+		t.Fatalf("expected %d findings, got:\n%s", len(expected), formatLintFindings(findings))
+	}
+	for i, finding := range findings {
+		if finding.String() != expected[i] {
+			t.Errorf("unexpected finding %d: got '%s' want '%s'", i, finding, expected[i])
+		}
+	}
+
+	// The same series recorded twice in the file
+	ruleFile.Groups[0].Rules[1].Labels = nil
+	findings = lintRuleFile(policy, "latency.rules", ruleFile, map[string]*RuleFile{})
+	if len(findings) != 1 || findings[0].Message != "the recorded series, with the same labels, is defined more than once in this file" {
+		t.Errorf("unexpected findings:\n%s", formatLintFindings(findings))
+	}
+}
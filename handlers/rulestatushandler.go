@@ -0,0 +1,188 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// prometheusRuleGroups is the data of a response of the Prometheus /api/v1/rules endpoint.
+type prometheusRuleGroups struct {
+	Groups []prometheusRuleGroup `json:"groups"`
+}
+
+type prometheusRuleGroup struct {
+	Name  string           `json:"name"`
+	File  string           `json:"file"`
+	Rules []prometheusRule `json:"rules"`
+}
+
+type prometheusRule struct {
+	Name           string            `json:"name"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	State          string            `json:"state,omitempty"`
+	Health         string            `json:"health"`
+	LastError      string            `json:"lastError,omitempty"`
+	EvaluationTime float64           `json:"evaluationTime"`
+	LastEvaluation time.Time         `json:"lastEvaluation"`
+	Type           string            `json:"type"`
+}
+
+// prometheusAlerts is the data of a response of the Prometheus /api/v1/alerts endpoint.
+type prometheusAlerts struct {
+	Alerts []PrometheusAlert `json:"alerts"`
+}
+
+// PrometheusAlert is an alert of an alerting rule, pending or firing.
+type PrometheusAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	State       string            `json:"state"`
+	ActiveAt    *time.Time        `json:"activeAt,omitempty"`
+	Value       string            `json:"value"`
+}
+
+// RuleFileStatus is the state in Prometheus of the rules of a rules file.
+type RuleFileStatus struct {
+	File      string       `json:"file"`
+	Loaded    bool         `json:"loaded"`
+	NotLoaded int          `json:"notLoaded"`
+	Rules     []RuleStatus `json:"rules"`
+}
+
+// RuleStatus is the state in Prometheus of a rule.  Rules of the ConfigMap Prometheus has not loaded, e.g. until its
+// rules are reloaded, only have their name, and Loaded false.  Alerts are the pending and firing alerts of alerting
+// rules.
+type RuleStatus struct {
+	Group          string            `json:"group"`
+	Name           string            `json:"name"`
+	Type           string            `json:"type"`
+	Loaded         bool              `json:"loaded"`
+	Health         string            `json:"health,omitempty"`
+	LastError      string            `json:"lastError,omitempty"`
+	LastEvaluation *time.Time        `json:"lastEvaluation,omitempty"`
+	EvaluationTime float64           `json:"evaluationTime,omitempty"`
+	State          string            `json:"state,omitempty"`
+	Alerts         []PrometheusAlert `json:"alerts,omitempty"`
+}
+
+// ruleStatusKey identifies a rule within a rules file.  Rules of a group may share a name, so the later ones are told
+// apart by their position among the rules with the same name.
+type ruleStatusKey struct {
+	group string
+	name  string
+	index int
+}
+
+// alertMatchesRule returns whether an alert was fired by a rule: it has its name, and its labels.
+func alertMatchesRule(alert PrometheusAlert, rule prometheusRule) bool {
+	if alert.Labels["alertname"] != rule.Name {
+		return false
+	}
+	for name, value := range rule.Labels {
+		if alert.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleFileStatus joins the rules of a rules file with the rules loaded in Prometheus, and the active alerts.
+func ruleFileStatus(fileName string, ruleFile *RuleFile, groups []prometheusRuleGroup, alerts []PrometheusAlert) *RuleFileStatus {
+	loaded := make(map[ruleStatusKey]prometheusRule)
+	for _, group := range groups {
+		// Prometheus knows the rules files by the path they are mounted at
+		if path.Base(group.File) != fileName {
+			continue
+		}
+		seen := make(map[string]int)
+		for _, rule := range group.Rules {
+			loaded[ruleStatusKey{group: group.Name, name: rule.Name, index: seen[rule.Name]}] = rule
+			seen[rule.Name]++
+		}
+	}
+
+	status := &RuleFileStatus{File: fileName, Loaded: len(loaded) > 0, Rules: make([]RuleStatus, 0)}
+	for _, group := range ruleFile.Groups {
+		seen := make(map[string]int)
+		for _, rule := range group.Rules {
+			ruleStatus := RuleStatus{Group: group.Name, Name: rule.Name(), Type: ruleTypeAlert}
+			if rule.Record != "" {
+				ruleStatus.Type = ruleTypeRecord
+			}
+			loadedRule, ok := loaded[ruleStatusKey{group: group.Name, name: ruleStatus.Name, index: seen[ruleStatus.Name]}]
+			seen[ruleStatus.Name]++
+			if !ok {
+				status.NotLoaded++
+				status.Rules = append(status.Rules, ruleStatus)
+				continue
+			}
+			ruleStatus.Loaded = true
+			ruleStatus.Health = loadedRule.Health
+			ruleStatus.LastError = loadedRule.LastError
+			ruleStatus.EvaluationTime = loadedRule.EvaluationTime
+			ruleStatus.State = loadedRule.State
+			if !loadedRule.LastEvaluation.IsZero() {
+				lastEvaluation := loadedRule.LastEvaluation
+				ruleStatus.LastEvaluation = &lastEvaluation
+			}
+			if ruleStatus.Type == ruleTypeAlert {
+				for _, alert := range alerts {
+					if alertMatchesRule(alert, loadedRule) {
+						ruleStatus.Alerts = append(ruleStatus.Alerts, alert)
+					}
+				}
+			}
+			status.Rules = append(status.Rules, ruleStatus)
+		}
+	}
+	return status
+}
+
+// GetPrometheusRuleStatus returns the health, last error, evaluation time and active alerts of each rule of a rules
+// file, as Prometheus reports them, flagging the rules Prometheus has not loaded.
+func (k *K8s) GetPrometheusRuleStatus(w http.ResponseWriter, r *http.Request) {
+	fileName := path.Base(path.Dir(r.URL.Path))
+	r = withLogFields(r, "resource", fileName)
+	if !strings.HasSuffix(fileName, ".rules") {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: The file name provided must end with: .rules")
+		return
+	}
+	if err := validateName(fileName); err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidFileName, "ERROR: Invalid File Name: "+err.Error())
+		return
+	}
+
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		return
+	}
+	content, ok := currentConfigMap[fileName]
+	if !ok {
+		problemError(w, r, http.StatusNotFound, CodeRuleNotFound, "Unable to find a current Prometheus Alert rule called: "+fileName)
+		return
+	}
+	ruleFile, err := parseRuleFile([]byte(content))
+	if err != nil {
+		internalError(w, r, "Unable to parse the rules file: "+fileName+", "+err.Error())
+		return
+	}
+
+	var rules prometheusRuleGroups
+	if err := prometheusAPIGet("/api/v1/rules", nil, &rules); err != nil {
+		serviceUnavailable(w, r, "Unable to get the rules of Prometheus: "+err.Error())
+		return
+	}
+	var alerts prometheusAlerts
+	if err := prometheusAPIGet("/api/v1/alerts", nil, &alerts); err != nil {
+		serviceUnavailable(w, r, "Unable to get the alerts of Prometheus: "+err.Error())
+		return
+	}
+	successJSON(w, r, ruleFileStatus(fileName, ruleFile, rules.Groups, alerts.Alerts))
+}
@@ -0,0 +1,64 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPrometheusRuleStatus(t *testing.T) {
+	vmiName = "vmi-rule-status-test"
+	namespace = "vmi-rule-status-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	getStatus := http.HandlerFunc(testclient.GetPrometheusRuleStatus)
+
+	send := func(handler http.HandlerFunc, method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		switch r.URL.Path {
+		case "/api/v1/rules":
+			fmt.Fprintf(w, `{"status":"success","data":%s}`, testPrometheusRules)
+		case "/api/v1/alerts":
+			fmt.Fprintf(w, `{"status":"success","data":%s}`, testPrometheusAlerts)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	prometheusURL = server.URL
+	defer func() { prometheusURL = "" }()
+
+	/* *** A rules file that does not exist *** */
+	rr := send(getStatus, "GET", "/prometheus/rules/node.rules/status", "")
+	verify(t, rr, http.StatusNotFound, "node.rules")
+
+	/* *** The state of each rule *** */
+	rr = send(http.HandlerFunc(testclient.PutPrometheusRules), "PUT", "/prometheus/rules/node.rules", testRuleStatusFile)
+	verifyStatus(t, rr, http.StatusAccepted)
+	rr = send(getStatus, "GET", "/prometheus/rules/node.rules/status", "")
+	verify(t, rr, http.StatusOK, `"lastError": "many-to-many matching not allowed"`)
+	verify(t, rr, http.StatusOK, `"notLoaded": 1`)
+	verify(t, rr, http.StatusOK, `"instance": "a:9100"`)
+
+	/* *** Prometheus cannot be called *** */
+	server.Close()
+	rr = send(getStatus, "GET", "/prometheus/rules/node.rules/status", "")
+	verify(t, rr, http.StatusServiceUnavailable, "Unable to get the rules of Prometheus")
+}
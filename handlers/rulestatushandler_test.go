@@ -0,0 +1,85 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testRuleStatusFile = `groups:
+- name: node
+  rules:
+  - alert: InstanceDown
+    expr: up == 0
+    labels:
+      severity: critical
+  - alert: InstanceDown
+    expr: up == 0
+    for: 10m
+    labels:
+      severity: warning
+  - record: job:up:sum
+    expr: sum by (job) (up)
+  - alert: NotYetLoaded
+    expr: vector(1)
+`
+
+// Responses of the Prometheus /api/v1/rules and /api/v1/alerts endpoints, for the rules above but NotYetLoaded, and a
+// rules file of the same name elsewhere.
+const (
+	testPrometheusRules = `{"groups": [
+  {"name": "node", "file": "/etc/prometheus/rules/node.rules", "rules": [
+    {"name": "InstanceDown", "query": "up == 0", "labels": {"severity": "critical"}, "state": "firing", "health": "ok",
+     "evaluationTime": 0.001, "lastEvaluation": "2020-10-01T10:00:00Z", "type": "alerting"},
+    {"name": "InstanceDown", "query": "up == 0", "labels": {"severity": "warning"}, "state": "pending", "health": "ok",
+     "evaluationTime": 0.001, "lastEvaluation": "2020-10-01T10:00:00Z", "type": "alerting"},
+    {"name": "job:up:sum", "query": "sum by(job) (up)", "health": "err", "lastError": "many-to-many matching not allowed",
+     "evaluationTime": 0.002, "lastEvaluation": "2020-10-01T10:00:00Z", "type": "recording"}]},
+  {"name": "node", "file": "/etc/prometheus/rules/other.rules", "rules": [
+    {"name": "NotYetLoaded", "query": "vector(1)", "health": "ok", "type": "alerting"}]}]}`
+	testPrometheusAlerts = `{"alerts": [
+  {"labels": {"alertname": "InstanceDown", "severity": "critical", "instance": "a:9100"}, "state": "firing",
+   "activeAt": "2020-10-01T09:00:00Z", "value": "0e+00"},
+  {"labels": {"alertname": "InstanceDown", "severity": "warning", "instance": "b:9100"}, "state": "pending",
+   "activeAt": "2020-10-01T09:55:00Z", "value": "0e+00"}]}`
+)
+
+func TestRuleFileStatus(t *testing.T) {
+	ruleFile, err := parseRuleFile([]byte(testRuleStatusFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rules prometheusRuleGroups
+	if err := json.Unmarshal([]byte(testPrometheusRules), &rules); err != nil {
+		t.Fatal(err)
+	}
+	var alerts prometheusAlerts
+	if err := json.Unmarshal([]byte(testPrometheusAlerts), &alerts); err != nil {
+		t.Fatal(err)
+	}
+
+	status := ruleFileStatus("node.rules", ruleFile, rules.Groups, alerts.Alerts)
+	if !status.Loaded || status.NotLoaded != 1 || len(status.Rules) != 4 {
+		t.Fatalf("unexpected status: %+v", status)
+	}
+	critical, warning, record, notLoaded := status.Rules[0], status.Rules[1], status.Rules[2], status.Rules[3]
+	if critical.State != "firing" || len(critical.Alerts) != 1 || critical.Alerts[0].Labels["instance"] != "a:9100" {
+		t.Errorf("unexpected status of the critical alert: %+v", critical)
+	}
+	if warning.State != "pending" || len(warning.Alerts) != 1 || warning.Alerts[0].Labels["instance"] != "b:9100" {
+		t.Errorf("unexpected status of the warning alert: %+v", warning)
+	}
+	if record.Type != ruleTypeRecord || record.Health != "err" || record.LastError == "" || record.LastEvaluation == nil || len(record.Alerts) != 0 {
+		t.Errorf("unexpected status of the recording rule: %+v", record)
+	}
+	if notLoaded.Loaded || notLoaded.Name != "NotYetLoaded" || notLoaded.Health != "" {
+		t.Errorf("unexpected status of the rule not loaded: %+v", notLoaded)
+	}
+
+	status = ruleFileStatus("node.rules", ruleFile, nil, nil)
+	if status.Loaded || status.NotLoaded != 4 {
+		t.Errorf("expected no rule to be loaded, got %+v", status)
+	}
+}
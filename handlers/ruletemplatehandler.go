@@ -0,0 +1,395 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Rule templates use <% %> delimiters, so the {{ }} of alert annotations are left for Prometheus to expand.  Neither
+// can occur in PromQL outside of a string, unlike [[ ]], which regular expressions use for character classes such as
+// [[:alpha:]].
+const (
+	ruleTemplateLeftDelim  = "<%"
+	ruleTemplateRightDelim = "%>"
+)
+
+// Header of the rules files rendered from a template, linking them to it.  Re-rendering a file keeps it, saving the
+// file through PUT /prometheus/rules/{name} drops it, and the link with it.
+const (
+	renderedFromTemplatePrefix = "# Rendered from rule template: "
+	renderedParametersPrefix   = "# Template parameters: "
+)
+
+// This can be set from the command line via -ruleTemplatesConfigMap.  It defaults to
+// vmi-<vmi>-prometheus-rule-templates.
+var ruleTemplatesConfigMap string
+
+// RuleTemplateRenderRequest is the body of POST /prometheus/rules/{file}/render.
+type RuleTemplateRenderRequest struct {
+	Template   string                 `json:"template"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// getRuleTemplatesConfigMapName returns the name of the ConfigMap holding the rule templates.
+func getRuleTemplatesConfigMapName() string {
+	if ruleTemplatesConfigMap != "" {
+		return ruleTemplatesConfigMap
+	}
+	return "vmi-" + vmiName + "-prometheus-rule-templates"
+}
+
+// getRuleTemplates returns the rule templates, and whether their ConfigMap exists.  There are none until the first
+// one is saved.
+func (k *K8s) getRuleTemplates() (map[string]string, bool, error) {
+	templates, err := k.getConfigMapByName(getRuleTemplatesConfigMapName())
+	if k8serrors.IsNotFound(err) {
+		return map[string]string{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if templates == nil {
+		templates = make(map[string]string)
+	}
+	return templates, true, nil
+}
+
+// createRuleTemplatesConfigMap creates the rule templates ConfigMap, with the labels and owner of the alertrules
+// ConfigMap, so it goes away with the VMI.
+func (k *K8s) createRuleTemplatesConfigMap() error {
+	vmi, err := k.getVMIJson()
+	if err != nil {
+		return err
+	}
+	rulesConfigMapName, _ := vmi.Path(PrometheusRulesConfigMapPath).Data().(string)
+	rulesConfigMap, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), rulesConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            getRuleTemplatesConfigMapName(),
+			Namespace:       namespace,
+			Labels:          rulesConfigMap.Labels,
+			OwnerReferences: rulesConfigMap.OwnerReferences,
+		},
+	}
+	_, err = k.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+	return err
+}
+
+// parseRuleTemplate parses a rule template.  Parameters missing when rendering are errors.
+func parseRuleTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Delims(ruleTemplateLeftDelim, ruleTemplateRightDelim).Option("missingkey=error").Parse(text)
+}
+
+// renderRuleTemplate renders a rule template with the given parameters, into a rules file linked to the template.
+func renderRuleTemplate(name string, text string, parameters map[string]interface{}) ([]byte, error) {
+	tmpl, err := parseRuleTemplate(name, text)
+	if err != nil {
+		return nil, err
+	}
+	if parameters == nil {
+		parameters = map[string]interface{}{}
+	}
+	encodedParameters, err := json.Marshal(parameters)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString(renderedFromTemplatePrefix + name + "\n")
+	b.WriteString(renderedParametersPrefix + string(encodedParameters) + "\n")
+	if err := tmpl.Execute(&b, parameters); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// renderedFrom returns the template a rules file was rendered from, and the parameters it was rendered with.  The
+// template name is empty if the file was not rendered from a template.
+func renderedFrom(content string) (string, map[string]interface{}) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), renderedFromTemplatePrefix) {
+		return "", nil
+	}
+	name := strings.TrimPrefix(scanner.Text(), renderedFromTemplatePrefix)
+	var parameters map[string]interface{}
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), renderedParametersPrefix) ||
+		json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), renderedParametersPrefix)), &parameters) != nil {
+		return "", nil
+	}
+	return name, parameters
+}
+
+// templateInstances returns the names of the rules files rendered from the given template, sorted.
+func templateInstances(current map[string]string, templateName string) []string {
+	var instances []string
+	for fileName, content := range current {
+		if name, _ := renderedFrom(content); name == templateName {
+			instances = append(instances, fileName)
+		}
+	}
+	sort.Strings(instances)
+	return instances
+}
+
+// validateRuleTemplateName checks the name of a rule template, and writes a 400 response if it is invalid.
+func validateRuleTemplateName(w http.ResponseWriter, r *http.Request, name string) bool {
+	if validateName(name) != nil || ValidateConfigMapKeyName(name) != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: The rule template name provided is invalid.")
+		return false
+	}
+	return true
+}
+
+// GetRuleTemplateNames returns the names of all rule templates.
+func (k *K8s) GetRuleTemplateNames(w http.ResponseWriter, r *http.Request) {
+	templates, _, err := k.getRuleTemplates()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	successJSON(w, r, map[string][]string{"ruletemplates": names})
+}
+
+// GetRuleTemplate returns a rule template.
+func (k *K8s) GetRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateRuleTemplateName(w, r, name) {
+		return
+	}
+	templates, _, err := k.getRuleTemplates()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	text, ok := templates[name]
+	if !ok {
+		problemError(w, r, http.StatusNotFound, CodeTemplateNotFound, "Unable to find a rule template called: "+name)
+		return
+	}
+	success(w, r, text)
+}
+
+// PutRuleTemplate creates or updates a rule template, and re-renders the rules files rendered from it.  If any of them
+// no longer validates, nothing is changed.
+func (k *K8s) PutRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateRuleTemplateName(w, r, name) {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	text := string(b)
+	if _, err := parseRuleTemplate(name, text); err != nil {
+		validationFailed(w, r, CodeInvalidRuleTemplate, "ERROR: Unable to parse the rule template: "+err.Error(), err.Error())
+		return
+	}
+
+	templates, exists, err := k.getRuleTemplates()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	setAuditContent(r, templates[name], text)
+
+	// Render the instances of the template again, and check them all before changing anything
+	currentConfigMapName, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		return
+	}
+	updated := make(map[string]string)
+	for fileName, content := range currentConfigMap {
+		updated[fileName] = content
+	}
+	instances := templateInstances(currentConfigMap, name)
+	var changed []string
+	warnings := ""
+	for _, fileName := range instances {
+		_, parameters := renderedFrom(currentConfigMap[fileName])
+		rendered, err := renderRuleTemplate(name, text, parameters)
+		if err != nil {
+			validationFailed(w, r, CodeInvalidRuleTemplate, "No action taken.  Unable to render "+fileName+": "+err.Error(), err.Error())
+			return
+		}
+		if string(rendered) == currentConfigMap[fileName] {
+			continue
+		}
+		problem := checkPrometheusRuleFile(r, rendered)
+		var fileWarnings string
+		if problem == nil {
+			fileWarnings, problem = k.checkRuleFileAgainstOthers(r, fileName, rendered, updated)
+		}
+		if problem != nil {
+			problem.Detail = "No action taken.  The rendered " + fileName + " is invalid: " + problem.Detail
+			writeProblem(w, r, problem)
+			return
+		}
+		warnings += fileWarnings
+		updated[fileName] = string(rendered)
+		changed = append(changed, fileName)
+	}
+
+	// A template identical to the current one is only left alone if its instances are up to date: a previous update may
+	// have saved the template, but failed to save its instances.
+	current, ok := templates[name]
+	identical := ok && current == text
+	if identical && len(changed) == 0 {
+		success(w, r, "The provided body is identical to the current rule template: "+name+". No action will be taken.")
+		return
+	}
+
+	// Save the re-rendered instances first, keeping a version of each, so that a failure leaves the template as it was
+	// and the update can be retried
+	if len(changed) > 0 {
+		if err := k.checkMountedConfigMapFits(requestLogger(r), updated, currentConfigMapName); err != nil {
+			configMapUpdateFailed(w, r, "Unable to update alertrules ConfigMap.", err)
+			return
+		}
+		savedConfigMapName, savedConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesVersionsConfigMapPath)
+		if err != nil {
+			internalError(w, r, fmt.Sprintf("Unable to read alertrules-versions ConfigMap: %v", err))
+			return
+		}
+		if savedConfigMap == nil {
+			savedConfigMap = make(map[string]string)
+		}
+		timeNow := time.Now().UTC()
+		for _, fileName := range changed {
+			k.backupRulesVersion(r, savedConfigMap, fileName, currentConfigMap[fileName], timeNow)
+		}
+		if err := k.updateShardedConfigMapByName(requestLogger(r), savedConfigMap, savedConfigMapName); err != nil {
+			internalError(w, r, "Unable to update alertrules-versions ConfigMap. "+err.Error())
+			return
+		}
+		if err := k.updateMountedConfigMapByName(requestLogger(r), updated, currentConfigMapName); err != nil {
+			configMapUpdateFailed(w, r, "Unable to update alertrules ConfigMap.", err)
+			return
+		}
+	}
+
+	// Then the template
+	if !identical {
+		if !exists {
+			if err := k.createRuleTemplatesConfigMap(); err != nil {
+				internalError(w, r, "Unable to create the rule templates ConfigMap: "+err.Error())
+				return
+			}
+		}
+		templates[name] = text
+		if err := k.updateConfigMapByName(requestLogger(r), templates, getRuleTemplatesConfigMapName()); err != nil {
+			internalError(w, r, "Unable to update the rule templates ConfigMap: "+err.Error())
+			return
+		}
+	}
+	message := "The rule template: " + name + " is being saved."
+	if len(changed) == 0 {
+		success(w, r, message)
+		return
+	}
+	accepted(w, r, message+"  Re-rendered rules files: "+strings.Join(changed, ", ")+warnings)
+}
+
+// DeleteRuleTemplate deletes a rule template no rules file was rendered from.
+func (k *K8s) DeleteRuleTemplate(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateRuleTemplateName(w, r, name) {
+		return
+	}
+	templates, _, err := k.getRuleTemplates()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	if _, ok := templates[name]; !ok {
+		problemError(w, r, http.StatusNotFound, CodeTemplateNotFound, "No action taken. Unable to find a rule template called: "+name)
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read alertrules ConfigMap: %v", err))
+		return
+	}
+	if instances := templateInstances(currentConfigMap, name); len(instances) > 0 {
+		conflictError(w, r, "No action taken.  Rules files were rendered from the rule template "+name+": "+strings.Join(instances, ", "))
+		return
+	}
+	setAuditContent(r, templates[name], "")
+	delete(templates, name)
+	if err := k.updateConfigMapByName(requestLogger(r), templates, getRuleTemplatesConfigMapName()); err != nil {
+		internalError(w, r, "Unable to update the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	success(w, r, "The rule template: "+name+" has been deleted.")
+}
+
+// RenderPrometheusRules renders a rule template with the given parameters into a rules file, saved as with
+// PUT /prometheus/rules/{name}.  The file keeps a link to the template, so it is rendered again when the template is
+// updated.
+func (k *K8s) RenderPrometheusRules(w http.ResponseWriter, r *http.Request) {
+	fileName := path.Base(path.Dir(r.URL.Path))
+	r = withLogFields(r, "resource", fileName)
+	if !validateRulesFileName(w, r, fileName) {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request RuleTemplateRenderRequest
+	if err := yaml.Unmarshal(b, &request); err != nil {
+		validationFailed(w, r, CodeInvalidYAML, "ERROR: Unable to parse the render request: "+err.Error(), err.Error())
+		return
+	}
+	if request.Template == "" {
+		badRequest(w, r, "ERROR: No rule template was provided.")
+		return
+	}
+	templates, _, err := k.getRuleTemplates()
+	if err != nil {
+		internalError(w, r, "Unable to read the rule templates ConfigMap: "+err.Error())
+		return
+	}
+	text, ok := templates[request.Template]
+	if !ok {
+		problemError(w, r, http.StatusNotFound, CodeTemplateNotFound, "Unable to find a rule template called: "+request.Template)
+		return
+	}
+	rendered, err := renderRuleTemplate(request.Template, text, request.Parameters)
+	if err != nil {
+		validationFailed(w, r, CodeInvalidRuleTemplate, "ERROR: Unable to render the rule template: "+err.Error(), err.Error())
+		return
+	}
+	k.savePrometheusRules(w, r, fileName, rendered)
+}
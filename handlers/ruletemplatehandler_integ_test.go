@@ -0,0 +1,101 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRuleTemplates(t *testing.T) {
+	vmiName = "vmi-rule-templates-test"
+	namespace = "vmi-rule-templates-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	putTemplate := http.HandlerFunc(testclient.PutRuleTemplate)
+	render := http.HandlerFunc(testclient.RenderPrometheusRules)
+
+	send := func(handler http.HandlerFunc, method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	/* *** Rendering a template that does not exist *** */
+	rr := send(render, "POST", "/prometheus/rules/api.rules/render", `{"template": "availability", "parameters": {"job": "api"}}`)
+	verify(t, rr, http.StatusNotFound, "Unable to find a rule template called: availability")
+
+	/* *** Create a template *** */
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/availability", testRuleTemplate)
+	verify(t, rr, http.StatusOK, "The rule template: availability is being saved.")
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/broken", "groups: <% .job ")
+	verifyStatus(t, rr, http.StatusBadRequest)
+
+	rr = send(http.HandlerFunc(testclient.GetRuleTemplateNames), "GET", "/prometheus/rule-templates", "")
+	verify(t, rr, http.StatusOK, `"availability"`)
+
+	/* *** Render it twice *** */
+	rr = send(render, "POST", "/prometheus/rules/api.rules/render", `{"template": "availability", "parameters": {"job": "api", "threshold": 0.05}}`)
+	verify(t, rr, http.StatusAccepted, "A new rule file: api.rules is being created.")
+	rr = send(render, "POST", "/prometheus/rules/web.rules/render", "template: availability\nparameters:\n  job: web\n  threshold: 0.01\n")
+	verify(t, rr, http.StatusAccepted, "A new rule file: web.rules is being created.")
+	rr = send(render, "POST", "/prometheus/rules/db.rules/render", `{"template": "availability", "parameters": {"job": "db"}}`)
+	verify(t, rr, http.StatusBadRequest, "Unable to render the rule template")
+
+	rr = send(http.HandlerFunc(testclient.GetPrometheusRules), "GET", "/prometheus/rules/web.rules", "")
+	verify(t, rr, http.StatusOK, `expr: job:http_errors:ratio5m{job="web"} > 0.01`)
+
+	/* *** An update of the template producing invalid rules changes nothing *** */
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/availability", strings.Replace(testRuleTemplate, "> <% .threshold %>", "> > <% .threshold %>", 1))
+	verify(t, rr, http.StatusBadRequest, "The rendered api.rules is invalid")
+	rr = send(http.HandlerFunc(testclient.GetRuleTemplate), "GET", "/prometheus/rule-templates/availability", "")
+	verify(t, rr, http.StatusOK, testRuleTemplate)
+
+	/* *** Updating the template renders its instances again *** */
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/availability", strings.Replace(testRuleTemplate, "ratio5m", "ratio10m", -1))
+	verify(t, rr, http.StatusAccepted, "Re-rendered rules files: api.rules, web.rules")
+	rr = send(http.HandlerFunc(testclient.GetPrometheusRules), "GET", "/prometheus/rules/web.rules", "")
+	verify(t, rr, http.StatusOK, `expr: job:http_errors:ratio10m{job="web"} > 0.01`)
+	rr = send(http.HandlerFunc(testclient.GetPrometheusRuleVersions), "GET", "/prometheus/rules/web.rules/versions", "")
+	verify(t, rr, http.StatusOK, `"version": `)
+
+	/* *** A template saved without its instances, by a failed update, renders them again when retried *** */
+	retried := strings.Replace(testRuleTemplate, "ratio5m", "ratio15m", -1)
+	templates, _, err := testclient.getRuleTemplates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates["availability"] = retried
+	if err := testclient.updateConfigMapByName(zap.S(), templates, getRuleTemplatesConfigMapName()); err != nil {
+		t.Fatal(err)
+	}
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/availability", retried)
+	verify(t, rr, http.StatusAccepted, "Re-rendered rules files: api.rules, web.rules")
+	rr = send(putTemplate, "PUT", "/prometheus/rule-templates/availability", retried)
+	verify(t, rr, http.StatusOK, "The provided body is identical to the current rule template: availability.")
+
+	/* *** A template with instances cannot be deleted *** */
+	deleteTemplate := http.HandlerFunc(testclient.DeleteRuleTemplate)
+	rr = send(deleteTemplate, "DELETE", "/prometheus/rule-templates/availability", "")
+	verify(t, rr, http.StatusConflict, "api.rules, web.rules")
+
+	/* *** Once its instances are deleted, it can be *** */
+	for _, fileName := range []string{"api.rules", "web.rules"} {
+		rr = send(http.HandlerFunc(testclient.DeletePrometheusRules), "DELETE", "/prometheus/rules/"+fileName, "")
+		verifyStatus(t, rr, http.StatusAccepted)
+	}
+	rr = send(deleteTemplate, "DELETE", "/prometheus/rule-templates/availability", "")
+	verify(t, rr, http.StatusOK, "The rule template: availability has been deleted.")
+}
@@ -0,0 +1,85 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRuleTemplate = `groups:
+- name: <% .job %>-availability
+  rules:
+  - alert: <% .job %>HighErrorRate
+    expr: job:http_errors:ratio5m{job="<% .job %>"} > <% .threshold %>
+    annotations:
+      summary: 'Error rate of {{ $labels.job }} above <% .threshold %>'
+`
+
+func TestRenderRuleTemplate(t *testing.T) {
+	rendered, err := renderRuleTemplate("availability", testRuleTemplate, map[string]interface{}{"job": "api", "threshold": 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `# Rendered from rule template: availability
+# Template parameters: {"job":"api","threshold":0.05}
+groups:
+- name: api-availability
+  rules:
+  - alert: apiHighErrorRate
+    expr: job:http_errors:ratio5m{job="api"} > 0.05
+    annotations:
+      summary: 'Error rate of {{ $labels.job }} above 0.05'
+`
+	if string(rendered) != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", rendered, expected)
+	}
+
+	name, parameters := renderedFrom(string(rendered))
+	if name != "availability" || !reflect.DeepEqual(parameters, map[string]interface{}{"job": "api", "threshold": 0.05}) {
+		t.Errorf("unexpected link to the template: %s %v", name, parameters)
+	}
+	if name, _ := renderedFrom(strings.SplitN(expected, "\n", 3)[2]); name != "" {
+		t.Errorf("expected no link to a template, got %s", name)
+	}
+
+	if _, err := renderRuleTemplate("availability", testRuleTemplate, map[string]interface{}{"job": "api"}); err == nil {
+		t.Error("expected an error rendering without all the parameters")
+	}
+	if _, err := parseRuleTemplate("broken", "groups: <% .job "); err == nil {
+		t.Error("expected an error parsing an invalid template")
+	}
+
+	// Character classes of regular expressions are left alone
+	rendered, err = renderRuleTemplate("names", `expr: up{job=~"[[:alpha:]]+", env="<% .env %>"} == 0`, map[string]interface{}{"env": "prod"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(rendered), `expr: up{job=~"[[:alpha:]]+", env="prod"} == 0`) {
+		t.Errorf("unexpected rendered rules: %s", rendered)
+	}
+}
+
+func TestTemplateInstances(t *testing.T) {
+	api, err := renderRuleTemplate("availability", testRuleTemplate, map[string]interface{}{"job": "api", "threshold": 0.05})
+	if err != nil {
+		t.Fatal(err)
+	}
+	web, err := renderRuleTemplate("availability", testRuleTemplate, map[string]interface{}{"job": "web", "threshold": 0.01})
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := map[string]string{
+		"web.rules":   string(web),
+		"api.rules":   string(api),
+		"other.rules": "groups: []",
+	}
+	if instances := templateInstances(current, "availability"); !reflect.DeepEqual(instances, []string{"api.rules", "web.rules"}) {
+		t.Errorf("unexpected instances: %v", instances)
+	}
+	if instances := templateInstances(current, "latency"); len(instances) != 0 {
+		t.Errorf("unexpected instances: %v", instances)
+	}
+}
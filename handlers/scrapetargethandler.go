@@ -0,0 +1,140 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+// prometheusTargets is the data of a response of the Prometheus /api/v1/targets endpoint.
+type prometheusTargets struct {
+	ActiveTargets []prometheusTarget `json:"activeTargets"`
+}
+
+type prometheusTarget struct {
+	DiscoveredLabels   map[string]string `json:"discoveredLabels"`
+	Labels             map[string]string `json:"labels"`
+	ScrapePool         string            `json:"scrapePool"`
+	ScrapeURL          string            `json:"scrapeUrl"`
+	LastError          string            `json:"lastError"`
+	LastScrape         time.Time         `json:"lastScrape"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	Health             string            `json:"health"`
+}
+
+// ScrapeTarget is the state in Prometheus of a target of a scrape job.
+type ScrapeTarget struct {
+	ScrapeURL          string            `json:"scrapeUrl"`
+	Health             string            `json:"health"`
+	LastError          string            `json:"lastError,omitempty"`
+	LastScrape         *time.Time        `json:"lastScrape,omitempty"`
+	LastScrapeDuration float64           `json:"lastScrapeDuration"`
+	Labels             map[string]string `json:"labels"`
+}
+
+// ScrapeJobTargets is the state of the targets of a scrape job.  JobsWithoutTargets are the jobs of prometheus.yml
+// Prometheus found no targets for, e.g. because their service discovery or relabel configs select none, or until
+// Prometheus has loaded a new job.
+type ScrapeJobTargets struct {
+	Job                string         `json:"job"`
+	Up                 int            `json:"up"`
+	Down               int            `json:"down"`
+	Unknown            int            `json:"unknown"`
+	Targets            []ScrapeTarget `json:"targets"`
+	JobsWithoutTargets []string       `json:"jobsWithoutTargets"`
+}
+
+// scrapeJobNames returns the names of the scrape jobs of prometheus.yml.
+func scrapeJobNames(config *gabs.Container) []string {
+	names := make([]string, 0)
+	for _, job := range config.S("scrape_configs").Children() {
+		if name, ok := job.S("job_name").Data().(string); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// targetScrapePool returns the scrape job of a target.  Prometheus versions before 2.15 do not report the scrape pool,
+// so their targets are taken to be of the job of their job label.
+func targetScrapePool(target prometheusTarget) string {
+	if target.ScrapePool != "" {
+		return target.ScrapePool
+	}
+	return target.Labels["job"]
+}
+
+// scrapeJobTargets joins the targets Prometheus scrapes with the scrape jobs of prometheus.yml.
+func scrapeJobTargets(job string, jobNames []string, targets []prometheusTarget) *ScrapeJobTargets {
+	result := &ScrapeJobTargets{Job: job, Targets: make([]ScrapeTarget, 0), JobsWithoutTargets: make([]string, 0)}
+	pools := make(map[string]bool)
+	for _, target := range targets {
+		pool := targetScrapePool(target)
+		pools[pool] = true
+		if pool != job {
+			continue
+		}
+		scrapeTarget := ScrapeTarget{
+			ScrapeURL:          target.ScrapeURL,
+			Health:             target.Health,
+			LastError:          target.LastError,
+			LastScrapeDuration: target.LastScrapeDuration,
+			Labels:             target.Labels,
+		}
+		if !target.LastScrape.IsZero() {
+			lastScrape := target.LastScrape
+			scrapeTarget.LastScrape = &lastScrape
+		}
+		switch target.Health {
+		case "up":
+			result.Up++
+		case "down":
+			result.Down++
+		default:
+			result.Unknown++
+		}
+		result.Targets = append(result.Targets, scrapeTarget)
+	}
+	sort.SliceStable(result.Targets, func(i, j int) bool { return result.Targets[i].ScrapeURL < result.Targets[j].ScrapeURL })
+	for _, name := range jobNames {
+		if !pools[name] {
+			result.JobsWithoutTargets = append(result.JobsWithoutTargets, name)
+		}
+	}
+	return result
+}
+
+// GetScrapeJobTargets returns the health, last error, last scrape duration and labels of each target of a scrape job,
+// as Prometheus reports them, along with the jobs of prometheus.yml that have no targets.
+func (k *K8s) GetScrapeJobTargets(w http.ResponseWriter, r *http.Request) {
+	job := path.Base(path.Dir(r.URL.Path))
+	r = withLogFields(r, "resource", job)
+
+	config, err := k.getPrometheusConfigJSON(requestLogger(r))
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err))
+		return
+	}
+	jobNames := scrapeJobNames(config)
+	if !containsString(jobNames, job) {
+		problemError(w, r, http.StatusNotFound, CodeJobNotFound, "Unable to find the scrape job: "+job)
+		return
+	}
+
+	params := url.Values{}
+	params.Set("state", "active")
+	var targets prometheusTargets
+	if err := prometheusAPIGet("/api/v1/targets", params, &targets); err != nil {
+		serviceUnavailable(w, r, "Unable to get the targets of Prometheus: "+err.Error())
+		return
+	}
+	successJSON(w, r, scrapeJobTargets(job, jobNames, targets.ActiveTargets))
+}
@@ -0,0 +1,97 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// Response of the Prometheus /api/v1/targets endpoint, for the jobs of the test Prometheus configuration but
+// kubernetes-pods and fake_dev.  The PushGateway target is of a Prometheus version not reporting scrape pools.
+const testPrometheusTargets = `{"activeTargets": [
+  {"discoveredLabels": {"__address__": "localhost:9090", "job": "prometheus"},
+   "labels": {"instance": "localhost:9090", "job": "prometheus"}, "scrapePool": "prometheus",
+   "scrapeUrl": "http://localhost:9090/metrics", "lastError": "", "lastScrape": "2020-10-01T10:00:00Z",
+   "lastScrapeDuration": 0.004, "health": "up"},
+  {"discoveredLabels": {"__address__": "vmi-dev-fake-prometheus-gw:9091", "job": "PushGateway"},
+   "labels": {"instance": "vmi-dev-fake-prometheus-gw:9091", "job": "PushGateway"},
+   "scrapeUrl": "http://vmi-dev-fake-prometheus-gw:9091/metrics", "lastError": "connection refused",
+   "lastScrape": "2020-10-01T10:00:00Z", "lastScrapeDuration": 0.001, "health": "down"}],
+ "droppedTargets": []}`
+
+func TestScrapeJobTargets(t *testing.T) {
+	var targets prometheusTargets
+	if err := json.Unmarshal([]byte(testPrometheusTargets), &targets); err != nil {
+		t.Fatal(err)
+	}
+	jobNames := []string{"prometheus", "PushGateway", "kubernetes-pods"}
+
+	result := scrapeJobTargets("PushGateway", jobNames, targets.ActiveTargets)
+	if result.Up != 0 || result.Down != 1 || len(result.Targets) != 1 {
+		t.Fatalf("unexpected targets: %+v", result)
+	}
+	target := result.Targets[0]
+	if target.LastError != "connection refused" || target.LastScrape == nil || target.Labels["instance"] != "vmi-dev-fake-prometheus-gw:9091" {
+		t.Errorf("unexpected target: %+v", target)
+	}
+	if len(result.JobsWithoutTargets) != 1 || result.JobsWithoutTargets[0] != "kubernetes-pods" {
+		t.Errorf("expected only kubernetes-pods to have no targets, got %v", result.JobsWithoutTargets)
+	}
+
+	result = scrapeJobTargets("kubernetes-pods", jobNames, targets.ActiveTargets)
+	if len(result.Targets) != 0 || result.Up != 0 {
+		t.Errorf("expected no targets, got %+v", result)
+	}
+}
+
+func TestGetScrapeJobTargets(t *testing.T) {
+	vmiName = "scrape-targets-test"
+	namespace = "scrape-targets-test"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	send := func(url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/targets" || r.URL.Query().Get("state") != "active" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		fmt.Fprintf(w, `{"status":"success","data":%s}`, testPrometheusTargets)
+	}))
+	prometheusURL = server.URL
+	defer func() { prometheusURL = "" }()
+
+	/* *** The targets of a job *** */
+	rr := send("/prometheus/scrape_configs/prometheus/targets")
+	verify(t, rr, http.StatusOK, `"scrapeUrl": "http://localhost:9090/metrics"`)
+	verify(t, rr, http.StatusOK, `"up": 1`)
+	verify(t, rr, http.StatusOK, `"fake_dev"`)
+
+	/* *** A job of prometheus.yml with no targets *** */
+	rr = send("/prometheus/scrape_configs/kubernetes-pods/targets")
+	verify(t, rr, http.StatusOK, `"targets": []`)
+
+	/* *** A job that does not exist *** */
+	rr = send("/prometheus/scrape_configs/nope/targets")
+	verify(t, rr, http.StatusNotFound, "Unable to find the scrape job: nope")
+
+	/* *** Prometheus cannot be called *** */
+	server.Close()
+	rr = send("/prometheus/scrape_configs/prometheus/targets")
+	verify(t, rr, http.StatusServiceUnavailable, "Unable to get the targets of Prometheus")
+}
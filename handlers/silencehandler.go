@@ -0,0 +1,252 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/pkg/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+)
+
+// States of a silence
+const (
+	silenceStateActive  = "active"
+	silenceStatePending = "pending"
+	silenceStateExpired = "expired"
+)
+
+var silenceIDPattern = regexp.MustCompile(`^[0-9a-fA-F-]+$`)
+
+// SilenceMatcher matches the alerts a silence mutes, by the value of a label, or a regular expression.
+type SilenceMatcher struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	IsRegex bool   `json:"isRegex"`
+}
+
+// SilenceStatus is the state of a silence: pending until it starts, active until it ends, then expired.
+type SilenceStatus struct {
+	State string `json:"state"`
+}
+
+// Silence is a silence of the Alertmanager API.
+type Silence struct {
+	ID        string           `json:"id,omitempty"`
+	Status    *SilenceStatus   `json:"status,omitempty"`
+	UpdatedAt *time.Time       `json:"updatedAt,omitempty"`
+	Matchers  []SilenceMatcher `json:"matchers"`
+	StartsAt  time.Time        `json:"startsAt"`
+	EndsAt    time.Time        `json:"endsAt"`
+	CreatedBy string           `json:"createdBy"`
+	Comment   string           `json:"comment"`
+}
+
+// SilenceRequest creates a silence.  The alerts silenced are given either as matchers, or as a selector such as
+// {job="api",severity=~"warning|critical"}.  The silence starts at StartsAt, now by default, and ends at EndsAt or
+// after Duration.  CreatedBy and Comment default to the change metadata of the request.
+type SilenceRequest struct {
+	Matchers  []SilenceMatcher `json:"matchers,omitempty"`
+	Selector  string           `json:"selector,omitempty"`
+	StartsAt  *time.Time       `json:"startsAt,omitempty"`
+	EndsAt    *time.Time       `json:"endsAt,omitempty"`
+	Duration  string           `json:"duration,omitempty"`
+	CreatedBy string           `json:"createdBy,omitempty"`
+	Comment   string           `json:"comment,omitempty"`
+}
+
+// selectorMatchers returns the matchers of a selector such as {job="api",severity=~"warning|critical"}.  Silences
+// cannot negate a matcher.
+func selectorMatchers(selector string) ([]SilenceMatcher, error) {
+	parsed, err := parser.ParseMetricSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	matchers := make([]SilenceMatcher, 0, len(parsed))
+	for _, matcher := range parsed {
+		switch matcher.Type {
+		case labels.MatchEqual:
+			matchers = append(matchers, SilenceMatcher{Name: matcher.Name, Value: matcher.Value})
+		case labels.MatchRegexp:
+			matchers = append(matchers, SilenceMatcher{Name: matcher.Name, Value: matcher.Value, IsRegex: true})
+		default:
+			return nil, fmt.Errorf("the matcher %s cannot be used in a silence, only = and =~ can", matcher)
+		}
+	}
+	return matchers, nil
+}
+
+// newSilence returns the silence a request creates, starting now if not scheduled.
+func newSilence(request *SilenceRequest, metadata ChangeMetadata, now time.Time) (*Silence, error) {
+	silence := &Silence{Matchers: request.Matchers, StartsAt: now, CreatedBy: request.CreatedBy, Comment: request.Comment}
+	if request.Selector != "" {
+		if len(request.Matchers) > 0 {
+			return nil, errors.New("either matchers or a selector must be provided, not both")
+		}
+		matchers, err := selectorMatchers(request.Selector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector: %v", err)
+		}
+		silence.Matchers = matchers
+	}
+	if len(silence.Matchers) == 0 {
+		return nil, errors.New("no matchers were provided")
+	}
+	matchesAll := true
+	for _, matcher := range silence.Matchers {
+		matchType := labels.MatchEqual
+		if matcher.IsRegex {
+			matchType = labels.MatchRegexp
+		}
+		m, err := labels.NewMatcher(matchType, matcher.Name, matcher.Value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid matcher %s: %v", matcher.Name, err)
+		}
+		if !model.LabelName(matcher.Name).IsValid() {
+			return nil, fmt.Errorf("invalid label name: %s", matcher.Name)
+		}
+		if !m.Matches("") {
+			matchesAll = false
+		}
+	}
+	if matchesAll {
+		return nil, errors.New("at least one matcher must not match the empty string, so the silence does not mute all alerts")
+	}
+
+	if request.StartsAt != nil {
+		silence.StartsAt = request.StartsAt.UTC()
+	}
+	switch {
+	case request.EndsAt != nil && request.Duration != "":
+		return nil, errors.New("either endsAt or a duration must be provided, not both")
+	case request.EndsAt != nil:
+		silence.EndsAt = request.EndsAt.UTC()
+	case request.Duration != "":
+		duration, err := model.ParseDuration(request.Duration)
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration: %v", err)
+		}
+		silence.EndsAt = silence.StartsAt.Add(time.Duration(duration))
+	default:
+		return nil, errors.New("no endsAt or duration was provided")
+	}
+	if !silence.EndsAt.After(silence.StartsAt) {
+		return nil, errors.New("the silence must end after it starts")
+	}
+	if !silence.EndsAt.After(now) {
+		return nil, errors.New("the silence must end in the future")
+	}
+
+	if silence.CreatedBy == "" {
+		silence.CreatedBy = metadata.Author
+	}
+	if silence.Comment == "" {
+		silence.Comment = strings.TrimSpace(metadata.Comment + " " + metadata.Ticket)
+	}
+	if silence.CreatedBy == "" || silence.Comment == "" {
+		return nil, errors.New("a silence needs createdBy and a comment, given in the request or as its change metadata")
+	}
+	return silence, nil
+}
+
+// alertmanagerAPIFailed writes the response to a failed call of the Alertmanager API.
+func alertmanagerAPIFailed(w http.ResponseWriter, r *http.Request, err error, notFoundCode string) {
+	var apiErr *AlertmanagerAPIError
+	switch {
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound && notFoundCode != "":
+		problemError(w, r, http.StatusNotFound, notFoundCode, apiErr.Message)
+	case errors.As(err, &apiErr) && apiErr.Status == http.StatusBadRequest:
+		problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: Alertmanager refused the request: "+apiErr.Message)
+	default:
+		serviceUnavailable(w, r, "Unable to call the Alertmanager API: "+err.Error())
+	}
+}
+
+// GetSilences returns the silences of Alertmanager, optionally only those in the given ?state=, and matching the
+// given ?filter= matchers, such as filter=job="api".
+func (k *K8s) GetSilences(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state != "" && state != silenceStateActive && state != silenceStatePending && state != silenceStateExpired {
+		problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: Invalid state: "+state+", must be one of active, pending or expired")
+		return
+	}
+	params := url.Values{}
+	for _, filter := range r.URL.Query()["filter"] {
+		params.Add("filter", filter)
+	}
+	var silences []Silence
+	if err := k.alertmanagerAPI(requestLogger(r), "GET", "/api/v2/silences", params, nil, &silences); err != nil {
+		alertmanagerAPIFailed(w, r, err, "")
+		return
+	}
+	result := make([]Silence, 0, len(silences))
+	for _, silence := range silences {
+		if state == "" || (silence.Status != nil && silence.Status.State == state) {
+			result = append(result, silence)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].StartsAt.Before(result[j].StartsAt) })
+	successJSON(w, r, result)
+}
+
+// CreateSilence creates a silence, starting now or scheduled for later.
+func (k *K8s) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request SilenceRequest
+	if err := json.Unmarshal(b, &request); err != nil {
+		validationFailed(w, r, CodeInvalidJSON, "ERROR: Unable to parse the silence: "+err.Error(), err.Error())
+		return
+	}
+	now := time.Now().UTC()
+	silence, err := newSilence(&request, getChangeMetadata(r), now)
+	if err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: Invalid silence: "+err.Error())
+		return
+	}
+	var created struct {
+		SilenceID string `json:"silenceID"`
+	}
+	if err := k.alertmanagerAPI(requestLogger(r), "POST", "/api/v2/silences", nil, silence, &created); err != nil {
+		alertmanagerAPIFailed(w, r, err, "")
+		return
+	}
+	silence.ID = created.SilenceID
+	silence.Status = &SilenceStatus{State: silenceStateActive}
+	if silence.StartsAt.After(now) {
+		silence.Status.State = silenceStatePending
+	}
+	r = withLogFields(r, "resource", silence.ID)
+	requestLogger(r).Infow("Created silence", "startsAt", silence.StartsAt, "endsAt", silence.EndsAt)
+	successJSON(w, r, silence)
+}
+
+// ExpireSilence expires a silence, ending it now.
+func (k *K8s) ExpireSilence(w http.ResponseWriter, r *http.Request) {
+	id := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", id)
+	if !silenceIDPattern.MatchString(id) {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: Invalid silence ID: "+id)
+		return
+	}
+	if err := k.alertmanagerAPI(requestLogger(r), "DELETE", "/api/v2/silence/"+id, nil, nil, nil); err != nil {
+		alertmanagerAPIFailed(w, r, err, CodeSilenceNotFound)
+		return
+	}
+	success(w, r, "The silence: "+id+" has been expired.")
+}
@@ -0,0 +1,106 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	k8sfake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSilences(t *testing.T) {
+	vmiName = "vmi-silences-test"
+	namespace = "vmi-silences-test"
+	alertmanager := &fakeAlertmanager{}
+	server := httptest.NewServer(alertmanager)
+	defer server.Close()
+	testclient := newAlertmanagerTestClient(t, server)
+	defer func() { alertmanagerPort = "9093" }()
+
+	send := func(handler http.HandlerFunc, method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Change-Author", "jdoe")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+	create := http.HandlerFunc(testclient.CreateSilence)
+
+	/* *** Silence from a selector, now *** */
+	rr := send(create, "POST", "/alertmanager/silences", `{"selector": "{job=\"api\",severity=~\"warning|critical\"}", "duration": "2h", "comment": "Upgrading the api"}`)
+	verify(t, rr, http.StatusOK, `"state": "active"`)
+	if len(alertmanager.silences) != 1 {
+		t.Fatalf("expected a silence to be created, got %d", len(alertmanager.silences))
+	}
+	silence := alertmanager.silences[0]
+	if silence.CreatedBy != "jdoe" || len(silence.Matchers) != 2 || !silence.Matchers[1].IsRegex || silence.EndsAt.Sub(silence.StartsAt) != 2*time.Hour {
+		t.Errorf("unexpected silence: %+v", silence)
+	}
+
+	/* *** Silence scheduled for later, from matchers *** */
+	startsAt := time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+	endsAt := time.Now().Add(26 * time.Hour).UTC().Format(time.RFC3339)
+	rr = send(create, "POST", "/alertmanager/silences", `{"matchers": [{"name": "alertname", "value": "InstanceDown"}], "startsAt": "`+
+		startsAt+`", "endsAt": "`+endsAt+`", "createdBy": "ops", "comment": "Maintenance window"}`)
+	verify(t, rr, http.StatusOK, `"state": "pending"`)
+
+	/* *** Invalid silences *** */
+	for body, message := range map[string]string{
+		`{"selector": "{job!=\"api\"}", "duration": "1h", "comment": "x"}`:                "only = and =~ can",
+		`{"selector": "{job=~\".*\"}", "duration": "1h", "comment": "x"}`:                 "at least one matcher must not match the empty string",
+		`{"selector": "{job=\"api\"}", "comment": "x"}`:                                   "no endsAt or duration was provided",
+		`{"selector": "{job=\"api\"}", "duration": "1h"}`:                                 "a silence needs createdBy and a comment",
+		`{"selector": "{job=\"api\"}", "endsAt": "2020-01-01T00:00:00Z", "comment": "x"}`: "the silence must end after it starts",
+		`{"selector": "{job=\"api\"", "duration": "1h", "comment": "x"}`:                  "invalid selector",
+	} {
+		rr = send(create, "POST", "/alertmanager/silences", body)
+		verify(t, rr, http.StatusBadRequest, message)
+	}
+
+	/* *** List them *** */
+	get := http.HandlerFunc(testclient.GetSilences)
+	rr = send(get, "GET", "/alertmanager/silences?filter=job%3D%22api%22", "")
+	verify(t, rr, http.StatusOK, "Upgrading the api")
+	if len(alertmanager.filters) != 1 || alertmanager.filters[0] != `job="api"` {
+		t.Errorf("expected the filter to be passed on, got %v", alertmanager.filters)
+	}
+	rr = send(get, "GET", "/alertmanager/silences?state=pending", "")
+	verify(t, rr, http.StatusOK, "Maintenance window")
+	if strings.Contains(rr.Body.String(), "Upgrading the api") {
+		t.Errorf("expected only pending silences, got %s", rr.Body.String())
+	}
+	rr = send(get, "GET", "/alertmanager/silences?state=silenced", "")
+	verifyStatus(t, rr, http.StatusBadRequest)
+
+	/* *** Expire one *** */
+	expire := http.HandlerFunc(testclient.ExpireSilence)
+	rr = send(expire, "DELETE", "/alertmanager/silences/"+silence.ID, "")
+	verify(t, rr, http.StatusOK, "The silence: "+silence.ID+" has been expired.")
+	rr = send(get, "GET", "/alertmanager/silences?state=expired", "")
+	verify(t, rr, http.StatusOK, "Upgrading the api")
+	rr = send(expire, "DELETE", "/alertmanager/silences/99999999-1111-2222-3333-444444444444", "")
+	verify(t, rr, http.StatusNotFound, "silence not found")
+	rr = send(expire, "DELETE", "/alertmanager/silences/..", "")
+	verifyStatus(t, rr, http.StatusBadRequest)
+}
+
+func TestSilencesWithoutAlertmanager(t *testing.T) {
+	vmiName = "vmi-silences-test"
+	namespace = "vmi-silences-test"
+	testclient := &K8s{ClientSet: k8sfake.NewSimpleClientset()}
+	req, err := http.NewRequest("GET", "/alertmanager/silences", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.GetSilences).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusServiceUnavailable, errNoAlertmanagerPods.Error())
+}
@@ -0,0 +1,333 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/promql/parser"
+	"sigs.k8s.io/yaml"
+)
+
+// Header of the rules files generated for an SLO, holding its definition
+const sloDefinitionPrefix = "# SLO definition: "
+
+// Placeholder for the rate window in the SLI expressions of an SLO
+const sloWindowPlaceholder = "$window"
+
+// Default compliance window of an SLO
+const defaultSLOWindow = "30d"
+
+// SLO is a service level objective: the ratio of good events to all events, the SLI, must stay above the target over
+// the window.  The SLI expressions either select counters, or use $window as the range of their rates.  Labels and
+// Annotations are added to the burn rate alerts, Annotations replacing the generated summary and description.
+type SLO struct {
+	SLI         SLI               `json:"sli"`
+	Target      float64           `json:"target"`
+	Window      string            `json:"window,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// SLI is the service level indicator of an SLO, the ratio of good events to all events.
+type SLI struct {
+	Good  string `json:"good"`
+	Total string `json:"total"`
+}
+
+// sloBurnRateAlert is one of the multi-window, multi-burn-rate alerts of the Site Reliability Workbook: it fires when
+// the given fraction of the error budget of a 30d window is spent within the long window, and still being spent over
+// the short one.
+type sloBurnRateAlert struct {
+	longWindow     model.Duration
+	shortWindow    model.Duration
+	budgetFraction float64
+	severity       string
+	forDuration    string
+}
+
+var sloBurnRateAlerts = []sloBurnRateAlert{
+	{longWindow: model.Duration(time.Hour), shortWindow: model.Duration(5 * time.Minute), budgetFraction: 0.02, severity: "critical", forDuration: "2m"},
+	{longWindow: model.Duration(6 * time.Hour), shortWindow: model.Duration(30 * time.Minute), budgetFraction: 0.05, severity: "critical", forDuration: "2m"},
+	{longWindow: model.Duration(24 * time.Hour), shortWindow: model.Duration(2 * time.Hour), budgetFraction: 0.1, severity: "warning", forDuration: "15m"},
+	{longWindow: model.Duration(72 * time.Hour), shortWindow: model.Duration(6 * time.Hour), budgetFraction: 0.1, severity: "warning", forDuration: "15m"},
+}
+
+var (
+	errSLOTarget = errors.New("the target must be between 0 and 1, e.g. 0.999")
+	errSLOWindow = errors.New("the window must be at least 1h")
+)
+
+// sloRulesFileName returns the name of the rules file generated for an SLO.
+func sloRulesFileName(name string) string {
+	return "slo-" + name + ".rules"
+}
+
+// alertNamePart returns a name for use in an alert name, with the characters not allowed there replaced by underscores.
+func alertNamePart(name string) string {
+	return strings.Map(func(c rune) rune {
+		if (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '_' {
+			return c
+		}
+		return '_'
+	}, name)
+}
+
+// sloAlertName returns the name of the burn rate alert of an SLO over the given long window, unique across SLOs, e.g.
+// SLOErrorBudgetBurn_api_1h.
+func sloAlertName(name string, longWindow model.Duration) string {
+	return "SLOErrorBudgetBurn_" + alertNamePart(name) + "_" + longWindow.String()
+}
+
+// sloErrorRatioRecord returns the name of the series recording the error ratio of SLOs over the given window.
+func sloErrorRatioRecord(window model.Duration) string {
+	return "slo:sli_error:ratio_rate" + window.String()
+}
+
+// sloRate returns the rate of an SLI expression over the given window.
+func sloRate(expr string, window model.Duration) string {
+	if strings.Contains(expr, sloWindowPlaceholder) {
+		return strings.Replace(expr, sloWindowPlaceholder, window.String(), -1)
+	}
+	return "sum(rate(" + expr + "[" + window.String() + "]))"
+}
+
+// validateSLO checks an SLO definition, and sets its defaults.
+func validateSLO(slo *SLO) (model.Duration, error) {
+	if slo.Target <= 0 || slo.Target >= 1 {
+		return 0, errSLOTarget
+	}
+	if slo.Window == "" {
+		slo.Window = defaultSLOWindow
+	}
+	window, err := model.ParseDuration(slo.Window)
+	if err != nil {
+		return 0, fmt.Errorf("invalid window: %v", err)
+	}
+	if window < sloBurnRateAlerts[0].longWindow {
+		return 0, errSLOWindow
+	}
+	for name := range slo.Annotations {
+		if !model.LabelName(name).IsValid() {
+			return 0, fmt.Errorf("invalid annotation name: %s", name)
+		}
+	}
+	for name, expr := range map[string]string{"good": slo.SLI.Good, "total": slo.SLI.Total} {
+		if expr == "" {
+			return 0, fmt.Errorf("no %s SLI expression was provided", name)
+		}
+		if !strings.Contains(expr, sloWindowPlaceholder) {
+			selector, err := parser.ParseExpr(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid %s SLI expression: %v", name, err)
+			}
+			if _, ok := selector.(*parser.VectorSelector); !ok {
+				return 0, fmt.Errorf("the %s SLI expression must select counters, or use %s as the range of its rates", name, sloWindowPlaceholder)
+			}
+		} else if _, err := parser.ParseExpr(sloRate(expr, window)); err != nil {
+			return 0, fmt.Errorf("invalid %s SLI expression: %v", name, err)
+		}
+	}
+	return window, nil
+}
+
+// sloRuleFile generates the recording rules of the error ratios of an SLO, and its burn rate alerts.  Alerts over
+// windows longer than the SLO window are left out.
+func sloRuleFile(name string, slo *SLO, window model.Duration) *RuleFile {
+	sloLabels := map[string]string{"slo": name}
+	budget := 1 - slo.Target
+
+	// Error ratios over all the windows the alerts need
+	var windows []model.Duration
+	seen := make(map[model.Duration]bool)
+	var alerts []sloBurnRateAlert
+	for _, alert := range sloBurnRateAlerts {
+		if alert.longWindow > window {
+			continue
+		}
+		alerts = append(alerts, alert)
+		for _, w := range []model.Duration{alert.shortWindow, alert.longWindow} {
+			if !seen[w] {
+				seen[w] = true
+				windows = append(windows, w)
+			}
+		}
+	}
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	recordingGroup := RuleGroup{Name: "slo-" + name + "-recording"}
+	for _, w := range windows {
+		recordingGroup.Rules = append(recordingGroup.Rules, Rule{
+			Record: sloErrorRatioRecord(w),
+			Expr:   "1 - (" + sloRate(slo.SLI.Good, w) + " / " + sloRate(slo.SLI.Total, w) + ")",
+			Labels: sloLabels,
+		})
+	}
+
+	alertGroup := RuleGroup{Name: "slo-" + name + "-alerts"}
+	for _, alert := range alerts {
+		// Burn rate spending the budget fraction of the SLO window within the long window, rounded off to hide the float
+		// errors of the target
+		burnRate := alert.budgetFraction * float64(window) / float64(alert.longWindow)
+		threshold := strconv.FormatFloat(burnRate*budget, 'g', 6, 64)
+		selector := `{slo="` + name + `"}`
+		labels := map[string]string{}
+		for key, value := range slo.Labels {
+			labels[key] = value
+		}
+		labels["slo"] = name
+		labels["severity"] = alert.severity
+		labels["long_window"] = alert.longWindow.String()
+		annotations := map[string]string{
+			"summary": "SLO " + name + " is burning its error budget " + strconv.FormatFloat(burnRate, 'g', 3, 64) + " times too fast",
+			"description": fmt.Sprintf("At this rate, %g%% of the %s error budget of SLO %s (target %g) is spent within %s.",
+				alert.budgetFraction*100, slo.Window, name, slo.Target, alert.longWindow),
+		}
+		for key, value := range slo.Annotations {
+			annotations[key] = value
+		}
+		alertGroup.Rules = append(alertGroup.Rules, Rule{
+			Alert: sloAlertName(name, alert.longWindow),
+			Expr: sloErrorRatioRecord(alert.longWindow) + selector + " > " + threshold + " and " +
+				sloErrorRatioRecord(alert.shortWindow) + selector + " > " + threshold,
+			For:         alert.forDuration,
+			Labels:      labels,
+			Annotations: annotations,
+		})
+	}
+	return &RuleFile{Groups: []RuleGroup{recordingGroup, alertGroup}}
+}
+
+// generateSLORules returns the rules file of an SLO, starting with its definition.
+func generateSLORules(name string, slo *SLO, window model.Duration) ([]byte, error) {
+	definition, err := json.Marshal(slo)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := yaml.Marshal(sloRuleFile(name, slo, window))
+	if err != nil {
+		return nil, err
+	}
+	header := sloDefinitionPrefix + string(definition) + "\n# Generated from PUT /slos/" + name + ", changes made here are lost when it is updated.\n"
+	return append([]byte(header), rules...), nil
+}
+
+// sloDefinition returns the definition of the SLO a rules file was generated for, nil if it was not.
+func sloDefinition(content string) *SLO {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	if !scanner.Scan() || !strings.HasPrefix(scanner.Text(), sloDefinitionPrefix) {
+		return nil
+	}
+	var slo SLO
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(scanner.Text(), sloDefinitionPrefix)), &slo); err != nil {
+		return nil
+	}
+	return &slo
+}
+
+// validateSLOName checks the name of an SLO, and writes a 400 response if it is invalid.
+func validateSLOName(w http.ResponseWriter, r *http.Request, name string) bool {
+	if validateName(name) != nil || ValidateConfigMapKeyName(sloRulesFileName(name)) != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: The SLO name provided is invalid.")
+		return false
+	}
+	return true
+}
+
+// GetSLONames returns the names of all SLOs.
+func (k *K8s) GetSLONames(w http.ResponseWriter, r *http.Request) {
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	names := make([]string, 0)
+	for fileName, content := range currentConfigMap {
+		if strings.HasPrefix(fileName, "slo-") && sloDefinition(content) != nil {
+			names = append(names, strings.TrimSuffix(strings.TrimPrefix(fileName, "slo-"), ".rules"))
+		}
+	}
+	sort.Strings(names)
+	successJSON(w, r, map[string][]string{"slos": names})
+}
+
+// GetSLO returns the definition of an SLO.
+func (k *K8s) GetSLO(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateSLOName(w, r, name) {
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	slo := sloDefinition(currentConfigMap[sloRulesFileName(name)])
+	if slo == nil {
+		problemError(w, r, http.StatusNotFound, CodeSLONotFound, "Unable to find an SLO called: "+name)
+		return
+	}
+	successJSON(w, r, slo)
+}
+
+// PutSLO creates or updates an SLO, generating its recording and alerting rules into the slo-{name}.rules file, saved
+// as with PUT /prometheus/rules/{name}.
+func (k *K8s) PutSLO(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateSLOName(w, r, name) {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var slo SLO
+	if err := yaml.UnmarshalStrict(b, &slo); err != nil {
+		validationFailed(w, r, CodeInvalidSLO, "ERROR: Unable to parse the SLO: "+err.Error(), err.Error())
+		return
+	}
+	window, err := validateSLO(&slo)
+	if err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidSLO, "ERROR: Invalid SLO: "+err.Error())
+		return
+	}
+	rules, err := generateSLORules(name, &slo, window)
+	if err != nil {
+		internalError(w, r, "Unable to generate the rules of the SLO: "+err.Error())
+		return
+	}
+	k.savePrometheusRules(w, r, sloRulesFileName(name), rules)
+}
+
+// DeleteSLO deletes an SLO, and the rules file generated for it.
+func (k *K8s) DeleteSLO(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", name)
+	if !validateSLOName(w, r, name) {
+		return
+	}
+	_, currentConfigMap, err := k.getShardedConfigMapByPath(requestLogger(r), PrometheusRulesConfigMapPath)
+	if err != nil {
+		internalError(w, r, fmt.Sprintf("Unable to read the alertrules ConfigMap: %v", err))
+		return
+	}
+	if sloDefinition(currentConfigMap[sloRulesFileName(name)]) == nil {
+		problemError(w, r, http.StatusNotFound, CodeSLONotFound, "No action taken. Unable to find an SLO called: "+name)
+		return
+	}
+	k.deletePrometheusRules(w, r, sloRulesFileName(name))
+}
@@ -0,0 +1,115 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSLOs(t *testing.T) {
+	vmiName = "vmi-slos-test"
+	namespace = "vmi-slos-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	putSLO := http.HandlerFunc(testclient.PutSLO)
+
+	send := func(handler http.HandlerFunc, method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	/* *** Invalid SLOs *** */
+	rr := send(putSLO, "PUT", "/slos/api", `{"sli": {"good": "good_total", "total": "all_total"}, "target": 99.9}`)
+	verify(t, rr, http.StatusBadRequest, "the target must be between 0 and 1")
+	rr = send(putSLO, "PUT", "/slos/api", `{"sli": {"good": "good_total", "total": "all_total"}, "target": 0.999, "unknown": 1}`)
+	verifyStatus(t, rr, http.StatusBadRequest)
+
+	/* *** Create an SLO *** */
+	slo := `{"sli": {"good": "http_requests_total{job=\"api\",code!~\"5..\"}", "total": "http_requests_total{job=\"api\"}"}, "target": 0.999}`
+	rr = send(putSLO, "PUT", "/slos/api", slo)
+	verify(t, rr, http.StatusAccepted, "A new rule file: slo-api.rules is being created.")
+	rr = send(http.HandlerFunc(testclient.GetPrometheusRules), "GET", "/prometheus/rules/slo-api.rules", "")
+	verify(t, rr, http.StatusOK, "record: slo:sli_error:ratio_rate5m")
+
+	rr = send(http.HandlerFunc(testclient.GetSLO), "GET", "/slos/api", "")
+	verify(t, rr, http.StatusOK, `"window": "30d"`)
+	rr = send(http.HandlerFunc(testclient.GetSLONames), "GET", "/slos", "")
+	verify(t, rr, http.StatusOK, `"api"`)
+
+	/* *** Update it, keeping a version *** */
+	rr = send(putSLO, "PUT", "/slos/api", strings.Replace(slo, "0.999", "0.99", 1))
+	verify(t, rr, http.StatusAccepted, "The existing rule: slo-api.rules is being updated.")
+	rr = send(http.HandlerFunc(testclient.GetPrometheusRuleVersions), "GET", "/prometheus/rules/slo-api.rules/versions", "")
+	verify(t, rr, http.StatusOK, `"version": `)
+
+	/* *** Delete it *** */
+	deleteSLO := http.HandlerFunc(testclient.DeleteSLO)
+	rr = send(deleteSLO, "DELETE", "/slos/api", "")
+	verifyStatus(t, rr, http.StatusAccepted)
+	rr = send(deleteSLO, "DELETE", "/slos/api", "")
+	verify(t, rr, http.StatusNotFound, "Unable to find an SLO called: api")
+	rr = send(http.HandlerFunc(testclient.GetSLO), "GET", "/slos/api", "")
+	verifyStatus(t, rr, http.StatusNotFound)
+}
+
+func TestSLOsRuleLintPolicy(t *testing.T) {
+	vmiName = "vmi-slos-lint-test"
+	namespace = "vmi-slos-lint-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+
+	testConfig := "vmi-" + vmiName + "-prometheus-rules"
+	testclient := newRulesTestClient(t, vmiName, namespace, testConfig)
+	lintConfigMap := getTestConfigMap(getRuleLintConfigMapName(), namespace, ruleLintPolicyKey, `rules:
+- name: summary
+  check: required_annotation
+  annotation: summary
+- name: runbook
+  check: required_annotation
+  annotation: runbook_url
+- name: unique-alert-name
+  check: unique_alert_name
+`)
+	if _, err := testclient.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), lintConfigMap, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	putSLO := http.HandlerFunc(testclient.PutSLO)
+	send := func(url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("PUT", url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		putSLO.ServeHTTP(rr, req)
+		return rr
+	}
+
+	slo := `{"sli": {"good": "http_requests_total{job=\"%s\",code!~\"5..\"}", "total": "http_requests_total{job=\"%s\"}"},
+ "target": 0.999%s}`
+	annotations := `, "annotations": {"runbook_url": "https://runbooks.example.com/slo"}`
+
+	/* *** The policy requires a runbook *** */
+	rr := send("/slos/api", fmt.Sprintf(slo, "api", "api", ""))
+	verify(t, rr, http.StatusBadRequest, "the alert has no runbook_url annotation")
+
+	/* *** Several SLOs pass the unique alert name check *** */
+	rr = send("/slos/api", fmt.Sprintf(slo, "api", "api", annotations))
+	verify(t, rr, http.StatusAccepted, "A new rule file: slo-api.rules is being created.")
+	rr = send("/slos/web", fmt.Sprintf(slo, "web", "web", annotations))
+	verify(t, rr, http.StatusAccepted, "A new rule file: slo-web.rules is being created.")
+}
@@ -0,0 +1,117 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSLORuleFile(t *testing.T) {
+	slo := SLO{SLI: SLI{Good: `http_requests_total{job="api",code!~"5.."}`, Total: `http_requests_total{job="api"}`}, Target: 0.999,
+		Labels: map[string]string{"team": "api"}}
+	window, err := validateSLO(&slo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slo.Window != "30d" {
+		t.Errorf("expected the default window, got %s", slo.Window)
+	}
+	ruleFile := sloRuleFile("api-availability", &slo, window)
+	if len(ruleFile.Groups) != 2 {
+		t.Fatalf("expected a recording and an alerting group, got %d groups", len(ruleFile.Groups))
+	}
+
+	var records []string
+	for _, rule := range ruleFile.Groups[0].Rules {
+		records = append(records, rule.Record)
+	}
+	if strings.Join(records, " ") != "slo:sli_error:ratio_rate5m slo:sli_error:ratio_rate30m slo:sli_error:ratio_rate1h "+
+		"slo:sli_error:ratio_rate2h slo:sli_error:ratio_rate6h slo:sli_error:ratio_rate1d slo:sli_error:ratio_rate3d" {
+		t.Errorf("unexpected recording rules: %v", records)
+	}
+	expected := `1 - (sum(rate(http_requests_total{job="api",code!~"5.."}[5m])) / sum(rate(http_requests_total{job="api"}[5m])))`
+	if expr := ruleFile.Groups[0].Rules[0].Expr; expr != expected {
+		t.Errorf("got %s, want %s", expr, expected)
+	}
+
+	alerts := ruleFile.Groups[1].Rules
+	if len(alerts) != 4 {
+		t.Fatalf("expected 4 burn rate alerts, got %d", len(alerts))
+	}
+	expected = `slo:sli_error:ratio_rate1h{slo="api-availability"} > 0.0144 and slo:sli_error:ratio_rate5m{slo="api-availability"} > 0.0144`
+	if alerts[0].Expr != expected {
+		t.Errorf("got %s, want %s", alerts[0].Expr, expected)
+	}
+	if alerts[3].Labels["severity"] != "warning" || alerts[3].Labels["team"] != "api" || alerts[3].Labels["slo"] != "api-availability" {
+		t.Errorf("unexpected labels: %v", alerts[3].Labels)
+	}
+	if alerts[0].Alert != "SLOErrorBudgetBurn_api_availability_1h" || alerts[3].Alert != "SLOErrorBudgetBurn_api_availability_3d" {
+		t.Errorf("expected the alerts to be named after the SLO and window, got %s and %s", alerts[0].Alert, alerts[3].Alert)
+	}
+	if !strings.HasSuffix(alerts[3].Expr, "> 0.001") {
+		t.Errorf("expected a burn rate of 1 over 3d, got %s", alerts[3].Expr)
+	}
+
+	// Alerts over windows longer than the SLO window are left out
+	slo.Window = "1d"
+	window, err = validateSLO(&slo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alerts := sloRuleFile("api-availability", &slo, window).Groups[1].Rules; len(alerts) != 3 {
+		t.Errorf("expected 3 burn rate alerts, got %d", len(alerts))
+	}
+}
+
+func TestSLOWindowPlaceholder(t *testing.T) {
+	slo := SLO{SLI: SLI{Good: `sum(rate(latency_bucket{le="0.5"}[$window]))`, Total: `sum(rate(latency_count[$window]))`}, Target: 0.99}
+	window, err := validateSLO(&slo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `1 - (sum(rate(latency_bucket{le="0.5"}[30m])) / sum(rate(latency_count[30m])))`
+	if expr := sloRuleFile("latency", &slo, window).Groups[0].Rules[1].Expr; expr != expected {
+		t.Errorf("got %s, want %s", expr, expected)
+	}
+}
+
+func TestValidateSLO(t *testing.T) {
+	for _, slo := range []SLO{
+		{SLI: SLI{Good: "good_total", Total: "all_total"}, Target: 1},
+		{SLI: SLI{Good: "good_total", Total: "all_total"}, Target: 0.99, Window: "30m"},
+		{SLI: SLI{Good: "good_total", Total: "all_total"}, Target: 0.99, Window: "a month"},
+		{SLI: SLI{Good: "good_total"}, Target: 0.99},
+		{SLI: SLI{Good: "rate(good_total[5m])", Total: "all_total"}, Target: 0.99},
+		{SLI: SLI{Good: "sum(rate(good_total[$window])", Total: "all_total"}, Target: 0.99},
+		{SLI: SLI{Good: "good_total", Total: "all_total"}, Target: 0.99, Annotations: map[string]string{"not-valid": "x"}},
+	} {
+		slo := slo
+		if _, err := validateSLO(&slo); err == nil {
+			t.Errorf("expected an error validating %+v", slo)
+		}
+	}
+}
+
+func TestSLODefinition(t *testing.T) {
+	slo := SLO{SLI: SLI{Good: "good_total", Total: "all_total"}, Target: 0.99}
+	window, err := validateSLO(&slo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules, err := generateSLORules("checkout", &slo, window)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definition := sloDefinition(string(rules))
+	if definition == nil || definition.Target != 0.99 || definition.SLI.Total != "all_total" || definition.Window != "30d" {
+		t.Errorf("unexpected definition: %+v", definition)
+	}
+	if _, err := parseRuleFile(rules); err != nil {
+		t.Errorf("the generated rules do not parse: %v", err)
+	}
+	if sloDefinition("groups: []") != nil {
+		t.Error("expected no definition in a rules file not generated for an SLO")
+	}
+}
@@ -0,0 +1,347 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/Jeffail/gabs/v2"
+	"github.com/prometheus/common/model"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Scrape job of prometheus.yml reading the target groups managed via /prometheus/targets/{group}
+const managedTargetsJob = "managed-targets"
+
+// Suffix of the target files of the target groups
+const targetGroupFileSuffix = ".json"
+
+// These can be set from the command line via -targetsConfigMap and -targetsPath.  The ConfigMap defaults to
+// vmi-<vmi>-prometheus-targets, and must be mounted at the path in the Prometheus container.
+var (
+	targetsConfigMap string
+	targetsPath      = "/etc/prometheus/targets"
+)
+
+// TargetGroup is a list of static targets, host:port, and the labels added to their series.  Each group is saved as a
+// file_sd_configs target file, so Prometheus picks up changes without its configuration being reloaded.
+type TargetGroup struct {
+	Targets []string          `json:"targets"`
+	Labels  map[string]string `json:"labels,omitempty"`
+}
+
+// getTargetsConfigMapName returns the name of the ConfigMap holding the target files.
+func getTargetsConfigMapName() string {
+	if targetsConfigMap != "" {
+		return targetsConfigMap
+	}
+	return "vmi-" + vmiName + "-prometheus-targets"
+}
+
+// getTargetGroupFiles returns the target files, and whether their ConfigMap exists.  There are none until the first
+// group is saved.
+func (k *K8s) getTargetGroupFiles(logger *zap.SugaredLogger) (map[string]string, bool, error) {
+	files, err := k.getShardedConfigMapByName(logger, getTargetsConfigMapName())
+	if k8serrors.IsNotFound(err) {
+		return map[string]string{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if files == nil {
+		files = make(map[string]string)
+	}
+	return files, true, nil
+}
+
+// createTargetsConfigMap creates the targets ConfigMap, with the labels and owner of the Prometheus configuration
+// ConfigMap, so it goes away with the VMI.
+func (k *K8s) createTargetsConfigMap() error {
+	vmi, err := k.getVMIJson()
+	if err != nil {
+		return err
+	}
+	configMapName, _ := vmi.Path(PrometheusConfigMapPath).Data().(string)
+	prometheusConfigMap, err := k.ClientSet.CoreV1().ConfigMaps(namespace).Get(context.TODO(), configMapName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	configMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            getTargetsConfigMapName(),
+			Namespace:       namespace,
+			Labels:          prometheusConfigMap.Labels,
+			OwnerReferences: prometheusConfigMap.OwnerReferences,
+		},
+	}
+	_, err = k.ClientSet.CoreV1().ConfigMaps(namespace).Create(context.TODO(), configMap, metav1.CreateOptions{})
+	return err
+}
+
+// checkTargetsMounted returns the problem if a Prometheus pod does not mount the targets ConfigMap at -targetsPath, as
+// Prometheus would then never read the target files.  Nothing can be checked while there is no Prometheus pod.
+func (k *K8s) checkTargetsMounted() *Problem {
+	pods, err := k.getPodsByLabel(getPrometheusPodSelector())
+	if err != nil {
+		return &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError, Detail: "Unable to list the Prometheus pods: " + err.Error()}
+	}
+	for i := range pods.Items {
+		if !podMountsConfigMap(&pods.Items[i], getTargetsConfigMapName(), targetsPath) {
+			return &Problem{Status: http.StatusConflict, Code: CodeConfigMapNotMounted,
+				Detail: "No action taken. The Prometheus pod " + pods.Items[i].Name + " does not mount the " + getTargetsConfigMapName() +
+					" ConfigMap at " + targetsPath + ", so Prometheus would never read the target groups."}
+		}
+	}
+	return nil
+}
+
+// saveTargetGroupFiles stores the target files in the targets ConfigMap and the shards mounted along with it, creating
+// the ConfigMap if it does not exist, and writes the response if they could not be stored.
+func (k *K8s) saveTargetGroupFiles(w http.ResponseWriter, r *http.Request, files map[string]string, exists bool) bool {
+	if !exists {
+		if err := k.createTargetsConfigMap(); err != nil && !k8serrors.IsAlreadyExists(err) {
+			internalError(w, r, "Unable to create the targets ConfigMap: "+err.Error())
+			return false
+		}
+	}
+	if err := k.updateMountedConfigMapByName(requestLogger(r), files, getTargetsConfigMapName()); err != nil {
+		configMapUpdateFailed(w, r, "Unable to update the targets ConfigMap:", err)
+		return false
+	}
+	return true
+}
+
+// validateTargetGroup checks the targets and labels of a target group.
+func validateTargetGroup(group *TargetGroup) error {
+	if len(group.Targets) == 0 {
+		return errors.New("no targets were provided")
+	}
+	for _, target := range group.Targets {
+		host, _, err := net.SplitHostPort(target)
+		if err != nil || host == "" || strings.Contains(target, "/") {
+			return fmt.Errorf("invalid target %q, targets must be host:port", target)
+		}
+	}
+	for name := range group.Labels {
+		if !model.LabelName(name).IsValid() {
+			return fmt.Errorf("invalid label name: %s", name)
+		}
+	}
+	return nil
+}
+
+// managedTargetsScrapeConfig returns the scrape job reading the target files, labelling each series with the group of
+// its target.
+func managedTargetsScrapeConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"job_name": managedTargetsJob,
+		"file_sd_configs": []interface{}{
+			map[string]interface{}{"files": []interface{}{targetsPath + "/*" + targetGroupFileSuffix}},
+		},
+		"relabel_configs": []interface{}{
+			map[string]interface{}{
+				"source_labels": []interface{}{"__meta_filepath"},
+				"regex":         `.*/(.*)\` + targetGroupFileSuffix,
+				"target_label":  "target_group",
+			},
+		},
+	}
+}
+
+// hasScrapeJob returns whether prometheus.yml has a scrape job with the given name.
+func hasScrapeJob(config *gabs.Container, jobName string) bool {
+	for _, job := range config.S("scrape_configs").Children() {
+		if name, ok := job.S("job_name").Data().(string); ok && name == jobName {
+			return true
+		}
+	}
+	return false
+}
+
+// addManagedTargetsJob adds the scrape job reading the target files to prometheus.yml, unless it is there already.
+// The rest of prometheus.yml is left as it is, comments included.  It returns whether the job was added, or the problem
+// saving prometheus.yml.
+func (k *K8s) addManagedTargetsJob(r *http.Request) (bool, *Problem) {
+	content, err := k.getPrometheusConfigYAML(requestLogger(r))
+	if err != nil {
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: fmt.Sprintf("Unable to read prometheus-config ConfigMap: %v", err)}
+	}
+	config, err := parsePrometheusConfig(content)
+	if err != nil {
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: "Unable to parse the Prometheus configuration: " + err.Error()}
+	}
+	if hasScrapeJob(config, managedTargetsJob) {
+		return false, nil
+	}
+	b, _, err := setPrometheusConfigListItem(content, "scrape_configs", "job_name", managedTargetsJob, managedTargetsScrapeConfig())
+	if err != nil {
+		return false, &Problem{Status: http.StatusInternalServerError, Code: CodeInternalError,
+			Detail: "Unable to add the " + managedTargetsJob + " scrape job: " + err.Error()}
+	}
+	return k.replacePrometheusConfig(r, b)
+}
+
+// validateTargetGroupName checks the name of a target group, and writes a 400 response if it is invalid.
+func validateTargetGroupName(w http.ResponseWriter, r *http.Request, group string) bool {
+	if validateName(group) != nil || ValidateConfigMapKeyName(group+targetGroupFileSuffix) != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidName, "ERROR: The target group name provided is invalid.")
+		return false
+	}
+	return true
+}
+
+// GetTargetGroupNames returns the names of all target groups.
+func (k *K8s) GetTargetGroupNames(w http.ResponseWriter, r *http.Request) {
+	files, _, err := k.getTargetGroupFiles(requestLogger(r))
+	if err != nil {
+		internalError(w, r, "Unable to read the targets ConfigMap: "+err.Error())
+		return
+	}
+	names := make([]string, 0, len(files))
+	for fileName := range files {
+		if strings.HasSuffix(fileName, targetGroupFileSuffix) {
+			names = append(names, strings.TrimSuffix(fileName, targetGroupFileSuffix))
+		}
+	}
+	sort.Strings(names)
+	successJSON(w, r, map[string][]string{"targets": names})
+}
+
+// GetTargetGroup returns the targets and labels of a target group.
+func (k *K8s) GetTargetGroup(w http.ResponseWriter, r *http.Request) {
+	group := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", group)
+	if !validateTargetGroupName(w, r, group) {
+		return
+	}
+	files, _, err := k.getTargetGroupFiles(requestLogger(r))
+	if err != nil {
+		internalError(w, r, "Unable to read the targets ConfigMap: "+err.Error())
+		return
+	}
+	content, ok := files[group+targetGroupFileSuffix]
+	if !ok {
+		problemError(w, r, http.StatusNotFound, CodeTargetGroupNotFound, "Unable to find a target group called: "+group)
+		return
+	}
+	var groups []TargetGroup
+	if err := json.Unmarshal([]byte(content), &groups); err != nil || len(groups) != 1 {
+		internalError(w, r, fmt.Sprintf("Unable to parse the target file of the group: %s, %v", group, err))
+		return
+	}
+	successJSON(w, r, groups[0])
+}
+
+// PutTargetGroup creates or replaces a target group.  The first group adds the managed-targets scrape job to
+// prometheus.yml, later changes only update the target files.
+func (k *K8s) PutTargetGroup(w http.ResponseWriter, r *http.Request) {
+	group := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", group)
+	if !validateTargetGroupName(w, r, group) {
+		return
+	}
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var targetGroup TargetGroup
+	if err := yaml.UnmarshalStrict(b, &targetGroup); err != nil {
+		validationFailed(w, r, CodeInvalidTargetGroup, "ERROR: Unable to parse the target group: "+err.Error(), err.Error())
+		return
+	}
+	if err := validateTargetGroup(&targetGroup); err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeInvalidTargetGroup, "ERROR: Invalid target group: "+err.Error())
+		return
+	}
+	content, err := json.MarshalIndent([]TargetGroup{targetGroup}, "", "  ")
+	if err != nil {
+		internalError(w, r, "Unable to convert the target group to JSON: "+err.Error())
+		return
+	}
+
+	if problem := k.checkTargetsMounted(); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	files, exists, err := k.getTargetGroupFiles(requestLogger(r))
+	if err != nil {
+		internalError(w, r, "Unable to read the targets ConfigMap: "+err.Error())
+		return
+	}
+	// The scrape job must be there for the targets to be scraped
+	jobAdded, problem := k.addManagedTargetsJob(r)
+	if problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	fileName := group + targetGroupFileSuffix
+	setAuditContent(r, files[fileName], string(content))
+	message := ""
+	if jobAdded {
+		message = " The " + managedTargetsJob + " scrape job was added to prometheus.yml."
+	}
+	if files[fileName] == string(content) {
+		success(w, r, "The provided body is identical to the current target group: "+group+". No action will be taken."+message)
+		return
+	}
+
+	_, existing := files[fileName]
+	files[fileName] = string(content)
+	if !k.saveTargetGroupFiles(w, r, files, exists) {
+		return
+	}
+	// returning HTTP status "202: Accepted".
+	// Prometheus reads the target files once the ConfigMap change reaches its container.
+	if existing {
+		accepted(w, r, "The existing target group: "+group+" is being updated."+message)
+		return
+	}
+	accepted(w, r, "A new target group: "+group+" is being created."+message)
+}
+
+// DeleteTargetGroup deletes a target group.  The managed-targets scrape job stays, with no targets left.
+func (k *K8s) DeleteTargetGroup(w http.ResponseWriter, r *http.Request) {
+	group := path.Base(r.URL.Path)
+	r = withLogFields(r, "resource", group)
+	if !validateTargetGroupName(w, r, group) {
+		return
+	}
+	files, exists, err := k.getTargetGroupFiles(requestLogger(r))
+	if err != nil {
+		internalError(w, r, "Unable to read the targets ConfigMap: "+err.Error())
+		return
+	}
+	fileName := group + targetGroupFileSuffix
+	current, ok := files[fileName]
+	if !ok {
+		problemError(w, r, http.StatusNotFound, CodeTargetGroupNotFound, "No action taken. Unable to find a target group called: "+group)
+		return
+	}
+	if problem := k.checkTargetsMounted(); problem != nil {
+		writeProblem(w, r, problem)
+		return
+	}
+	setAuditContent(r, current, "")
+	delete(files, fileName)
+	if !k.saveTargetGroupFiles(w, r, files, exists) {
+		return
+	}
+	accepted(w, r, "The target group: "+group+" is being deleted.")
+}
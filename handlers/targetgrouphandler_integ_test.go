@@ -0,0 +1,119 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+// +build integration
+
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestTargetGroups(t *testing.T) {
+	vmiName = "vmi-targets-test"
+	namespace = "vmi-targets-test"
+	promtoolPath = "/opt/tools/bin/promtool"
+	testclient := newPrometheusConfigTestClient(t, vmiName, namespace)
+	router := testclient.NewRouter(nil)
+
+	send := func(method string, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := send("GET", "/prometheus/targets", "")
+	verify(t, rr, http.StatusOK, `"targets": []`)
+	rr = send("GET", "/prometheus/targets/databases", "")
+	verifyStatus(t, rr, http.StatusNotFound)
+
+	/* *** Target groups are rejected while Prometheus does not mount their ConfigMap *** */
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "vmi-" + vmiName + "-prometheus-0", Namespace: namespace,
+			Labels: map[string]string{"app": "vmi-" + vmiName + "-prometheus"}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "prometheus"}}},
+	}
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Create(context.TODO(), pod, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rr = send("PUT", "/prometheus/targets/databases", `{"targets": ["db-1.example.com:9100"]}`)
+	verify(t, rr, http.StatusConflict, "does not mount the vmi-"+vmiName+"-prometheus-targets ConfigMap at /etc/prometheus/targets")
+	pod.Spec.Volumes = []corev1.Volume{{Name: "targets", VolumeSource: corev1.VolumeSource{
+		ConfigMap: &corev1.ConfigMapVolumeSource{LocalObjectReference: corev1.LocalObjectReference{Name: "vmi-" + vmiName + "-prometheus-targets"}}}}}
+	pod.Spec.Containers[0].VolumeMounts = []corev1.VolumeMount{{Name: "targets", MountPath: "/etc/prometheus/targets"}}
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Update(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	/* *** The first group adds the scrape job, and creates the targets ConfigMap *** */
+	rr = send("PUT", "/prometheus/targets/databases", `{"targets": ["db-1.example.com:9100", "db-2.example.com:9100"], "labels": {"env": "prod"}}`)
+	verify(t, rr, http.StatusAccepted, "A new target group: databases is being created. The managed-targets scrape job was added to prometheus.yml.")
+	_, configMap, err := testclient.getConfigMapByPath(zap.S(), PrometheusConfigMapPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(configMap[PrometheusConfigFileName], "- /etc/prometheus/targets/*.json") {
+		t.Errorf("expected the managed-targets scrape job, got %s", configMap[PrometheusConfigFileName])
+	}
+	files, err := testclient.getConfigMapByName("vmi-" + vmiName + "-prometheus-targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(files["databases.json"], `"db-2.example.com:9100"`) {
+		t.Errorf("unexpected target file: %s", files["databases.json"])
+	}
+
+	/* *** Later changes only update the target files *** */
+	rr = send("PUT", "/prometheus/targets/web", "targets:\n- web-1.example.com:9100\n")
+	verify(t, rr, http.StatusAccepted, "A new target group: web is being created.")
+	if strings.Contains(rr.Body.String(), "scrape job") {
+		t.Errorf("expected the scrape job to be added once, got %s", rr.Body.String())
+	}
+	rr = send("PUT", "/prometheus/targets/web", "targets:\n- web-1.example.com:9100\n- web-2.example.com:9100\n")
+	verify(t, rr, http.StatusAccepted, "The existing target group: web is being updated.")
+	rr = send("PUT", "/prometheus/targets/web", "targets:\n- web-1.example.com:9100\n- web-2.example.com:9100\n")
+	verify(t, rr, http.StatusOK, "identical")
+	rr = send("PUT", "/prometheus/targets/web", `{"targets": ["https://web-1.example.com"]}`)
+	verify(t, rr, http.StatusBadRequest, "targets must be host:port")
+	rr = send("PUT", "/prometheus/targets/web", `{"hosts": ["web-1.example.com:9100"]}`)
+	verifyStatus(t, rr, http.StatusBadRequest)
+
+	rr = send("GET", "/prometheus/targets", "")
+	verify(t, rr, http.StatusOK, `"databases",`)
+	rr = send("GET", "/prometheus/targets/databases", "")
+	verify(t, rr, http.StatusOK, `"env": "prod"`)
+
+	/* *** Delete a group *** */
+	rr = send("DELETE", "/prometheus/targets/databases", "")
+	verify(t, rr, http.StatusAccepted, "The target group: databases is being deleted.")
+	rr = send("DELETE", "/prometheus/targets/databases", "")
+	verifyStatus(t, rr, http.StatusNotFound)
+	files, err = testclient.getConfigMapByName("vmi-" + vmiName + "-prometheus-targets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := files["databases.json"]; ok || files["web.json"] == "" {
+		t.Errorf("unexpected target files: %v", files)
+	}
+
+	/* *** Deleting is rejected too while Prometheus does not mount the ConfigMap *** */
+	pod.Spec.Containers[0].VolumeMounts = nil
+	if _, err := testclient.ClientSet.CoreV1().Pods(namespace).Update(context.TODO(), pod, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	rr = send("DELETE", "/prometheus/targets/web", "")
+	verifyStatus(t, rr, http.StatusConflict)
+	rr = send("GET", "/prometheus/targets/web", "")
+	verifyStatus(t, rr, http.StatusOK)
+}
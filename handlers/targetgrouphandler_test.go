@@ -0,0 +1,52 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"testing"
+
+	"github.com/Jeffail/gabs/v2"
+)
+
+func TestValidateTargetGroup(t *testing.T) {
+	valid := []TargetGroup{
+		{Targets: []string{"db-1.example.com:9100", "10.0.0.2:9100"}},
+		{Targets: []string{"[::1]:9100"}, Labels: map[string]string{"env": "prod", "__metrics_path__": "/probe"}},
+	}
+	for _, group := range valid {
+		group := group
+		if err := validateTargetGroup(&group); err != nil {
+			t.Errorf("unexpected error validating %+v: %v", group, err)
+		}
+	}
+	invalid := []TargetGroup{
+		{},
+		{Targets: []string{"db-1.example.com"}},
+		{Targets: []string{"http://db-1.example.com:9100"}},
+		{Targets: []string{":9100"}},
+		{Targets: []string{"db-1.example.com:9100"}, Labels: map[string]string{"team-name": "db"}},
+	}
+	for _, group := range invalid {
+		group := group
+		if err := validateTargetGroup(&group); err == nil {
+			t.Errorf("expected an error validating %+v", group)
+		}
+	}
+}
+
+func TestManagedTargetsScrapeConfig(t *testing.T) {
+	config := gabs.New()
+	config.Array("scrape_configs")
+	if hasScrapeJob(config, managedTargetsJob) {
+		t.Fatal("unexpected scrape job")
+	}
+	config.ArrayAppend(managedTargetsScrapeConfig(), "scrape_configs")
+	if !hasScrapeJob(config, managedTargetsJob) {
+		t.Fatal("expected the scrape job to be found")
+	}
+	job := config.S("scrape_configs").Children()[0]
+	if files := job.Path("file_sd_configs").Index(0).S("files").Index(0).Data(); files != "/etc/prometheus/targets/*.json" {
+		t.Errorf("unexpected target files: %v", files)
+	}
+}
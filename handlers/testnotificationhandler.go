@@ -0,0 +1,207 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"go.uber.org/zap"
+	"sigs.k8s.io/yaml"
+)
+
+// Label added to test alerts, so each one is unique, and can be found in Alertmanager
+const testNotificationLabel = "test_notification"
+
+// Test alerts end after testNotificationDuration, so they resolve on their own.  Alertmanager is polled for the
+// receivers of a test alert for up to testNotificationTimeout.
+var (
+	testNotificationDuration     = 5 * time.Minute
+	testNotificationTimeout      = 10 * time.Second
+	testNotificationPollInterval = 200 * time.Millisecond
+)
+
+// TestNotificationRequest fires a synthetic alert, expected to be routed to Receiver.  The alert is named
+// TestNotification unless its labels give an alertname.
+type TestNotificationRequest struct {
+	Receiver string `json:"receiver"`
+	Alert    struct {
+		Labels      map[string]string `json:"labels,omitempty"`
+		Annotations map[string]string `json:"annotations,omitempty"`
+	} `json:"alert"`
+}
+
+// TestNotificationResult reports the receivers Alertmanager routed a test alert to, and whether they include the
+// expected one.
+type TestNotificationResult struct {
+	Receiver  string            `json:"receiver"`
+	Routed    bool              `json:"routed"`
+	Receivers []string          `json:"receivers"`
+	Labels    map[string]string `json:"labels"`
+	StartsAt  time.Time         `json:"startsAt"`
+	EndsAt    time.Time         `json:"endsAt"`
+	Message   string            `json:"message"`
+}
+
+// postableAlert is an alert posted to the Alertmanager API.
+type postableAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	StartsAt    time.Time         `json:"startsAt"`
+	EndsAt      time.Time         `json:"endsAt"`
+}
+
+// gettableAlert is an alert returned by the Alertmanager API, with the receivers it was routed to.
+type gettableAlert struct {
+	Labels    map[string]string `json:"labels"`
+	Receivers []struct {
+		Name string `json:"name"`
+	} `json:"receivers"`
+}
+
+// alertmanagerConfigReceivers is the part of the Alertmanager configuration naming its receivers.
+type alertmanagerConfigReceivers struct {
+	Receivers []struct {
+		Name string `json:"name"`
+	} `json:"receivers"`
+}
+
+// getAlertmanagerReceivers returns the names of the receivers of the Alertmanager configuration.
+func (k *K8s) getAlertmanagerReceivers(logger *zap.SugaredLogger) ([]string, error) {
+	_, configMap, err := k.getConfigMapByPath(logger, AlertmanagerConfigMapPath)
+	if err != nil {
+		return nil, err
+	}
+	var config alertmanagerConfigReceivers
+	if err := yaml.Unmarshal([]byte(configMap[AlertmanagerConfigFileName]), &config); err != nil {
+		return nil, err
+	}
+	receivers := make([]string, 0, len(config.Receivers))
+	for _, receiver := range config.Receivers {
+		receivers = append(receivers, receiver.Name)
+	}
+	return receivers, nil
+}
+
+// testAlert returns the alert a test notification request fires, made unique by the given ID.
+func testAlert(request *TestNotificationRequest, id string, now time.Time) (*postableAlert, error) {
+	alert := &postableAlert{
+		Labels:      map[string]string{"alertname": "TestNotification"},
+		Annotations: map[string]string{"summary": "Test notification of the receiver " + request.Receiver},
+		StartsAt:    now,
+		EndsAt:      now.Add(testNotificationDuration),
+	}
+	for name, value := range request.Alert.Labels {
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid label name: %s", name)
+		}
+		if name == testNotificationLabel {
+			return nil, fmt.Errorf("the label %s is reserved", testNotificationLabel)
+		}
+		alert.Labels[name] = value
+	}
+	for name, value := range request.Alert.Annotations {
+		if !model.LabelName(name).IsValid() {
+			return nil, fmt.Errorf("invalid annotation name: %s", name)
+		}
+		alert.Annotations[name] = value
+	}
+	alert.Labels[testNotificationLabel] = id
+	return alert, nil
+}
+
+// testAlertReceivers polls Alertmanager until it has the test alert with the given ID, and returns the receivers it
+// was routed to.
+func (k *K8s) testAlertReceivers(logger *zap.SugaredLogger, id string) ([]string, bool, error) {
+	params := url.Values{}
+	params.Set("filter", fmt.Sprintf("%s=%q", testNotificationLabel, id))
+	deadline := time.Now().Add(testNotificationTimeout)
+	for {
+		var alerts []gettableAlert
+		if err := k.alertmanagerAPI(logger, "GET", "/api/v2/alerts", params, nil, &alerts); err != nil {
+			return nil, false, err
+		}
+		for _, alert := range alerts {
+			if alert.Labels[testNotificationLabel] != id {
+				continue
+			}
+			receivers := make([]string, 0, len(alert.Receivers))
+			for _, receiver := range alert.Receivers {
+				receivers = append(receivers, receiver.Name)
+			}
+			return receivers, true, nil
+		}
+		if time.Now().After(deadline) {
+			return []string{}, false, nil
+		}
+		time.Sleep(testNotificationPollInterval)
+	}
+}
+
+// SendTestNotification fires a synthetic alert through Alertmanager, and reports whether it was routed to the given
+// receiver.  The alert gets a unique test_notification label, and ends after a few minutes.
+func (k *K8s) SendTestNotification(w http.ResponseWriter, r *http.Request) {
+	b, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		internalError(w, r, "Unable to read request Body: "+err.Error())
+		return
+	}
+	var request TestNotificationRequest
+	if err := json.Unmarshal(b, &request); err != nil {
+		validationFailed(w, r, CodeInvalidJSON, "ERROR: Unable to parse the test notification: "+err.Error(), err.Error())
+		return
+	}
+	if request.Receiver == "" {
+		problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: No receiver was provided")
+		return
+	}
+	r = withLogFields(r, "resource", request.Receiver)
+
+	receivers, err := k.getAlertmanagerReceivers(requestLogger(r))
+	if err != nil {
+		internalError(w, r, "Unable to read the Alertmanager configuration: "+err.Error())
+		return
+	}
+	if !containsString(receivers, request.Receiver) {
+		problemError(w, r, http.StatusNotFound, CodeReceiverNotFound, "Unable to find a receiver called: "+request.Receiver+
+			", the receivers are: "+strings.Join(receivers, ", "))
+		return
+	}
+
+	id := newRequestID()
+	alert, err := testAlert(&request, id, time.Now().UTC())
+	if err != nil {
+		problemError(w, r, http.StatusBadRequest, CodeBadRequest, "ERROR: Invalid alert: "+err.Error())
+		return
+	}
+	if err := k.alertmanagerAPI(requestLogger(r), "POST", "/api/v2/alerts", nil, []*postableAlert{alert}, nil); err != nil {
+		alertmanagerAPIFailed(w, r, err, "")
+		return
+	}
+
+	result := &TestNotificationResult{Receiver: request.Receiver, Labels: alert.Labels, StartsAt: alert.StartsAt, EndsAt: alert.EndsAt}
+	routedTo, found, err := k.testAlertReceivers(requestLogger(r), id)
+	if err != nil {
+		alertmanagerAPIFailed(w, r, err, "")
+		return
+	}
+	result.Receivers = routedTo
+	result.Routed = containsString(routedTo, request.Receiver)
+	switch {
+	case !found:
+		result.Message = fmt.Sprintf("Alertmanager did not report the test alert within %s.", testNotificationTimeout)
+	case result.Routed:
+		result.Message = "The test alert was routed to " + request.Receiver + ", its notification is sent once its group is due."
+	default:
+		result.Message = "The test alert was not routed to " + request.Receiver + ", check the routes of the Alertmanager configuration."
+	}
+	requestLogger(r).Infow("Sent a test notification", "id", id, "routed", result.Routed, "receivers", routedTo)
+	successJSON(w, r, result)
+}
@@ -0,0 +1,134 @@
+// Copyright (C) 2020, Oracle and/or its affiliates.
+// Licensed under the Universal Permissive License v 1.0 as shown at https://oss.oracle.com/licenses/upl.
+
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestSendTestNotification(t *testing.T) {
+	vmiName = "vmi-test-notification"
+	namespace = "vmi-test-notification"
+
+	// Webhook receiver stub, recording the notifications it gets
+	notifications := make(chan string, 10)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		notifications <- string(b)
+	}))
+	defer webhook.Close()
+
+	alertmanager := &fakeAlertmanager{routes: map[string]string{"team=api": "api-webhook"}, webhooks: map[string]string{"api-webhook": webhook.URL}}
+	server := httptest.NewServer(alertmanager)
+	defer server.Close()
+	testclient := newAlertmanagerTestClient(t, server)
+	defer func() { alertmanagerPort = "9093" }()
+	testNotificationTimeout = 100 * time.Millisecond
+	testNotificationPollInterval = 10 * time.Millisecond
+	defer func() { testNotificationTimeout, testNotificationPollInterval = 10*time.Second, 200*time.Millisecond }()
+
+	configMap := "vmi-" + vmiName + "-alertmanager-config"
+	err := testclient.updateConfigMapByName(zap.S(), map[string]string{AlertmanagerConfigFileName: `
+route:
+  receiver: test-orig
+  routes:
+  - match:
+      team: api
+    receiver: api-webhook
+receivers:
+- name: test-orig
+- name: api-webhook
+  webhook_configs:
+  - url: ` + webhook.URL}, configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest("POST", "/alertmanager/test-notification", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(testclient.SendTestNotification).ServeHTTP(rr, req)
+		return rr
+	}
+
+	/* *** Routed to the receiver *** */
+	rr := send(`{"receiver": "api-webhook", "alert": {"labels": {"team": "api", "severity": "critical"}, "annotations": {"summary": "Testing"}}}`)
+	verify(t, rr, http.StatusOK, `"routed": true`)
+	var result TestNotificationResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	id := result.Labels[testNotificationLabel]
+	if id == "" || result.Labels["alertname"] != "TestNotification" || result.EndsAt.Sub(result.StartsAt) != testNotificationDuration {
+		t.Errorf("unexpected test alert: %+v", result)
+	}
+	select {
+	case notification := <-notifications:
+		if !strings.Contains(notification, id) || !strings.Contains(notification, "Testing") {
+			t.Errorf("unexpected notification: %s", notification)
+		}
+	default:
+		t.Error("expected the webhook to be notified")
+	}
+	if len(alertmanager.filters) != 1 || alertmanager.filters[0] != testNotificationLabel+`="`+id+`"` {
+		t.Errorf("expected the alerts to be filtered by the test label, got %v", alertmanager.filters)
+	}
+
+	/* *** Each test alert is unique *** */
+	rr = send(`{"receiver": "api-webhook", "alert": {"labels": {"team": "api", "severity": "critical"}}}`)
+	verify(t, rr, http.StatusOK, `"routed": true`)
+	if strings.Contains(rr.Body.String(), id) {
+		t.Errorf("expected a new test label, got %s", rr.Body.String())
+	}
+
+	/* *** Routed to another receiver *** */
+	rr = send(`{"receiver": "api-webhook", "alert": {"labels": {"team": "web"}}}`)
+	verify(t, rr, http.StatusOK, `"routed": false`)
+	verify(t, rr, http.StatusOK, `"test-orig"`)
+
+	/* *** Invalid requests *** */
+	rr = send(`{"receiver": "pager"}`)
+	verify(t, rr, http.StatusNotFound, "Unable to find a receiver called: pager, the receivers are: test-orig, api-webhook")
+	rr = send(`{"receiver": "api-webhook", "alert": {"labels": {"test_notification": "x"}}}`)
+	verify(t, rr, http.StatusBadRequest, "is reserved")
+	rr = send(`{"alert": {}}`)
+	verify(t, rr, http.StatusBadRequest, "No receiver was provided")
+}
+
+func TestSendTestNotificationNotReported(t *testing.T) {
+	vmiName = "vmi-test-notification"
+	namespace = "vmi-test-notification"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Accept the alert, but never report it
+		w.Header().Set("Content-Type", ContentTypeJSON)
+		if r.Method == "GET" {
+			w.Write([]byte("[]"))
+		}
+	}))
+	defer server.Close()
+	testclient := newAlertmanagerTestClient(t, server)
+	defer func() { alertmanagerPort = "9093" }()
+	testNotificationTimeout = 50 * time.Millisecond
+	testNotificationPollInterval = 10 * time.Millisecond
+	defer func() { testNotificationTimeout, testNotificationPollInterval = 10*time.Second, 200*time.Millisecond }()
+
+	req, err := http.NewRequest("POST", "/alertmanager/test-notification", strings.NewReader(`{"receiver": "test-orig"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(testclient.SendTestNotification).ServeHTTP(rr, req)
+	verify(t, rr, http.StatusOK, "Alertmanager did not report the test alert within 50ms.")
+}